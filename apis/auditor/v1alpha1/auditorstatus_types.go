@@ -0,0 +1,130 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ResourceKindAuditorStatus = "AuditorStatus"
+	ResourceAuditorStatus     = "auditorstatus"
+	ResourceAuditorStatuses   = "auditorstatuses"
+)
+
+// AuditorStatus reports the live state of the audit pipeline of an auditor
+// replica. It is named after the replica's pod and updated periodically.
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=auditorstatuses,singular=auditorstatus,categories={auditor,appscode,all}
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Role",type="string",JSONPath=".status.role"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+// +kubebuilder:printcolumn:name="Sink",type="boolean",JSONPath=".status.sink.connected"
+// +kubebuilder:printcolumn:name="Backlog",type="integer",JSONPath=".status.sink.backlog"
+// +kubebuilder:printcolumn:name="Published",type="integer",JSONPath=".status.sink.published"
+// +kubebuilder:printcolumn:name="Dropped",type="integer",JSONPath=".status.sink.dropped"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type AuditorStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status AuditorStatusStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Standalone;Leader;Standby;ShardMember
+type AuditorRole string
+
+const (
+	AuditorRoleStandalone  AuditorRole = "Standalone"
+	AuditorRoleLeader      AuditorRole = "Leader"
+	AuditorRoleStandby     AuditorRole = "Standby"
+	AuditorRoleShardMember AuditorRole = "ShardMember"
+)
+
+// Condition types of an AuditorStatus.
+const (
+	// ConditionReady is true when every informer has synced and the sink is
+	// connected.
+	ConditionReady           = "Ready"
+	ConditionInformersSynced = "InformersSynced"
+	ConditionSinkConnected   = "SinkConnected"
+)
+
+type AuditorStatusStatus struct {
+	// Role of the replica.
+	// +optional
+	Role AuditorRole `json:"role,omitempty"`
+	// PolicyHash is the sha256 digest of the effective audit policy.
+	// +optional
+	PolicyHash string `json:"policyHash,omitempty"`
+	// Sink reports the state of the event receiver connection.
+	Sink SinkStatus `json:"sink"`
+	// Resources are the resources watched by the replica.
+	// +optional
+	Resources []WatchedResource `json:"resources,omitempty"`
+	// LastUpdateTime is the last time the status was updated.
+	// +optional
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+	// Conditions describe the state of the pipeline.
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+type SinkStatus struct {
+	// Connected reports whether the sink has connected.
+	Connected bool `json:"connected"`
+	// Backlog is the number of events waiting to be published.
+	Backlog int32 `json:"backlog"`
+	// Published is the number of events published since the replica started.
+	Published int64 `json:"published"`
+	// Dropped is the number of events dropped since the replica started,
+	// because the sink was not connected.
+	Dropped int64 `json:"dropped"`
+	// Failed is the number of events that could not be published since the
+	// replica started.
+	Failed int64 `json:"failed"`
+}
+
+type WatchedResource struct {
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+	Kind     string `json:"kind"`
+	// Synced reports whether the informer of the resource has synced.
+	Synced bool `json:"synced"`
+	// LastEventTime is the last time an event of the resource was published.
+	// +optional
+	LastEventTime *metav1.Time `json:"lastEventTime,omitempty"`
+}
+
+// AuditorStatusList is a list of AuditorStatuses
+
+// +kubebuilder:object:root=true
+type AuditorStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	// Items is a list of AuditorStatus CRD objects
+	Items []AuditorStatus `json:"items,omitempty"`
+}
@@ -0,0 +1,341 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+	"kubeops.dev/auditor/pkg/signing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/types"
+	"k8s.io/klog/v2"
+)
+
+// Cloudevent extensions added to every event of a hash chain.
+const (
+	ExtChain    = "auditchain"
+	ExtSequence = "auditseq"
+	ExtPrevious = "auditprev"
+)
+
+const fileMode = 0o600
+
+// compactAfter is the number of log entries after which the log is folded
+// into the state file.
+const compactAfter = 1000
+
+// State is the position of a hash chain.
+type State struct {
+	Chain    string `json:"chain"`
+	Sequence uint64 `json:"sequence"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// file is the persisted state of a Chain: the chain of unrouted events, and
+// the chains of the routing sinks by sink name.
+type file struct {
+	State
+	Sinks map[string]State `json:"sinks,omitempty"`
+}
+
+// entry is a line of the log, the position of one chain after an event.
+type entry struct {
+	Sink     string `json:"sink,omitempty"`
+	Sequence uint64 `json:"sequence"`
+	Hash     string `json:"hash"`
+}
+
+// Chain links every published event to the previous one by adding a
+// monotonic sequence number and the digest of the previous event. Dropped or
+// modified events break the chain, which Verify detects.
+//
+// Every routing sink receives only some of the events, so each sink has a
+// chain of its own, with the id "<id>/<sink>". The export of a sink then
+// verifies on its own.
+//
+// The position of a chain is appended to a log next to the state file, and
+// synced, before the event is sent, so a restarted auditor never reuses a
+// sequence number. The log is folded into the state file every
+// compactAfter events, and by Flush and Close.
+type Chain struct {
+	mu       sync.Mutex
+	path     string
+	readOnly bool
+	state    file
+	log      *os.File
+	entries  int
+}
+
+// Open loads the chain state persisted at path, or starts a new chain with
+// the given id if there is none.
+func Open(path, id string) (*Chain, error) {
+	c, err := load(path, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.log, err = os.OpenFile(logPath(path), os.O_WRONLY|os.O_CREATE|os.O_APPEND, fileMode); err != nil {
+		return nil, err
+	}
+	// start from a compacted state, which also drops a torn last entry
+	if err := c.compact(); err != nil {
+		_ = c.log.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// OpenReadOnly is like Open, but the chain never writes its state, for dry
+// runs.
+func OpenReadOnly(path, id string) (*Chain, error) {
+	c, err := load(path, id)
+	if err != nil {
+		return nil, err
+	}
+	c.readOnly = true
+	return c, nil
+}
+
+func load(path, id string) (*Chain, error) {
+	c := &Chain{
+		path:  path,
+		state: file{State: State{Chain: id}},
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &c.state); err != nil {
+			return nil, fmt.Errorf("invalid hash chain state in %s: %v", path, err)
+		}
+		if c.state.Chain != id {
+			return nil, fmt.Errorf("hash chain state in %s belongs to chain %q, not %q", path, c.state.Chain, id)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	data, err = os.ReadFile(logPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			// a crash can tear the last entry, whose event was never sent
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, fmt.Errorf("invalid hash chain log %s: %v", logPath(path), err)
+		}
+		// entries that were compacted before a crash are already applied
+		if e.Sequence > c.position(e.Sink).Sequence {
+			c.advance(e.Sink, State{Sequence: e.Sequence, Hash: e.Hash})
+		}
+	}
+	return c, nil
+}
+
+func logPath(path string) string {
+	return path + ".log"
+}
+
+// position returns the position of the chain of a sink. It must be called
+// with c.mu held, or before c is shared.
+func (c *Chain) position(sink string) State {
+	if sink == "" {
+		return c.state.State
+	}
+	s := c.state.Sinks[sink]
+	s.Chain = c.state.Chain + "/" + sink
+	return s
+}
+
+func (c *Chain) advance(sink string, s State) {
+	s.Chain = c.position(sink).Chain
+	if sink == "" {
+		c.state.State = s
+		return
+	}
+	if c.state.Sinks == nil {
+		c.state.Sinks = map[string]State{}
+	}
+	c.state.Sinks[sink] = s
+}
+
+// Transform adds the chain extensions to the event and advances the chain
+// of unrouted events.
+func (c *Chain) Transform(event *cloudevents.Event) error {
+	return c.TransformFor("", event)
+}
+
+// TransformFor adds the chain extensions to the copy of the event that is
+// sent to the given routing sink, and advances the chain of that sink. The
+// new position is persisted before TransformFor returns.
+func (c *Chain) TransformFor(sink string, event *cloudevents.Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev := c.position(sink)
+	next := State{
+		Chain:    prev.Chain,
+		Sequence: prev.Sequence + 1,
+	}
+	event.SetExtension(ExtChain, next.Chain)
+	event.SetExtension(ExtSequence, strconv.FormatUint(next.Sequence, 10))
+	if prev.Hash != "" {
+		event.SetExtension(ExtPrevious, prev.Hash)
+	}
+	next.Hash = Digest(event)
+
+	if !c.readOnly {
+		if err := c.append(entry{Sink: sink, Sequence: next.Sequence, Hash: next.Hash}); err != nil {
+			return fmt.Errorf("failed to persist hash chain position: %v", err)
+		}
+	}
+	c.advance(sink, next)
+	if !c.readOnly && c.entries >= compactAfter {
+		if err := c.compact(); err != nil {
+			// the log still holds the position
+			klog.ErrorS(err, "failed to compact hash chain log", "path", c.path)
+		}
+	}
+	return nil
+}
+
+// append must be called with c.mu held.
+func (c *Chain) append(e entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := c.log.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	c.entries++
+	return c.log.Sync()
+}
+
+// compact writes the state file and truncates the log. It must be called
+// with c.mu held.
+func (c *Chain) compact() error {
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(c.path), "."+filepath.Base(c.path)+".tmp")
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileMode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	if err := c.log.Truncate(0); err != nil {
+		return err
+	}
+	c.entries = 0
+	return nil
+}
+
+// Flush folds the log into the state file.
+func (c *Chain) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.readOnly || c.entries == 0 {
+		return nil
+	}
+	return c.compact()
+}
+
+// Close folds the log into the state file and closes the log.
+func (c *Chain) Close() error {
+	if err := c.Flush(); err != nil {
+		return err
+	}
+	if c.log == nil {
+		return nil
+	}
+	return c.log.Close()
+}
+
+// Digest returns the hex encoded sha256 digest of the event attributes that
+// are covered by the chain: the context attributes, every extension but the
+// signature, which is added after the chain, and the data. Extensions are
+// covered in the order of their names.
+func Digest(event *cloudevents.Event) string {
+	h := sha256.New()
+	for _, v := range []string{
+		event.ID(),
+		event.Source(),
+		event.Type(),
+		event.Subject(),
+		event.Time().UTC().Format(time.RFC3339Nano),
+	} {
+		_, _ = fmt.Fprintf(h, "%d:%s;", len(v), v)
+	}
+	exts := cloudevent.Extensions(event, signing.ExtSignature)
+	names := make([]string, 0, len(exts))
+	for name := range exts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(h, "%d:%s=%d:%s;", len(name), name, len(exts[name]), exts[name])
+	}
+	_, _ = h.Write(event.Data())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func extension(event *cloudevents.Event, name string) string {
+	v, ok := event.Extensions()[name]
+	if !ok {
+		return ""
+	}
+	s, err := types.ToString(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return s
+}
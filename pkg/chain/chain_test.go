@@ -0,0 +1,340 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chain
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kubeops.dev/auditor/pkg/signing"
+
+	cloudeventssdk "github.com/cloudevents/sdk-go/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+)
+
+func newEvent(t *testing.T, id string) *cloudevents.Event {
+	t.Helper()
+	event := cloudeventssdk.NewEvent()
+	event.SetID(id)
+	event.SetSource("/test")
+	event.SetType("created")
+	event.SetExtension("auditactor", "kubectl-edit")
+	event.SetExtension("clusteruid", "cluster-1")
+	if err := event.SetData(cloudevents.ApplicationJSON, map[string]string{"id": id}); err != nil {
+		t.Fatal(err)
+	}
+	return &event
+}
+
+func TestDigestCoversExtensions(t *testing.T) {
+	event := newEvent(t, "a")
+	digest := Digest(event)
+
+	signed := event.Clone()
+	signed.SetExtension(signing.ExtSignature, "header..signature")
+	if Digest(&signed) != digest {
+		t.Error("the signature changed the digest")
+	}
+
+	for name, tamper := range map[string]func(e *cloudevents.Event){
+		"actor":   func(e *cloudevents.Event) { e.SetExtension("auditactor", "someone-else") },
+		"cluster": func(e *cloudevents.Event) { e.SetExtension("clusteruid", "cluster-2") },
+		"added":   func(e *cloudevents.Event) { e.SetExtension("env", "prod") },
+		"removed": func(e *cloudevents.Event) { e.SetExtension("auditactor", nil) },
+	} {
+		e := event.Clone()
+		tamper(&e)
+		if Digest(&e) == digest {
+			t.Errorf("%s: changing the extensions didn't change the digest", name)
+		}
+	}
+}
+
+func TestChainDetectsTamperedExtensions(t *testing.T) {
+	c, err := Open(filepath.Join(t.TempDir(), "state.json"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := newEvent(t, "a"), newEvent(t, "b")
+	for _, e := range []*cloudevents.Event{first, second} {
+		if err := c.Transform(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, issues := Verify([]*cloudevents.Event{first, second}); len(issues) != 0 {
+		t.Fatalf("unexpected issues %v", issues)
+	}
+
+	first.SetExtension("auditactor", "someone-else")
+	_, issues := Verify([]*cloudevents.Event{first, second})
+	if len(issues) != 1 || issues[0].Reason != ReasonHashMismatch {
+		t.Fatalf("issues = %v, want a hash mismatch", issues)
+	}
+}
+
+func newChain(t *testing.T, n int) []*cloudevents.Event {
+	t.Helper()
+	c, err := Open(filepath.Join(t.TempDir(), "state.json"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make([]*cloudevents.Event, n)
+	for i := range events {
+		events[i] = newEvent(t, fmt.Sprint(i))
+		if err := c.Transform(events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return events
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		events func(events []*cloudevents.Event) []*cloudevents.Event
+		reason string
+	}{
+		{
+			name:   "good chain",
+			events: func(events []*cloudevents.Event) []*cloudevents.Event { return events },
+		},
+		{
+			name: "out of order",
+			events: func(events []*cloudevents.Event) []*cloudevents.Event {
+				return []*cloudevents.Event{events[2], events[0], events[3], events[1]}
+			},
+		},
+		{
+			name: "partial export",
+			events: func(events []*cloudevents.Event) []*cloudevents.Event {
+				return events[1:3]
+			},
+		},
+		{
+			name: "redelivered",
+			events: func(events []*cloudevents.Event) []*cloudevents.Event {
+				dup := events[1].Clone()
+				return append(events, &dup)
+			},
+		},
+		{
+			name: "gap",
+			events: func(events []*cloudevents.Event) []*cloudevents.Event {
+				return []*cloudevents.Event{events[0], events[2], events[3]}
+			},
+			reason: ReasonGap,
+		},
+		{
+			name: "duplicate",
+			events: func(events []*cloudevents.Event) []*cloudevents.Event {
+				dup := events[1].Clone()
+				dup.SetID("other")
+				return append(events, &dup)
+			},
+			reason: ReasonDuplicate,
+		},
+		{
+			name: "digest mismatch",
+			events: func(events []*cloudevents.Event) []*cloudevents.Event {
+				if err := events[1].SetData(cloudevents.ApplicationJSON, map[string]string{"id": "tampered"}); err != nil {
+					t.Fatal(err)
+				}
+				return events
+			},
+			reason: ReasonHashMismatch,
+		},
+		{
+			name: "missing sequence",
+			events: func(events []*cloudevents.Event) []*cloudevents.Event {
+				return append(events, newEvent(t, "unchained"))
+			},
+			reason: ReasonMissingSequence,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, issues := Verify(tt.events(newChain(t, 4)))
+			switch {
+			case tt.reason == "" && len(issues) != 0:
+				t.Errorf("unexpected issues %v", issues)
+			case tt.reason != "" && (len(issues) != 1 || issues[0].Reason != tt.reason):
+				t.Errorf("issues = %v, want one %s", issues, tt.reason)
+			}
+		})
+	}
+}
+
+func TestVerifySummary(t *testing.T) {
+	events := newChain(t, 4)
+	summaries, issues := Verify(events[1:])
+	if len(issues) != 0 {
+		t.Fatalf("unexpected issues %v", issues)
+	}
+	want := Summary{Chain: "test", First: 2, Last: 4, Events: 3}
+	if len(summaries) != 1 || summaries[0] != want {
+		t.Errorf("summaries = %v, want %v", summaries, want)
+	}
+}
+
+func TestSinkChains(t *testing.T) {
+	c, err := Open(filepath.Join(t.TempDir(), "state.json"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every event goes to the audit sink, every other one to the siem sink
+	exports := map[string][]*cloudevents.Event{}
+	for i := 0; i < 6; i++ {
+		sinks := []string{"audit"}
+		if i%2 == 0 {
+			sinks = append(sinks, "siem")
+		}
+		event := newEvent(t, fmt.Sprint(i))
+		for _, sink := range sinks {
+			e := event.Clone()
+			if err := c.TransformFor(sink, &e); err != nil {
+				t.Fatal(err)
+			}
+			exports[sink] = append(exports[sink], &e)
+		}
+	}
+
+	for sink, events := range exports {
+		summaries, issues := Verify(events)
+		if len(issues) != 0 {
+			t.Errorf("%s: unexpected issues %v", sink, issues)
+		}
+		want := Summary{Chain: "test/" + sink, First: 1, Last: uint64(len(events)), Events: len(events)}
+		if len(summaries) != 1 || summaries[0] != want {
+			t.Errorf("%s: summaries = %v, want %v", sink, summaries, want)
+		}
+	}
+}
+
+func TestStatePersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	c, err := Open(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []*cloudevents.Event
+	transform := func(c *Chain, sink string) {
+		e := newEvent(t, fmt.Sprint(len(events)))
+		if err := c.TransformFor(sink, e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	transform(c, "")
+	transform(c, "siem")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = Open(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transform(c, "")
+	transform(c, "siem")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	summaries, issues := Verify(events)
+	if len(issues) != 0 {
+		t.Fatalf("unexpected issues %v", issues)
+	}
+	if len(summaries) != 2 || summaries[0].Last != 2 || summaries[1].Last != 2 {
+		t.Errorf("summaries = %v, want two chains of two events", summaries)
+	}
+
+	if _, err := Open(path, "other"); err == nil {
+		t.Error("opened the state of another chain")
+	}
+}
+
+func TestReadOnlyChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	c, err := OpenReadOnly(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Transform(newEvent(t, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("read only chain wrote its state: %v", err)
+	}
+}
+
+func TestCrashRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	var events []*cloudevents.Event
+	transform := func(c *Chain, sink string) {
+		e := newEvent(t, fmt.Sprint(len(events)))
+		if err := c.TransformFor(sink, e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+
+	// the first process is killed without closing the chain
+	c, err := Open(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		transform(c, "")
+		transform(c, "siem")
+	}
+	// and tears the entry of an event it never sent
+	f, err := os.OpenFile(logPath(path), os.O_WRONLY|os.O_APPEND, fileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"sequence":4,"ha`); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	c, err = Open(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transform(c, "")
+	transform(c, "siem")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries, issues := Verify(events)
+	if len(issues) != 0 {
+		t.Fatalf("unexpected issues %v", issues)
+	}
+	for _, s := range summaries {
+		if s.First != 1 || s.Last != 4 || s.Events != 4 {
+			t.Errorf("summary = %+v, want events 1 to 4", s)
+		}
+	}
+	if info, err := os.Stat(logPath(path)); err != nil || info.Size() != 0 {
+		t.Errorf("log was not compacted on close: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chain
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+)
+
+const (
+	ReasonMissingSequence = "MissingSequence"
+	ReasonDuplicate       = "Duplicate"
+	ReasonGap             = "Gap"
+	ReasonHashMismatch    = "HashMismatch"
+)
+
+// Issue is a break in a hash chain.
+type Issue struct {
+	Chain    string `json:"chain"`
+	Sequence uint64 `json:"sequence,omitempty"`
+	EventID  string `json:"eventID,omitempty"`
+	Reason   string `json:"reason"`
+	Message  string `json:"message"`
+}
+
+// Summary describes the part of a chain found in an export.
+type Summary struct {
+	Chain  string `json:"chain"`
+	First  uint64 `json:"first"`
+	Last   uint64 `json:"last"`
+	Events int    `json:"events"`
+}
+
+type link struct {
+	seq   uint64
+	event *cloudevents.Event
+}
+
+// Verify checks the hash chains of the given events, which may be in any
+// order. An export may start or end in the middle of a chain, but every
+// event between the first and the last one must be present and unmodified.
+// Events of different chains, like the chains of routing sinks, are verified
+// separately.
+func Verify(events []*cloudevents.Event) ([]Summary, []Issue) {
+	var issues []Issue
+	chains := map[string][]link{}
+	for _, e := range events {
+		id := extension(e, ExtChain)
+		seq, err := strconv.ParseUint(extension(e, ExtSequence), 10, 64)
+		if id == "" || err != nil {
+			issues = append(issues, Issue{
+				Chain:   id,
+				EventID: e.ID(),
+				Reason:  ReasonMissingSequence,
+				Message: "event has no valid hash chain extensions",
+			})
+			continue
+		}
+		chains[id] = append(chains[id], link{seq: seq, event: e})
+	}
+
+	ids := make([]string, 0, len(chains))
+	for id := range chains {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	summaries := make([]Summary, 0, len(ids))
+	for _, id := range ids {
+		links := chains[id]
+		sort.SliceStable(links, func(i, j int) bool { return links[i].seq < links[j].seq })
+		summaries = append(summaries, Summary{
+			Chain:  id,
+			First:  links[0].seq,
+			Last:   links[len(links)-1].seq,
+			Events: len(links),
+		})
+
+		// duplicates are checked against, and chained to, the first event
+		// with their sequence number
+		prev := links[0]
+		for i := 1; i < len(links); i++ {
+			cur := links[i]
+			switch {
+			case cur.seq == prev.seq:
+				// redelivered events are fine, as long as they are identical
+				if Digest(cur.event) != Digest(prev.event) {
+					issues = append(issues, Issue{
+						Chain:    id,
+						Sequence: cur.seq,
+						EventID:  cur.event.ID(),
+						Reason:   ReasonDuplicate,
+						Message:  "different events have the same sequence number",
+					})
+				}
+				continue
+			case cur.seq != prev.seq+1:
+				issues = append(issues, Issue{
+					Chain:    id,
+					Sequence: cur.seq,
+					EventID:  cur.event.ID(),
+					Reason:   ReasonGap,
+					Message:  fmt.Sprintf("events %d to %d are missing", prev.seq+1, cur.seq-1),
+				})
+				prev = cur
+				continue
+			}
+			if want := Digest(prev.event); extension(cur.event, ExtPrevious) != want {
+				issues = append(issues, Issue{
+					Chain:    id,
+					Sequence: cur.seq,
+					EventID:  cur.event.ID(),
+					Reason:   ReasonHashMismatch,
+					Message:  fmt.Sprintf("previous hash %q doesn't match the digest %q of event %d", extension(cur.event, ExtPrevious), want, prev.seq),
+				})
+			}
+			prev = cur
+		}
+	}
+	return summaries, issues
+}
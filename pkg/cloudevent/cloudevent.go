@@ -0,0 +1,191 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudevent
+
+import (
+	"fmt"
+	"time"
+
+	cloudeventssdk "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding/format"
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	cetypes "github.com/cloudevents/sdk-go/v2/types"
+	api "go.bytebuilders.dev/audit/api/v1"
+	"go.bytebuilders.dev/license-verifier/info"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// ExtActor is the cloudevent extension that holds the field manager that
+// made the audited change, if known.
+const ExtActor = "auditactor"
+
+// Payload is the data of an audit cloudevent, as seen by receivers.
+type Payload struct {
+	LicenseID  string                     `json:"licenseID,omitempty"`
+	ResourceID kmapi.ResourceID           `json:"resourceID,omitempty"`
+	Resource   *unstructured.Unstructured `json:"resource,omitempty"`
+	Context    *Context                   `json:"context,omitempty"`
+}
+
+// Context describes the workload an audited object belongs to.
+type Context struct {
+	// Owners is the chain of controlling owners, from the direct owner of
+	// the object up to the root.
+	Owners []Owner `json:"owners,omitempty"`
+	App    *App    `json:"app,omitempty"`
+	Helm   *Helm   `json:"helm,omitempty"`
+	ArgoCD *ArgoCD `json:"argocd,omitempty"`
+}
+
+type Owner struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid"`
+}
+
+// App holds the app.kubernetes.io recommended labels.
+type App struct {
+	Name      string `json:"name,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Component string `json:"component,omitempty"`
+	PartOf    string `json:"partOf,omitempty"`
+	ManagedBy string `json:"managedBy,omitempty"`
+}
+
+// Helm identifies the Helm release that manages the object.
+type Helm struct {
+	Release   string `json:"release,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Chart     string `json:"chart,omitempty"`
+}
+
+// ArgoCD identifies the Argo CD application that manages the object.
+type ArgoCD struct {
+	Application string `json:"application,omitempty"`
+	TrackingID  string `json:"trackingID,omitempty"`
+}
+
+// enrichedEvent is the data of a cloudevent with context.
+type enrichedEvent struct {
+	*api.Event
+	Context *Context `json:"context,omitempty"`
+}
+
+// New wraps an audit event in the same cloudevent envelope that
+// lib.EventPublisher publishes.
+func New(ev *api.Event, et api.EventType) (*cloudevents.Event, error) {
+	return NewWithContext(ev, et, nil)
+}
+
+// NewWithContext is like New, and adds the context to the data of the
+// cloudevent, if set.
+func NewWithContext(ev *api.Event, et api.EventType, ctx *Context) (*cloudevents.Event, error) {
+	event := cloudeventssdk.NewEvent()
+	event.SetID(fmt.Sprintf("%s.%d", ev.Resource.GetUID(), ev.Resource.GetGeneration()))
+	// /byte.builders/auditor/license_id/feature/info.ProductName/api_group/api_resource/
+	// ref: https://github.com/cloudevents/spec/blob/v1.0.1/spec.md#source-1
+	event.SetSource(fmt.Sprintf("/byte.builders/auditor/%s/feature/%s/%s/%s", ev.LicenseID, info.ProductName, ev.ResourceID.Group, ev.ResourceID.Name))
+	// ref: https://github.com/cloudevents/spec/blob/v1.0.1/spec.md#subject
+	event.SetSubject(string(ev.Resource.GetUID()))
+	// ref: https://github.com/cloudevents/spec/blob/v1.0.1/spec.md#type
+	event.SetType(string(et))
+	event.SetTime(time.Now().UTC())
+
+	var data interface{} = ev
+	if ctx != nil {
+		data = enrichedEvent{Event: ev, Context: ctx}
+	}
+	if err := event.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// typeNames are the short names of the audit event types.
+var typeNames = map[api.EventType]string{
+	api.EventCreated: "created",
+	api.EventUpdated: "updated",
+	api.EventDeleted: "deleted",
+}
+
+// TypeName returns the short name of the type of an audit cloudevent, one
+// of created, updated and deleted. Other types are returned as is.
+func TypeName(et string) string {
+	if name, ok := typeNames[api.EventType(et)]; ok {
+		return name
+	}
+	return et
+}
+
+// ParseTypeName returns the event type of a short name, as returned by
+// TypeName.
+func ParseTypeName(name string) (api.EventType, bool) {
+	for et, n := range typeNames {
+		if n == name {
+			return et, true
+		}
+	}
+	return "", false
+}
+
+// Extensions returns the extension attributes of the event as strings,
+// without the skipped ones.
+func Extensions(event *cloudevents.Event, skip ...string) map[string]string {
+	exts := make(map[string]string, len(event.Extensions()))
+	for name, v := range event.Extensions() {
+		s, err := cetypes.ToString(v)
+		if err != nil {
+			s = fmt.Sprint(v)
+		}
+		exts[name] = s
+	}
+	for _, name := range skip {
+		delete(exts, name)
+	}
+	return exts
+}
+
+// Marshal encodes the event in the structured JSON format.
+func Marshal(event *cloudevents.Event) ([]byte, error) {
+	return format.JSON.Marshal(event)
+}
+
+// Unmarshal parses a structured JSON cloudevent.
+func Unmarshal(data []byte) (*cloudevents.Event, error) {
+	var event cloudevents.Event
+	if err := format.JSON.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// Decode parses a structured JSON cloudevent and its audit payload.
+func Decode(data []byte) (*cloudevents.Event, *Payload, error) {
+	event, err := Unmarshal(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var payload Payload
+	if err := event.DataAs(&payload); err != nil {
+		return nil, nil, err
+	}
+	return event, &payload, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudevent
+
+import (
+	"fmt"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// Cloudevent extensions that identify the cluster of every event.
+const (
+	ExtClusterUID      = "clusteruid"
+	ExtClusterName     = "clustername"
+	ExtClusterProvider = "clusterprovider"
+)
+
+// reserved are the attribute names that cluster labels can't use.
+var reserved = map[string]bool{
+	"specversion":      true,
+	"id":               true,
+	"source":           true,
+	"type":             true,
+	"subject":          true,
+	"time":             true,
+	"datacontenttype":  true,
+	"dataschema":       true,
+	"data":             true,
+	"data_base64":      true,
+	ExtClusterUID:      true,
+	ExtClusterName:     true,
+	ExtClusterProvider: true,
+}
+
+// Cluster adds the metadata and user defined labels of the cluster to every
+// cloudevent as extension attributes, so that events of many clusters can
+// be told apart.
+type Cluster struct {
+	metadata kmapi.ClusterMetadata
+	labels   map[string]string
+}
+
+// NewCluster returns a Cluster. Every label becomes an extension attribute
+// named after its key.
+func NewCluster(md kmapi.ClusterMetadata, labels map[string]string) (*Cluster, error) {
+	for k := range labels {
+		if err := ValidateExtensionName(k); err != nil {
+			return nil, fmt.Errorf("invalid cluster label %q: %v", k, err)
+		}
+	}
+	return &Cluster{metadata: md, labels: labels}, nil
+}
+
+func (c *Cluster) Transform(event *cloudevents.Event) error {
+	event.SetExtension(ExtClusterUID, c.metadata.UID)
+	if c.metadata.Name != "" {
+		event.SetExtension(ExtClusterName, c.metadata.Name)
+	}
+	if c.metadata.Provider != "" {
+		event.SetExtension(ExtClusterProvider, string(c.metadata.Provider))
+	}
+	for k, v := range c.labels {
+		event.SetExtension(k, v)
+	}
+	return nil
+}
+
+// ValidateExtensionName checks that name is a cloudevent extension
+// attribute name, lowercase letters and digits, that doesn't shadow a
+// context attribute or the extensions of the auditor. Names starting with
+// "audit" are kept for the auditor.
+func ValidateExtensionName(name string) error {
+	if name == "" || len(name) > 20 {
+		return fmt.Errorf("extension attribute names must have 1 to 20 characters")
+	}
+	if strings.IndexFunc(name, func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	}) >= 0 {
+		return fmt.Errorf("extension attribute names must consist of lowercase letters and digits")
+	}
+	if reserved[name] || strings.HasPrefix(name, "audit") {
+		return fmt.Errorf("%s is a reserved attribute name", name)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"kubeops.dev/auditor/pkg/chain"
+	"kubeops.dev/auditor/pkg/cloudevent"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdChain(in io.Reader, out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "chain",
+		Short:             "Work with the hash chain of published audit events",
+		DisableAutoGenTag: true,
+	}
+	cmd.AddCommand(newCmdChainVerify(in, out))
+	return cmd
+}
+
+func newCmdChainVerify(in io.Reader, out io.Writer) *cobra.Command {
+	var (
+		file   string
+		output = "table"
+	)
+
+	cmd := &cobra.Command{
+		Use:               "verify",
+		Short:             "Report gaps and mismatches in an exported stream of audit events",
+		DisableAutoGenTag: true,
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return fmt.Errorf("missing --file")
+			}
+			r := in
+			if file != "-" {
+				f, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+			events, err := readEvents(r)
+			if err != nil {
+				return err
+			}
+
+			summaries, issues := chain.Verify(events)
+			if output != "table" {
+				if err := printObject(out, output, map[string]interface{}{
+					"chains": summaries,
+					"issues": issues,
+				}); err != nil {
+					return err
+				}
+			} else {
+				w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+				fmt.Fprintln(w, "CHAIN\tFIRST\tLAST\tEVENTS")
+				for _, s := range summaries {
+					fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", s.Chain, s.First, s.Last, s.Events)
+				}
+				if len(issues) > 0 {
+					fmt.Fprintln(w)
+					fmt.Fprintln(w, "CHAIN\tSEQUENCE\tEVENT\tREASON\tMESSAGE")
+					for _, i := range issues {
+						fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", i.Chain, i.Sequence, i.EventID, i.Reason, i.Message)
+					}
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+			}
+			if len(issues) > 0 {
+				return fmt.Errorf("found %d hash chain issues", len(issues))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", file, "File with newline delimited audit cloudevents. Use - to read from stdin")
+	cmd.Flags().StringVarP(&output, "output", "o", output, "Output format. One of: table|json|yaml")
+	return cmd
+}
+
+func readEvents(r io.Reader) ([]*cloudevents.Event, error) {
+	var events []*cloudevents.Event
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			event, perr := cloudevent.Unmarshal(line)
+			if perr != nil {
+				return nil, fmt.Errorf("line %d: %v", n, perr)
+			}
+			events = append(events, event)
+		}
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+	"kubeops.dev/auditor/pkg/encryption"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCmdDecrypt(in io.Reader, out io.Writer) *cobra.Command {
+	var file, keyDir string
+
+	cmd := &cobra.Command{
+		Use:               "decrypt",
+		Short:             "Decrypt the encrypted fields of exported audit events",
+		Long:              "Decrypt the encrypted fields of exported audit events. Events are read and written as newline delimited cloudevents. Decrypted events no longer match their signature.",
+		DisableAutoGenTag: true,
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return fmt.Errorf("missing --file")
+			}
+			if keyDir == "" {
+				return fmt.Errorf("missing --key-dir")
+			}
+			keys, err := encryption.LoadKeys(keyDir)
+			if err != nil {
+				return err
+			}
+			r := in
+			if file != "-" {
+				f, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+			events, err := readEvents(r)
+			if err != nil {
+				return err
+			}
+
+			d := encryption.NewDecrypter(keys)
+			for _, event := range events {
+				if _, err := d.Decrypt(event); err != nil {
+					return fmt.Errorf("event %s: %v", event.ID(), err)
+				}
+				data, err := cloudevent.Marshal(event)
+				if err != nil {
+					return err
+				}
+				if _, err := out.Write(append(data, '\n')); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", file, "File with newline delimited audit cloudevents. Use - to read from stdin")
+	cmd.Flags().StringVar(&keyDir, "key-dir", keyDir, "Directory with the key encryption keys, in <key-id>.key files")
+	return cmd
+}
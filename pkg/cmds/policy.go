@@ -0,0 +1,159 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"kubeops.dev/auditor/pkg/policy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/yaml"
+)
+
+type discoveryOptions struct {
+	clientOptions
+	discoveryFile string
+}
+
+func (o *discoveryOptions) AddFlags(fs *pflag.FlagSet) {
+	o.clientOptions.AddFlags(fs)
+	fs.StringVar(&o.discoveryFile, "discovery-file", o.discoveryFile, "Use this discovery dump or kubectl discovery cache directory instead of live discovery")
+}
+
+func (o *discoveryOptions) resources() ([]*metav1.APIResourceList, error) {
+	if o.discoveryFile != "" {
+		return policy.LoadDiscoveryDump(o.discoveryFile)
+	}
+	cfg, err := o.restConfig()
+	if err != nil {
+		return nil, err
+	}
+	disco, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return policy.ServerPreferredResources(disco)
+}
+
+func NewCmdPolicy(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "policy",
+		Short:             "Validate and generate audit policies",
+		DisableAutoGenTag: true,
+	}
+	cmd.AddCommand(newCmdPolicyValidate(out))
+	cmd.AddCommand(newCmdPolicyGenerate(out))
+	return cmd
+}
+
+func newCmdPolicyValidate(out io.Writer) *cobra.Command {
+	var (
+		o          discoveryOptions
+		policyFile string
+		output     = "table"
+	)
+
+	cmd := &cobra.Command{
+		Use:               "validate",
+		Short:             "Report policy entries that can't be watched",
+		DisableAutoGenTag: true,
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if policyFile == "" {
+				return fmt.Errorf("missing --policy-file")
+			}
+			p, err := policy.Load(policyFile)
+			if err != nil {
+				return err
+			}
+			rsLists, err := o.resources()
+			if err != nil {
+				return err
+			}
+
+			issues := policy.Validate(p, rsLists)
+			if output != "table" {
+				if err := printObject(out, output, issues); err != nil {
+					return err
+				}
+			} else if len(issues) > 0 {
+				w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+				fmt.Fprintln(w, "GROUP\tRESOURCE\tREASON")
+				for _, issue := range issues {
+					fmt.Fprintf(w, "%s\t%s\t%s\n", issue.Group, issue.Resource, issue.Reason)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+			}
+			if len(issues) > 0 {
+				return fmt.Errorf("policy %s has %d invalid entries", policyFile, len(issues))
+			}
+			return nil
+		},
+	}
+	o.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&policyFile, "policy-file", policyFile, "Path to the policy file to validate")
+	cmd.Flags().StringVarP(&output, "output", "o", output, "Output format. One of: table|json|yaml")
+	return cmd
+}
+
+func newCmdPolicyGenerate(out io.Writer) *cobra.Command {
+	var (
+		o          discoveryOptions
+		include    []string
+		exclude    []string
+		outputFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:               "generate",
+		Short:             "Generate a policy from discovery",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rsLists, err := o.resources()
+			if err != nil {
+				return err
+			}
+			p, err := policy.Generate(rsLists, include, exclude)
+			if err != nil {
+				return err
+			}
+			data, err := yaml.Marshal(p)
+			if err != nil {
+				return err
+			}
+			if outputFile != "" {
+				return os.WriteFile(outputFile, data, 0o644)
+			}
+			_, err = out.Write(data)
+			return err
+		},
+	}
+	o.AddFlags(cmd.Flags())
+	cmd.Flags().StringSliceVar(&include, "include-group", include, "Only include api groups matching these patterns, e.g. *.kubedb.com. Use \"core\" for the core api group")
+	cmd.Flags().StringSliceVar(&exclude, "exclude-group", exclude, "Exclude api groups matching these patterns")
+	cmd.Flags().StringVar(&outputFile, "output-file", outputFile, "Write the policy to this file instead of stdout")
+	return cmd
+}
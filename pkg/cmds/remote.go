@@ -0,0 +1,94 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"io"
+
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"kmodules.xyz/client-go/tools/clientcmd"
+)
+
+// clientOptions select the cluster to talk to.
+type clientOptions struct {
+	kubeConfig  string
+	kubeContext string
+}
+
+func (o *clientOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.kubeConfig, "kubeconfig", o.kubeConfig, "Path to kubeconfig file with authorization information")
+	fs.StringVar(&o.kubeContext, "context", o.kubeContext, "Name of the kubeconfig context to use")
+}
+
+func (o *clientOptions) restConfig() (*rest.Config, error) {
+	return clientcmd.BuildConfigFromContext(o.kubeConfig, o.kubeContext)
+}
+
+func (o *clientOptions) kubeClient() (kubernetes.Interface, error) {
+	cfg, err := o.restConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(cfg)
+}
+
+// remoteOptions locate a running auditor through the Kubernetes service proxy.
+type remoteOptions struct {
+	clientOptions
+	namespace string
+	service   string
+}
+
+func newRemoteOptions() *remoteOptions {
+	return &remoteOptions{
+		namespace: "kubeops",
+		service:   "auditor",
+	}
+}
+
+func (o *remoteOptions) AddFlags(fs *pflag.FlagSet) {
+	o.clientOptions.AddFlags(fs)
+	fs.StringVar(&o.namespace, "auditor-namespace", o.namespace, "Namespace where the auditor is running")
+	fs.StringVar(&o.service, "auditor-service", o.service, "Name of the auditor service")
+}
+
+// get calls the given path of the auditor api server.
+func (o *remoteOptions) get(ctx context.Context, path string, params map[string]string) ([]byte, error) {
+	kc, err := o.kubeClient()
+	if err != nil {
+		return nil, err
+	}
+	return kc.CoreV1().Services(o.namespace).ProxyGet("https", o.service, "", path, params).DoRaw(ctx)
+}
+
+// stream opens a long running response from the given path of the auditor api server.
+func (o *remoteOptions) stream(ctx context.Context, path string) (io.ReadCloser, error) {
+	kc, err := o.kubeClient()
+	if err != nil {
+		return nil, err
+	}
+	return kc.CoreV1().RESTClient().Get().
+		Namespace(o.namespace).
+		Resource("services").
+		Name("https:" + o.service + ":").
+		SubResource("proxy").
+		Suffix(path).
+		Stream(ctx)
+}
@@ -39,6 +39,11 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(v.NewCmdVersion())
 	stopCh := genericapiserver.SetupSignalHandler()
 	rootCmd.AddCommand(NewCmdRun(os.Stdout, os.Stderr, stopCh))
+	rootCmd.AddCommand(NewCmdTimeline(os.Stdout))
+	rootCmd.AddCommand(NewCmdPolicy(os.Stdout))
+	rootCmd.AddCommand(NewCmdTail(os.Stdout))
+	rootCmd.AddCommand(NewCmdChain(os.Stdin, os.Stdout))
+	rootCmd.AddCommand(NewCmdDecrypt(os.Stdin, os.Stdout))
 
 	return rootCmd
 }
@@ -19,22 +19,71 @@ package server
 import (
 	"flag"
 	"fmt"
-	"os"
+	"strings"
 	"time"
 
+	"kubeops.dev/auditor/pkg/cloudevent"
 	"kubeops.dev/auditor/pkg/controller"
+	"kubeops.dev/auditor/pkg/encryption"
+	"kubeops.dev/auditor/pkg/objects"
+	"kubeops.dev/auditor/pkg/policy"
+	"kubeops.dev/auditor/pkg/routing"
+	"kubeops.dev/auditor/pkg/store"
+	"kubeops.dev/auditor/pkg/subject"
 
 	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"kmodules.xyz/client-go/meta"
 	"kmodules.xyz/client-go/tools/clusterid"
-	"kmodules.xyz/custom-resources/apis/auditor/v1alpha1"
-	"sigs.k8s.io/yaml"
 )
 
 type ExtraOptions struct {
-	LicenseFile string
-	PolicyFile  string
+	LicenseFile   string
+	ClusterLabels string
+	PolicyFile    string
+	DryRun        bool
+	Offline       bool
+	SinkFile      string
+	RoutingFile   string
+	Subject       string
+
+	PublishTimeout time.Duration
+	StatusInterval time.Duration
+
+	SiteInfo         bool
+	SiteInfoInterval time.Duration
+
+	MetadataOnly bool
+	TrimFields   string
+	Enrich       bool
+
+	HashChainFile string
+	HashChainID   string
+
+	EncryptionPolicyFile string
+	EncryptionKeyDir     string
+	EncryptionKeyID      string
+
+	SigningKeyDir string
+	SigningKeyID  string
+
+	LeaderElect              bool
+	LeaderElectNamespace     string
+	LeaderElectLeaseDuration time.Duration
+	LeaderElectRenewDeadline time.Duration
+	LeaderElectRetryPeriod   time.Duration
+
+	Shard              bool
+	ShardNamespace     string
+	ShardLeaseDuration time.Duration
+	ShardRenewInterval time.Duration
+
+	StorePath    string
+	StoreMaxAge  time.Duration
+	StoreMaxSize string
 
 	MaxNumRequeues int
 	NumThreads     int
@@ -50,6 +99,19 @@ func NewExtraOptions() *ExtraOptions {
 		QPS:            100,
 		Burst:          100,
 		ResyncPeriod:   10 * time.Minute,
+		StoreMaxAge:    7 * 24 * time.Hour,
+		StoreMaxSize:   "1Gi",
+		PublishTimeout: 5 * time.Minute,
+		StatusInterval: 30 * time.Second,
+
+		SiteInfoInterval: time.Hour,
+
+		LeaderElectLeaseDuration: 15 * time.Second,
+		LeaderElectRenewDeadline: 10 * time.Second,
+		LeaderElectRetryPeriod:   2 * time.Second,
+
+		ShardLeaseDuration: 40 * time.Second,
+		ShardRenewInterval: 10 * time.Second,
 	}
 }
 
@@ -57,8 +119,46 @@ func (s *ExtraOptions) AddGoFlags(fs *flag.FlagSet) {
 	clusterid.AddGoFlags(fs)
 
 	fs.StringVar(&s.LicenseFile, "license-file", s.LicenseFile, "Path to license file")
+	fs.StringVar(&s.ClusterLabels, "cluster-labels", s.ClusterLabels, "Comma separated key=value labels of the cluster added to every event as cloudevent extension attributes, next to clusteruid, clustername and clusterprovider, e.g. env=prod,region=useast1. Keys must be lowercase letters and digits")
 
 	fs.StringVar(&s.PolicyFile, "policy-file", s.PolicyFile, "Path to policy file used to watch Kubernetes resources")
+	fs.BoolVar(&s.DryRun, "dry-run", s.DryRun, "If true, print audit events to stdout instead of publishing them and report the event volume on exit. No license file is needed, the dedupe and hash chain state is read but never written, and the event store, the AuditorStatus and Kubernetes events are disabled")
+	fs.BoolVar(&s.Offline, "offline", s.Offline, "If true, verify the license locally against the embedded license CA and publish events to --sink-file, without contacting the license or event receiver servers")
+	fs.StringVar(&s.SinkFile, "sink-file", s.SinkFile, "Path of the file audit events are appended to in offline mode, as newline delimited cloudevents")
+	fs.StringVar(&s.Subject, "subject-template", s.Subject, "Go template of the NATS subject every event is published to, instead of the subject assigned to the license, e.g. {{.Subject}}.{{.ClusterID}}.{{.ResourceID.Group}}.{{.ResourceID.Kind}}.{{.Namespace}}.{{.Type}}. Characters invalid in NATS subjects are replaced with _")
+	fs.StringVar(&s.RoutingFile, "routing-file", s.RoutingFile, "Path to a routing table that sends audit events to named NATS subjects, files or OTLP collectors by group, kind, namespace, labels and event type. Events matching no route go to the default sinks of the table")
+
+	fs.DurationVar(&s.PublishTimeout, "publish-timeout", s.PublishTimeout, "The liveness check fails if no audit event could be published for this long while events are waiting. Zero disables the check")
+	fs.DurationVar(&s.StatusInterval, "status-interval", s.StatusInterval, "How often the AuditorStatus of this replica is updated. Zero disables the status")
+	fs.BoolVar(&s.SiteInfo, "site-info", s.SiteInfo, "If true, publish the SiteInfo of the cluster, with node stats, the Kubernetes version, control plane certificates and the auditor version, to the same sinks as audit events")
+	fs.DurationVar(&s.SiteInfoInterval, "site-info-interval", s.SiteInfoInterval, "How often the SiteInfo is published. It is also published when nodes are added, removed or resized")
+
+	fs.BoolVar(&s.MetadataOnly, "metadata-only", s.MetadataOnly, "If true, informers cache only object metadata and full objects are fetched from the api server when an audit event is published. The event store and stream then get only published events. Uses much less memory at the cost of extra GET requests")
+	fs.BoolVar(&s.Enrich, "enrich", s.Enrich, "If true, published events carry the owner chain of objects up to the root, and the app.kubernetes.io labels, Helm release and Argo CD application of the object or its owners")
+	fs.StringVar(&s.TrimFields, "trim-fields", s.TrimFields, "Comma separated list of dot separated field paths removed from audited objects, e.g. status,metadata.annotations.kubectl\\.kubernetes\\.io/last-applied-configuration")
+
+	fs.StringVar(&s.HashChainFile, "hash-chain-file", s.HashChainFile, "If set, every published event is linked to the previous one sent to the same sink with a sequence number and hash, and the chain positions are persisted in this file and a .log file next to it before every event is sent")
+	fs.StringVar(&s.HashChainID, "hash-chain-id", s.HashChainID, "Identifies the hash chain of this auditor instance. Defaults to the pod name")
+	fs.StringVar(&s.EncryptionPolicyFile, "encryption-policy", s.EncryptionPolicyFile, "Path to a file that selects fields of audited objects to encrypt before publishing, storing or streaming them")
+	fs.StringVar(&s.EncryptionKeyDir, "encryption-key-dir", s.EncryptionKeyDir, "Directory with the AES-256 keys that wrap the data keys of encrypted fields, usually a mounted Secret. Keys are stored in <key-id>.key files")
+	fs.StringVar(&s.EncryptionKeyID, "encryption-key-id", s.EncryptionKeyID, "ID of the key new data keys are wrapped with. Required if --encryption-key-dir holds more than one key")
+	fs.StringVar(&s.SigningKeyDir, "signing-key-dir", s.SigningKeyDir, "If set, the data of every published event is signed with a key from this directory, usually a mounted Secret. Keys are PEM encoded ed25519 or ECDSA keys in <key-id>.pem files; files with only a public key keep rotated keys verifiable")
+	fs.StringVar(&s.SigningKeyID, "signing-key-id", s.SigningKeyID, "ID of the key events are signed with. Required if --signing-key-dir holds more than one private key")
+
+	fs.BoolVar(&s.LeaderElect, "leader-elect", s.LeaderElect, "If true, only the replica holding the leader lease watches and publishes audit events. The dedupe state is persisted in ConfigMaps so that a new leader doesn't republish objects")
+	fs.StringVar(&s.LeaderElectNamespace, "leader-elect-namespace", s.LeaderElectNamespace, "Namespace of the leader lease and the dedupe state. Defaults to the namespace of the pod")
+	fs.DurationVar(&s.LeaderElectLeaseDuration, "leader-elect-lease-duration", s.LeaderElectLeaseDuration, "The duration that non-leader candidates will wait after observing a leadership renewal before attempting to acquire leadership")
+	fs.DurationVar(&s.LeaderElectRenewDeadline, "leader-elect-renew-deadline", s.LeaderElectRenewDeadline, "The interval between attempts by the acting leader to renew leadership before it stops leading")
+	fs.DurationVar(&s.LeaderElectRetryPeriod, "leader-elect-retry-period", s.LeaderElectRetryPeriod, "The duration the clients should wait between attempting acquisition and renewal of leadership")
+
+	fs.BoolVar(&s.Shard, "shard", s.Shard, "If true, replicas split the audited resources between them. Membership is tracked with one Lease per replica. Can't be used with --leader-elect")
+	fs.StringVar(&s.ShardNamespace, "shard-namespace", s.ShardNamespace, "Namespace of the shard membership leases and the dedupe state. Defaults to the namespace of the pod")
+	fs.DurationVar(&s.ShardLeaseDuration, "shard-lease-duration", s.ShardLeaseDuration, "A replica that hasn't renewed its membership lease for this long is removed from the shard")
+	fs.DurationVar(&s.ShardRenewInterval, "shard-renew-interval", s.ShardRenewInterval, "How often a replica renews its membership lease and rebalances the audited resources")
+
+	fs.StringVar(&s.StorePath, "store-path", s.StorePath, "Path to the local event store file. If empty, audit events are not stored locally")
+	fs.DurationVar(&s.StoreMaxAge, "store-max-age", s.StoreMaxAge, "Audit events older than this are removed from the local event store")
+	fs.StringVar(&s.StoreMaxSize, "store-max-size", s.StoreMaxSize, "Maximum total size of audit events kept in the local event store")
 
 	fs.Float64Var(&s.QPS, "qps", s.QPS, "The maximum QPS to the master from this client")
 	fs.IntVar(&s.Burst, "burst", s.Burst, "The maximum burst for throttle")
@@ -75,19 +175,138 @@ func (s *ExtraOptions) ApplyTo(cfg *controller.Config) error {
 	var err error
 
 	if s.PolicyFile != "" {
-		data, err := os.ReadFile(s.PolicyFile)
+		p, err := policy.Load(s.PolicyFile)
+		if err != nil {
+			return err
+		}
+		cfg.Policy = *p
+	}
+
+	cfg.LicenseFile = s.LicenseFile
+	if s.ClusterLabels != "" {
+		cfg.ClusterLabels = map[string]string{}
+		for _, kv := range strings.Split(s.ClusterLabels, ",") {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				return fmt.Errorf("invalid cluster label %q, expected key=value", kv)
+			}
+			if err := cloudevent.ValidateExtensionName(k); err != nil {
+				return fmt.Errorf("invalid cluster label %q: %v", k, err)
+			}
+			cfg.ClusterLabels[k] = v
+		}
+	}
+	cfg.DryRun = s.DryRun
+	if s.SinkFile != "" && !s.Offline {
+		return fmt.Errorf("--sink-file requires --offline")
+	}
+	cfg.Offline = controller.OfflineConfig{
+		Enabled:  s.Offline,
+		SinkFile: s.SinkFile,
+	}
+	if s.Subject != "" {
+		if s.Offline || s.RoutingFile != "" {
+			return fmt.Errorf("--subject-template can't be used with --offline or --routing-file, set the subject of the routing sinks instead")
+		}
+		t, err := subject.Parse(s.Subject)
 		if err != nil {
-			return fmt.Errorf("failed to read policy file: %v", err)
+			return err
 		}
-		var policy v1alpha1.AuditRegistration
-		err = yaml.Unmarshal(data, &policy)
+		cfg.SubjectTemplate = t
+	}
+	if s.RoutingFile != "" {
+		t, err := routing.Load(s.RoutingFile)
+		if err != nil {
+			return err
+		}
+		cfg.Routing = t
+	}
+	cfg.PublishTimeout = s.PublishTimeout
+	cfg.Status = controller.StatusConfig{
+		Interval:  s.StatusInterval,
+		Namespace: meta.PodNamespace(),
+		Name:      meta.PodName(),
+	}
+	cfg.SiteInfo = controller.SiteInfoConfig{
+		Enabled:  s.SiteInfo,
+		Interval: s.SiteInfoInterval,
+	}
+	cfg.MetadataOnly = s.MetadataOnly
+	cfg.Enrich = s.Enrich
+	if s.HashChainFile != "" {
+		id := s.HashChainID
+		if id == "" {
+			id = meta.PodName()
+		}
+		cfg.HashChain = controller.HashChainConfig{
+			Path: s.HashChainFile,
+			ID:   id,
+		}
+	}
+	if s.EncryptionPolicyFile != "" {
+		if s.EncryptionKeyDir == "" {
+			return fmt.Errorf("--encryption-policy requires --encryption-key-dir")
+		}
+		p, err := encryption.LoadPolicy(s.EncryptionPolicyFile)
 		if err != nil {
-			return fmt.Errorf("failed to parse policy file: %v", err)
+			return err
+		}
+		cfg.Encryption = controller.EncryptionConfig{
+			Policy: p,
+			KeyDir: s.EncryptionKeyDir,
+			KeyID:  s.EncryptionKeyID,
 		}
-		cfg.Policy = policy
+	}
+	cfg.Signing = controller.SigningConfig{
+		KeyDir: s.SigningKeyDir,
+		KeyID:  s.SigningKeyID,
+	}
+	if s.TrimFields != "" {
+		cfg.TrimFields = objects.ParseFieldPaths(strings.Split(s.TrimFields, ","))
 	}
 
-	cfg.LicenseFile = s.LicenseFile
+	if s.LeaderElect && s.Shard {
+		return fmt.Errorf("--leader-elect and --shard are mutually exclusive")
+	}
+	if s.LeaderElect {
+		ns := s.LeaderElectNamespace
+		if ns == "" {
+			ns = meta.PodNamespace()
+		}
+		cfg.LeaderElection = controller.LeaderElectionConfig{
+			Enabled:       true,
+			Namespace:     ns,
+			LeaseName:     "auditor",
+			LeaseDuration: s.LeaderElectLeaseDuration,
+			RenewDeadline: s.LeaderElectRenewDeadline,
+			RetryPeriod:   s.LeaderElectRetryPeriod,
+		}
+	}
+	if s.Shard {
+		ns := s.ShardNamespace
+		if ns == "" {
+			ns = meta.PodNamespace()
+		}
+		cfg.Sharding = controller.ShardingConfig{
+			Enabled:       true,
+			Namespace:     ns,
+			Identity:      meta.PodName(),
+			LeaseDuration: s.ShardLeaseDuration,
+			RenewInterval: s.ShardRenewInterval,
+		}
+	}
+
+	if s.StorePath != "" {
+		maxSize, err := resource.ParseQuantity(s.StoreMaxSize)
+		if err != nil {
+			return fmt.Errorf("invalid store max size %q: %v", s.StoreMaxSize, err)
+		}
+		cfg.EventStore = store.Options{
+			Path:    s.StorePath,
+			MaxAge:  s.StoreMaxAge,
+			MaxSize: maxSize.Value(),
+		}
+	}
 
 	cfg.MaxNumRequeues = s.MaxNumRequeues
 	cfg.NumThreads = s.NumThreads
@@ -101,6 +320,9 @@ func (s *ExtraOptions) ApplyTo(cfg *controller.Config) error {
 	if cfg.DynamicClient, err = dynamic.NewForConfig(cfg.ClientConfig); err != nil {
 		return err
 	}
+	if cfg.MetadataClient, err = metadata.NewForConfig(cfg.ClientConfig); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -109,9 +109,11 @@ func (o AuditorOptions) Run(stopCh <-chan struct{}) error {
 		return err
 	}
 
-	// Start periodic license verification
-	//nolint:errcheck
-	go license.VerifyLicensePeriodically(config.ExtraConfig.ClientConfig, o.ExtraOptions.LicenseFile, stopCh)
+	// Start periodic license verification, unless events are only printed
+	if !o.ExtraOptions.DryRun {
+		//nolint:errcheck
+		go license.VerifyLicensePeriodically(config.ExtraConfig.ClientConfig, o.ExtraOptions.LicenseFile, stopCh)
+	}
 
 	return s.Run(stopCh)
 }
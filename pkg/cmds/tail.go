@@ -0,0 +1,373 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+	"kubeops.dev/auditor/pkg/stream"
+	"kubeops.dev/auditor/pkg/timeline"
+
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	api "go.bytebuilders.dev/audit/api/v1"
+	"gomodules.xyz/jsonpatch/v2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/lru"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	tailRowFormat      = "%-20s  %-8s  %-24s  %-24s  %-20s  %-32s  %s\n"
+	tailFollowInterval = time.Second
+	tailDiffCacheSize  = 4096
+)
+
+// tailRecord is the decoded form of an audit cloudevent, as printed by tail.
+type tailRecord struct {
+	ID         string                     `json:"id"`
+	Time       time.Time                  `json:"time"`
+	Type       string                     `json:"type"`
+	ResourceID kmapi.ResourceID           `json:"resourceID"`
+	Namespace  string                     `json:"namespace,omitempty"`
+	Name       string                     `json:"name"`
+	Generation int64                      `json:"generation,omitempty"`
+	Object     *unstructured.Unstructured `json:"object,omitempty"`
+	Diff       []jsonpatch.Operation      `json:"diff,omitempty"`
+}
+
+type tailOptions struct {
+	*remoteOptions
+	natsServer  string
+	natsSubject string
+	natsCreds   string
+	file        string
+	follow      bool
+
+	group     string
+	kind      string
+	namespace string
+	name      string
+	types     []string
+	output    string
+	showDiff  bool
+
+	out io.Writer
+	// previous holds the last object of every uid, for diffs. Deletes may be
+	// missed, so the least recently seen objects are dropped.
+	previous *lru.Cache
+}
+
+func (o *tailOptions) AddFlags(fs *pflag.FlagSet) {
+	o.remoteOptions.AddFlags(fs)
+	fs.StringVar(&o.natsServer, "nats-server", o.natsServer, "Subscribe to audit events on this NATS server instead of a running auditor")
+	fs.StringVar(&o.natsSubject, "nats-subject", o.natsSubject, "NATS subject to subscribe to")
+	fs.StringVar(&o.natsCreds, "nats-creds", o.natsCreds, "Path to the NATS user credentials file")
+	fs.StringVar(&o.file, "file", o.file, "Read newline delimited audit cloudevents from this file instead of a running auditor")
+	fs.BoolVarP(&o.follow, "follow", "f", o.follow, "Keep reading --file as new events are appended")
+
+	fs.StringVar(&o.group, "group", o.group, "Only show events for this API group")
+	fs.StringVar(&o.kind, "kind", o.kind, "Only show events for this kind")
+	fs.StringVarP(&o.namespace, "namespace", "n", o.namespace, "Only show events in this namespace")
+	fs.StringVar(&o.name, "name", o.name, "Only show events for objects with this name")
+	fs.StringSliceVar(&o.types, "type", o.types, "Only show these event types. One or more of: created|updated|deleted")
+	fs.StringVarP(&o.output, "output", "o", o.output, "Output format. One of: table|json|yaml")
+	fs.BoolVar(&o.showDiff, "show-diff", o.showDiff, "Show the changes of an object since its previous event")
+}
+
+func (o *tailOptions) validate() error {
+	for _, t := range o.types {
+		if _, ok := cloudevent.ParseTypeName(t); !ok {
+			return fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	switch o.output {
+	case "table", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format %q", o.output)
+	}
+	if o.natsServer != "" && o.file != "" {
+		return fmt.Errorf("--nats-server and --file are mutually exclusive")
+	}
+	if o.natsServer != "" && o.natsSubject == "" {
+		return fmt.Errorf("missing --nats-subject")
+	}
+	return nil
+}
+
+func NewCmdTail(out io.Writer) *cobra.Command {
+	o := &tailOptions{
+		remoteOptions: newRemoteOptions(),
+		output:        "table",
+		out:           out,
+		previous:      lru.New(tailDiffCacheSize),
+	}
+
+	cmd := &cobra.Command{
+		Use:               "tail",
+		Short:             "Stream live audit events",
+		DisableAutoGenTag: true,
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.validate(); err != nil {
+				return err
+			}
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			if o.output == "table" {
+				fmt.Fprintf(out, tailRowFormat, "TIME", "TYPE", "GROUP", "KIND", "NAMESPACE", "NAME", "GENERATION")
+			}
+			switch {
+			case o.natsServer != "":
+				return o.tailNats(ctx)
+			case o.file != "":
+				return o.tailFile(ctx)
+			default:
+				return o.tailAuditor(ctx)
+			}
+		},
+	}
+	o.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func (o *tailOptions) tailNats(ctx context.Context) error {
+	opts := []nats.Option{nats.Name("auditor-tail")}
+	if o.natsCreds != "" {
+		opts = append(opts, nats.UserCredentials(o.natsCreds))
+	}
+	nc, err := nats.Connect(o.natsServer, opts...)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	msgs := make(chan *nats.Msg, 64)
+	sub, err := nc.ChanSubscribe(o.natsSubject, msgs)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-msgs:
+			if err := o.handle(msg.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (o *tailOptions) tailFile(ctx context.Context) error {
+	f, err := os.Open(o.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return o.readLines(ctx, f, o.follow)
+}
+
+func (o *tailOptions) tailAuditor(ctx context.Context) error {
+	r, err := o.stream(ctx, stream.PathEvents)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	err = o.readLines(ctx, r, false)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// readLines passes every complete line of r to handle. If follow is set,
+// it waits for more data at the end of r until ctx is cancelled.
+func (o *tailOptions) readLines(ctx context.Context, r io.Reader, follow bool) error {
+	br := bufio.NewReader(r)
+	var line []byte
+	for {
+		chunk, err := br.ReadBytes('\n')
+		line = append(line, chunk...)
+		if err == nil {
+			if err := o.handle(line); err != nil {
+				return err
+			}
+			line = line[:0]
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+		if !follow {
+			if len(bytes.TrimSpace(line)) > 0 {
+				return o.handle(line)
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(tailFollowInterval):
+		}
+	}
+}
+
+func (o *tailOptions) handle(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil
+	}
+	event, payload, err := cloudevent.Decode(data)
+	if err != nil {
+		klog.V(3).InfoS("skipping message that isn't an audit cloudevent", "error", err)
+		return nil
+	}
+	if payload.Resource == nil {
+		payload.Resource = &unstructured.Unstructured{Object: map[string]interface{}{}}
+	}
+
+	rec := tailRecord{
+		ID:         event.ID(),
+		Time:       event.Time(),
+		Type:       cloudevent.TypeName(event.Type()),
+		ResourceID: payload.ResourceID,
+		Namespace:  payload.Resource.GetNamespace(),
+		Name:       payload.Resource.GetName(),
+		Generation: payload.Resource.GetGeneration(),
+		Object:     payload.Resource,
+	}
+	if !o.matches(rec) {
+		return nil
+	}
+	// diffs are tracked for filtered out event types too, so that updates
+	// are compared against the object as created.
+	if o.showDiff {
+		if err := o.diff(&rec); err != nil {
+			return err
+		}
+	}
+	if !o.matchesType(rec) {
+		return nil
+	}
+	return o.print(rec)
+}
+
+func (o *tailOptions) matches(rec tailRecord) bool {
+	if o.group != "" && rec.ResourceID.Group != o.group {
+		return false
+	}
+	if o.kind != "" && !strings.EqualFold(rec.ResourceID.Kind, o.kind) {
+		return false
+	}
+	if o.namespace != "" && rec.Namespace != o.namespace {
+		return false
+	}
+	if o.name != "" && rec.Name != o.name {
+		return false
+	}
+	return true
+}
+
+func (o *tailOptions) matchesType(rec tailRecord) bool {
+	if len(o.types) == 0 {
+		return true
+	}
+	for _, t := range o.types {
+		if t == rec.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// diff compares the object with the one seen in the previous event for the
+// same uid. Only events seen since tail started are taken into account.
+func (o *tailOptions) diff(rec *tailRecord) error {
+	uid := rec.Object.GetUID()
+	prev, found := o.previous.Get(uid)
+	if rec.Type == cloudevent.TypeName(string(api.EventDeleted)) {
+		o.previous.Remove(uid)
+	} else {
+		o.previous.Add(uid, rec.Object)
+	}
+	if !found {
+		return nil
+	}
+	var err error
+	rec.Diff, err = timeline.Diff(prev.(*unstructured.Unstructured), rec.Object)
+	return err
+}
+
+func (o *tailOptions) print(rec tailRecord) error {
+	switch o.output {
+	case "json":
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		_, err = o.out.Write(append(data, '\n'))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(o.out, "---\n%s", data)
+		return err
+	}
+
+	fmt.Fprintf(o.out, tailRowFormat,
+		rec.Time.Local().Format(time.RFC3339),
+		rec.Type,
+		rec.ResourceID.Group,
+		rec.ResourceID.Kind,
+		rec.Namespace,
+		rec.Name,
+		fmt.Sprint(rec.Generation),
+	)
+	for _, op := range rec.Diff {
+		value, err := json.Marshal(op.Value)
+		if err != nil {
+			return err
+		}
+		if op.Operation == "remove" {
+			fmt.Fprintf(o.out, "    %s %s\n", op.Operation, op.Path)
+		} else {
+			fmt.Fprintf(o.out, "    %s %s: %s\n", op.Operation, op.Path, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"kubeops.dev/auditor/pkg/encryption"
+	"kubeops.dev/auditor/pkg/store"
+	"kubeops.dev/auditor/pkg/timeline"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+type timelineOptions struct {
+	*remoteOptions
+	storePath string
+	output    string
+
+	uid       string
+	group     string
+	kind      string
+	namespace string
+	name      string
+	since     string
+	until     string
+	limit     int
+}
+
+func (o *timelineOptions) AddFlags(fs *pflag.FlagSet) {
+	o.remoteOptions.AddFlags(fs)
+	fs.StringVar(&o.storePath, "store-path", o.storePath, "Read events from this local event store file instead of a running auditor")
+	fs.StringVarP(&o.output, "output", "o", o.output, "Output format. One of: table|json|yaml")
+
+	fs.StringVar(&o.uid, "uid", o.uid, "UID of the object")
+	fs.StringVar(&o.group, "group", o.group, "API group of the object")
+	fs.StringVar(&o.kind, "kind", o.kind, "Kind of the object")
+	fs.StringVarP(&o.namespace, "namespace", "n", o.namespace, "Namespace of the object")
+	fs.StringVar(&o.name, "name", o.name, "Name of the object")
+	fs.StringVar(&o.since, "since", o.since, "Only include events at or after this RFC3339 time")
+	fs.StringVar(&o.until, "until", o.until, "Only include events at or before this RFC3339 time")
+	fs.IntVar(&o.limit, "limit", o.limit, "Only include the most recent revisions")
+}
+
+func (o *timelineOptions) query() (store.Query, error) {
+	q := store.Query{
+		UID:       types.UID(o.uid),
+		Group:     o.group,
+		Kind:      o.kind,
+		Namespace: o.namespace,
+		Name:      o.name,
+		Limit:     o.limit,
+	}
+	if q.UID == "" && q.Name == "" {
+		return q, fmt.Errorf("either --uid or --name is required")
+	}
+	var err error
+	if o.since != "" {
+		if q.Since, err = time.Parse(time.RFC3339, o.since); err != nil {
+			return q, fmt.Errorf("invalid --since: %v", err)
+		}
+	}
+	if o.until != "" {
+		if q.Until, err = time.Parse(time.RFC3339, o.until); err != nil {
+			return q, fmt.Errorf("invalid --until: %v", err)
+		}
+	}
+	return q, nil
+}
+
+func (o *timelineOptions) openStore() (*store.Store, error) {
+	return store.Open(store.Options{Path: o.storePath, ReadOnly: true})
+}
+
+func NewCmdTimeline(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "timeline",
+		Short:             "Inspect the stored history of an object",
+		DisableAutoGenTag: true,
+	}
+	cmd.AddCommand(newCmdTimelineRevisions(out))
+	cmd.AddCommand(newCmdTimelineShow(out))
+	return cmd
+}
+
+func newCmdTimelineRevisions(out io.Writer) *cobra.Command {
+	o := &timelineOptions{remoteOptions: newRemoteOptions(), output: "table"}
+
+	cmd := &cobra.Command{
+		Use:               "revisions",
+		Short:             "List every revision of an object with diffs",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q, err := o.query()
+			if err != nil {
+				return err
+			}
+
+			var revisions []timeline.Revision
+			if o.storePath != "" {
+				s, err := o.openStore()
+				if err != nil {
+					return err
+				}
+				defer s.Close()
+				if revisions, err = timeline.Revisions(s, q); err != nil {
+					return err
+				}
+			} else {
+				data, err := o.get(context.TODO(), timeline.PathRevisions, timeline.QueryParams(q))
+				if err != nil {
+					return err
+				}
+				if err = json.Unmarshal(data, &revisions); err != nil {
+					return err
+				}
+			}
+
+			if o.output != "table" {
+				return printObject(out, o.output, revisions)
+			}
+			w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "SEQ\tTIME\tTYPE\tNAMESPACE\tNAME\tGENERATION\tCHANGES")
+			for _, rev := range revisions {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\n", rev.Seq, rev.Time.Format(time.RFC3339), rev.Type, rev.Namespace, rev.Name, rev.Generation, len(rev.Diff))
+			}
+			return w.Flush()
+		},
+	}
+	o.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func newCmdTimelineShow(out io.Writer) *cobra.Command {
+	o := &timelineOptions{remoteOptions: newRemoteOptions(), output: "yaml"}
+	var at, keyDir string
+
+	cmd := &cobra.Command{
+		Use:               "show",
+		Short:             "Show an object as it was at a point in time",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q, err := o.query()
+			if err != nil {
+				return err
+			}
+			t := time.Now()
+			if at != "" {
+				if t, err = time.Parse(time.RFC3339, at); err != nil {
+					return fmt.Errorf("invalid --at: %v", err)
+				}
+			}
+
+			var obj map[string]interface{}
+			if o.storePath != "" {
+				s, err := o.openStore()
+				if err != nil {
+					return err
+				}
+				defer s.Close()
+				u, err := timeline.ObjectAt(s, q, t)
+				if err != nil {
+					return err
+				}
+				obj = u.Object
+			} else {
+				params := timeline.QueryParams(q)
+				params["at"] = t.Format(time.RFC3339)
+				data, err := o.get(context.TODO(), timeline.PathObject, params)
+				if err != nil {
+					return err
+				}
+				if err = json.Unmarshal(data, &obj); err != nil {
+					return err
+				}
+			}
+			if keyDir != "" {
+				keys, err := encryption.LoadKeys(keyDir)
+				if err != nil {
+					return err
+				}
+				if _, err := encryption.NewDecrypter(keys).DecryptObject(&unstructured.Unstructured{Object: obj}); err != nil {
+					return err
+				}
+			}
+			return printObject(out, o.output, obj)
+		},
+	}
+	o.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&at, "at", at, "RFC3339 time to reconstruct the object at. Defaults to now")
+	cmd.Flags().StringVar(&keyDir, "key-dir", keyDir, "Decrypt encrypted fields locally with the keys in this directory. The auditor never returns decrypted fields")
+	return cmd
+}
+
+func printObject(out io.Writer, format string, v interface{}) error {
+	var data []byte
+	var err error
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(v, "", "  ")
+		data = append(data, '\n')
+	case "yaml":
+		data, err = yaml.Marshal(v)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
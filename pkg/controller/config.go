@@ -18,23 +18,140 @@ package controller
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
+	"kubeops.dev/auditor/pkg/dedupe"
+	"kubeops.dev/auditor/pkg/encryption"
 	"kubeops.dev/auditor/pkg/eventer"
+	"kubeops.dev/auditor/pkg/publisher"
+	"kubeops.dev/auditor/pkg/routing"
+	"kubeops.dev/auditor/pkg/signing"
+	"kubeops.dev/auditor/pkg/store"
+	"kubeops.dev/auditor/pkg/stream"
+	"kubeops.dev/auditor/pkg/subject"
 
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
 	"kmodules.xyz/client-go/discovery"
 	"kmodules.xyz/custom-resources/apis/auditor/v1alpha1"
 )
 
+type LeaderElectionConfig struct {
+	Enabled       bool
+	Namespace     string
+	LeaseName     string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+type ShardingConfig struct {
+	Enabled       bool
+	Namespace     string
+	Identity      string
+	LeaseDuration time.Duration
+	RenewInterval time.Duration
+}
+
+type OfflineConfig struct {
+	// Enabled verifies the license locally and publishes to SinkFile, so
+	// that the auditor works without access to the license and event
+	// receiver servers.
+	Enabled  bool
+	SinkFile string
+}
+
+type HashChainConfig struct {
+	// Path of the file the chain state is persisted in. Empty disables the
+	// hash chain.
+	Path string
+	ID   string
+}
+
+type EncryptionConfig struct {
+	// Policy selects the fields to encrypt. Nil disables encryption.
+	Policy *encryption.Policy
+	// KeyDir holds the key encryption keys, usually a mounted Secret.
+	KeyDir string
+	// KeyID is the name of the key file, without extension, that data keys
+	// are wrapped with.
+	KeyID string
+}
+
+type StatusConfig struct {
+	// Interval between updates of the AuditorStatus. Zero disables the
+	// status.
+	Interval  time.Duration
+	Namespace string
+	Name      string
+}
+
+type SiteInfoConfig struct {
+	// Enabled publishes the SiteInfo of the cluster, with node stats, the
+	// Kubernetes version, control plane certificates and the version of the
+	// auditor.
+	Enabled bool
+	// Interval between publications. The SiteInfo is also published when
+	// nodes are added, removed or resized.
+	Interval time.Duration
+}
+
+type SigningConfig struct {
+	// KeyDir holds the signing keys, usually a mounted Secret. Empty
+	// disables signing.
+	KeyDir string
+	// KeyID is the name of the key file, without extension, that events are
+	// signed with.
+	KeyID string
+}
+
 type config struct {
 	LicenseFile string
+	DryRun      bool
+	Offline     OfflineConfig
+	// Routing, if set, sends events to the named sinks of the matching
+	// routes instead of a single sink.
+	Routing *routing.Table
+	// SubjectTemplate, if set, renders the NATS subject of every event
+	// instead of using the subject assigned to the license.
+	SubjectTemplate *subject.Template
+
+	// ClusterLabels are added to every event as cloudevent extensions, next
+	// to the cluster metadata.
+	ClusterLabels map[string]string
 
 	Policy v1alpha1.AuditRegistration
 
+	EventStore store.Options
+
+	// MetadataOnly makes informers cache only object metadata. Full objects
+	// are fetched when an event is built.
+	MetadataOnly bool
+	// TrimFields are removed from objects before they are audited.
+	TrimFields [][]string
+	// Enrich adds the owner chain and workload context of objects to the
+	// published events.
+	Enrich bool
+
+	// PublishTimeout is how long the publish path may make no progress
+	// before the liveness check fails. Zero disables the check.
+	PublishTimeout time.Duration
+
+	Status   StatusConfig
+	SiteInfo SiteInfoConfig
+
+	Encryption EncryptionConfig
+	HashChain  HashChainConfig
+	Signing    SigningConfig
+
+	LeaderElection LeaderElectionConfig
+	Sharding       ShardingConfig
+
 	MaxNumRequeues int
 	NumThreads     int
 	ResyncPeriod   time.Duration
@@ -43,9 +160,14 @@ type config struct {
 type Config struct {
 	config
 
-	ClientConfig  *rest.Config
-	KubeClient    kubernetes.Interface
-	DynamicClient dynamic.Interface
+	ClientConfig   *rest.Config
+	KubeClient     kubernetes.Interface
+	DynamicClient  dynamic.Interface
+	MetadataClient metadata.Interface
+
+	// Connect, if set, connects to the sink that events are published to,
+	// instead of the event receiver of the license.
+	Connect func() (publisher.Sink, error)
 }
 
 func NewConfig(clientConfig *rest.Config) *Config {
@@ -59,17 +181,83 @@ func (c *Config) New() (*AuditorController, error) {
 		return nil, err
 	}
 
-	if c.LicenseFile == "" {
+	// dry runs publish nowhere, so they need no license
+	if c.LicenseFile == "" && c.Connect == nil && !c.DryRun {
 		return nil, errors.New("missing license file")
 	}
+	if c.Offline.Enabled && c.Offline.SinkFile == "" && c.Routing == nil && !c.DryRun {
+		return nil, errors.New("offline mode requires a sink file")
+	}
+	if c.SiteInfo.Enabled && c.SiteInfo.Interval <= 0 {
+		return nil, errors.New("site info requires a positive interval")
+	}
+	if c.Offline.Enabled && c.Routing != nil {
+		for _, s := range c.Routing.Sinks {
+			if s.NATS != nil {
+				return nil, fmt.Errorf("routing sink %q can't publish to NATS in offline mode", s.Name)
+			}
+		}
+	}
 
 	ctrl := &AuditorController{
-		config:                 c.config,
-		clientConfig:           c.ClientConfig,
-		kubeClient:             c.KubeClient,
-		dynamicClient:          c.DynamicClient,
-		dynamicInformerFactory: dynamicinformer.NewDynamicSharedInformerFactory(c.DynamicClient, c.ResyncPeriod),
-		recorder:               eventer.NewEventRecorder(c.KubeClient, "auditor"),
+		config:         c.config,
+		clientConfig:   c.ClientConfig,
+		kubeClient:     c.KubeClient,
+		dynamicClient:  c.DynamicClient,
+		metadataClient: c.MetadataClient,
+		connect:        c.Connect,
+		informers:      map[schema.GroupVersionResource]*resourceInformer{},
+	}
+	// dry runs don't write to the cluster, so pipeline events are only logged
+	if c.DryRun {
+		ctrl.recorder = eventer.NewLogRecorder()
+	} else {
+		ctrl.recorder = eventer.NewRecorder(c.KubeClient, "auditor")
+	}
+	if c.LeaderElection.Enabled && c.Sharding.Enabled {
+		return nil, errors.New("leader election and sharding can't be enabled together")
+	}
+	// dry runs start from the persisted state, but don't change it
+	newTracker := dedupe.NewTracker
+	if c.DryRun {
+		newTracker = dedupe.NewReadOnlyTracker
+	}
+	if c.LeaderElection.Enabled {
+		ctrl.tracker = newTracker(c.KubeClient, c.LeaderElection.Namespace)
+	} else if c.Sharding.Enabled {
+		ctrl.tracker = newTracker(c.KubeClient, c.Sharding.Namespace)
+	}
+	if c.Encryption.Policy != nil {
+		encrypter, err := encryption.NewEncrypter(c.Encryption.Policy, c.Encryption.KeyDir, c.Encryption.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		ctrl.encrypter = encrypter
+	}
+	// the local store and the live stream hold the same fields as published
+	// events, so they are encrypted alike
+	opts := c.EventStore
+	if ctrl.encrypter != nil {
+		ctrl.stream = stream.NewBroadcaster(ctrl.encrypter)
+		opts.Encrypter = ctrl.encrypter
+	} else {
+		ctrl.stream = stream.NewBroadcaster()
+	}
+	if c.Signing.KeyDir != "" {
+		signer, err := signing.NewSigner(c.Signing.KeyDir, c.Signing.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		ctrl.signer = signer
+	}
+	if c.EventStore.Path != "" && c.DryRun {
+		klog.InfoS("dry run, the event store is disabled", "path", c.EventStore.Path)
+	} else if c.EventStore.Path != "" {
+		s, err := store.Open(opts)
+		if err != nil {
+			return nil, err
+		}
+		ctrl.store = s
 	}
 	return ctrl, nil
 }
@@ -17,36 +17,144 @@ limitations under the License.
 package controller
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"time"
 
+	"kubeops.dev/auditor/pkg/chain"
+	"kubeops.dev/auditor/pkg/dedupe"
+	"kubeops.dev/auditor/pkg/encryption"
+	"kubeops.dev/auditor/pkg/eventer"
+	"kubeops.dev/auditor/pkg/publisher"
+	"kubeops.dev/auditor/pkg/signing"
+	"kubeops.dev/auditor/pkg/store"
+	"kubeops.dev/auditor/pkg/stream"
+
+	"go.bytebuilders.dev/audit/lib"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
+	disco_util "kmodules.xyz/client-go/discovery"
 )
 
+// connectRetryInterval is how often connecting to the sink is retried
+// until it succeeds.
+const connectRetryInterval = 10 * time.Second
+
 type AuditorController struct {
 	config
 	clientConfig *rest.Config
 
-	kubeClient    kubernetes.Interface
-	dynamicClient dynamic.Interface
-	recorder      record.EventRecorder
+	kubeClient     kubernetes.Interface
+	dynamicClient  dynamic.Interface
+	metadataClient metadata.Interface
+	recorder       *eventer.Recorder
+	publisher      *publisher.Publisher
+	tracker        *dedupe.Tracker
+	store          *store.Store
+	stream         *stream.Broadcaster
+	encrypter      *encryption.Encrypter
+	signer         *signing.Signer
+	chain          *chain.Chain
 
-	dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
+	// mapper and connect, if set, replace the discovery based resource
+	// mapper and the connection to the event receiver.
+	mapper  disco_util.ResourceMapper
+	connect func() (publisher.Sink, error)
+
+	mu          sync.RWMutex
+	createEvent lib.EventCreator
+	targets     map[schema.GroupVersionResource]schema.GroupVersionKind
+	informers   map[schema.GroupVersionResource]*resourceInformer
+	watching    bool
+	leading     bool
+	// siteInfoOwner is set if this replica publishes the SiteInfo of a
+	// sharded auditor.
+	siteInfoOwner bool
 }
 
+// Run runs the controller until stopCh is closed. If leader election is
+// enabled, it only runs while this replica holds the lease.
 func (c *AuditorController) Run(stopCh <-chan struct{}) {
+	// dry runs don't write the AuditorStatus
+	if c.Status.Interval > 0 && !c.DryRun {
+		go c.runStatus(stopCh)
+	}
+	if c.LeaderElection.Enabled {
+		c.runWithLeaderElection(stopCh)
+		return
+	}
+	c.run(stopCh)
+}
+
+func (c *AuditorController) run(stopCh <-chan struct{}) {
 	if err := c.initWatchers(); err != nil {
 		runtime.HandleError(err)
 		return
 	}
-	go c.RunInformers(stopCh)
+	// connect up front, so that a replica with nothing to publish becomes
+	// ready as well
+	go c.connectPublisher(stopCh)
+	if c.store != nil {
+		go c.store.Run(stopCh)
+	}
+	if c.tracker != nil {
+		go c.tracker.Run(stopCh)
+	}
+	if c.SiteInfo.Enabled {
+		go c.runSiteInfo(stopCh)
+	}
+	if c.Sharding.Enabled {
+		go c.runSharded(stopCh)
+	} else {
+		go c.RunInformers(stopCh)
+	}
 
 	<-stopCh
+	if err := c.publisher.Close(); err != nil {
+		klog.ErrorS(err, "failed to close event publisher")
+	}
+	if c.chain != nil {
+		if err := c.chain.Close(); err != nil {
+			klog.ErrorS(err, "failed to persist hash chain state")
+		}
+	}
+	if c.tracker != nil {
+		if err := c.tracker.Flush(context.TODO()); err != nil {
+			klog.ErrorS(err, "failed to persist dedupe state")
+		}
+	}
+}
+
+// connectPublisher connects the publisher to its sink, retrying until it
+// succeeds or stopCh is closed.
+func (c *AuditorController) connectPublisher(stopCh <-chan struct{}) {
+	_ = wait.PollImmediateUntil(connectRetryInterval, func() (bool, error) {
+		return c.publisher.Connect(), nil
+	}, stopCh)
+}
+
+// Store returns the local event store, or nil if it is disabled.
+func (c *AuditorController) Store() *store.Store {
+	return c.store
+}
+
+// Stream returns the broadcaster of live audit events.
+func (c *AuditorController) Stream() *stream.Broadcaster {
+	return c.stream
+}
+
+// Signer returns the event signer, or nil if signing is disabled.
+func (c *AuditorController) Signer() *signing.Signer {
+	return c.signer
 }
 
 func (c *AuditorController) RunInformers(stopCh <-chan struct{}) {
@@ -54,14 +162,22 @@ func (c *AuditorController) RunInformers(stopCh <-chan struct{}) {
 
 	klog.Info("Starting Auditor")
 
-	c.dynamicInformerFactory.Start(stopCh)
-	for _, v := range c.dynamicInformerFactory.WaitForCacheSync(stopCh) {
-		if !v {
-			runtime.HandleError(fmt.Errorf("timed out waiting for caches to sync"))
-			return
+	c.mu.RLock()
+	targets := c.targets
+	c.mu.RUnlock()
+	for gvr, gvk := range targets {
+		if err := c.startWatching(gvr, gvk); err != nil {
+			runtime.HandleError(err)
+			c.recorder.Eventf(core.EventTypeWarning, eventer.EventReasonWatchFailed, "Failed to watch %s: %v", gvr, err)
 		}
 	}
+	if cache.WaitForCacheSync(stopCh, c.hasSynced) {
+		c.recorder.Eventf(core.EventTypeNormal, eventer.EventReasonWatchStarted, "Watching %d resources", len(targets))
+	} else {
+		runtime.HandleError(fmt.Errorf("timed out waiting for caches to sync"))
+	}
 
 	<-stopCh
+	c.stopWatchingAll()
 	klog.Info("Stopping Auditor")
 }
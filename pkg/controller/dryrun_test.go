@@ -0,0 +1,76 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestDryRunMakesNoWrites(t *testing.T) {
+	h := newHarness(t, newConfigMap("cm", "uid-1", 1, map[string]interface{}{"key": "value"}))
+	kubeClient := kubefake.NewSimpleClientset(&core.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: testClusterUID},
+	})
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.25.0"}
+
+	cfg := &Config{KubeClient: kubeClient, DynamicClient: h.client}
+	cfg.DryRun = true
+	cfg.Policy = h.ctrl.Policy
+	cfg.EventStore.Path = filepath.Join(t.TempDir(), "events.db")
+	cfg.Status = StatusConfig{Interval: 10 * time.Millisecond, Namespace: metav1.NamespaceSystem, Name: "auditor-0"}
+	ctrl, err := cfg.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrl.mapper = h.ctrl.mapper
+
+	stopCh := make(chan struct{})
+	go ctrl.Run(stopCh)
+	select {
+	case <-h.watching:
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for the informers to watch")
+	}
+	if !cache.WaitForCacheSync(stopCh, ctrl.hasSynced) {
+		t.Fatal("timed out waiting for caches to sync")
+	}
+	// gives the status and the publisher time to write, if they did
+	time.Sleep(100 * time.Millisecond)
+	close(stopCh)
+
+	if _, err := os.Stat(cfg.EventStore.Path); !os.IsNotExist(err) {
+		t.Errorf("dry run created the event store: %v", err)
+	}
+	actions := append(kubeClient.Actions(), h.client.Actions()...)
+	for _, action := range actions {
+		switch action.GetVerb() {
+		case "get", "list", "watch":
+		default:
+			t.Errorf("dry run made a %s of %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
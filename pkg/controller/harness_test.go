@@ -0,0 +1,214 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+	"kubeops.dev/auditor/pkg/publisher"
+	"kubeops.dev/auditor/pkg/stream"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"go.bytebuilders.dev/audit/lib"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	disco_util "kmodules.xyz/client-go/discovery"
+	"kmodules.xyz/custom-resources/apis/auditor/v1alpha1"
+)
+
+const (
+	testLicenseID  = "test-license"
+	testClusterUID = "test-cluster"
+	testSubject    = "auditor.test.events"
+	testTimeout    = 10 * time.Second
+)
+
+var (
+	configMapGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	configMapGVK = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+)
+
+// harness runs the publish path of an AuditorController against a fake
+// dynamic client and an embedded NATS server, and collects the cloudevents
+// received on the license subject.
+type harness struct {
+	t        *testing.T
+	client   *dynamicfake.FakeDynamicClient
+	ctrl     *AuditorController
+	events   chan []byte
+	watching chan struct{}
+}
+
+// newHarness returns a harness auditing configmaps. The objects are in the
+// cluster before the controller starts.
+func newHarness(t *testing.T, objects ...runtime.Object) *harness {
+	t.Helper()
+
+	srv := runNatsServer(t)
+	sub, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sub.Close)
+
+	h := &harness{
+		t:        t,
+		events:   make(chan []byte, 100),
+		watching: make(chan struct{}),
+	}
+	// NatsSink sends events as requests, so the receiver has to acknowledge
+	// every one of them
+	if _, err := sub.Subscribe(testSubject, func(msg *nats.Msg) {
+		h.events <- msg.Data
+		_ = msg.Respond(nil)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	h.client = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		configMapGVR: "ConfigMapList",
+	}, objects...)
+	// the fake client drops changes made between the initial list and the
+	// watch, so changes are only made once the watch is set up
+	var once sync.Once
+	h.client.PrependWatchReactor(configMapGVR.Resource, func(action clienttesting.Action) (bool, watch.Interface, error) {
+		w, err := h.client.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		once.Do(func() { close(h.watching) })
+		return true, w, err
+	})
+
+	restMapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{configMapGVK.GroupVersion()})
+	restMapper.Add(configMapGVK, meta.RESTScopeNamespace)
+
+	h.ctrl = &AuditorController{
+		kubeClient: kubefake.NewSimpleClientset(&core.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: testClusterUID},
+		}),
+		dynamicClient: h.client,
+		stream:        stream.NewBroadcaster(),
+		informers:     map[schema.GroupVersionResource]*resourceInformer{},
+		mapper:        disco_util.NewResourceMapper(restMapper),
+		connect: func() (publisher.Sink, error) {
+			nc, err := nats.Connect(srv.ClientURL())
+			if err != nil {
+				return nil, err
+			}
+			return publisher.NewNatsSink(&lib.NatsConfig{
+				LicenseID: testLicenseID,
+				Subject:   testSubject,
+				Server:    srv.ClientURL(),
+				Client:    nc,
+			}), nil
+		},
+	}
+	h.ctrl.Policy.Resources = []v1alpha1.GroupResources{
+		{Group: configMapGVR.Group, Resources: []string{configMapGVR.Resource}},
+	}
+	return h
+}
+
+func runNatsServer(t *testing.T) *server.Server {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{
+		Host:   "127.0.0.1",
+		Port:   server.RANDOM_PORT,
+		NoLog:  true,
+		NoSigs: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(testTimeout) {
+		t.Fatal("nats server is not ready for connections")
+	}
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+// start initializes the watchers and runs the informers until the test
+// ends. It returns once the informers are synced and watching.
+func (h *harness) start() {
+	h.t.Helper()
+	if err := h.ctrl.initWatchers(); err != nil {
+		h.t.Fatal(err)
+	}
+
+	stopCh := make(chan struct{})
+	h.t.Cleanup(func() {
+		close(stopCh)
+		_ = h.ctrl.publisher.Close()
+	})
+	go h.ctrl.RunInformers(stopCh)
+
+	select {
+	case <-h.watching:
+	case <-time.After(testTimeout):
+		h.t.Fatal("timed out waiting for the informers to watch")
+	}
+	if !cache.WaitForCacheSync(stopCh, h.ctrl.hasSynced) {
+		h.t.Fatal("timed out waiting for caches to sync")
+	}
+}
+
+// handler returns a publishing event handler of configmaps, as registered
+// with the informer.
+func (h *harness) handler() cache.ResourceEventHandler {
+	return h.ctrl.publisher.ForGVK(configMapGVK, h.ctrl.createEvent)
+}
+
+// next returns the next cloudevent received by the event receiver.
+func (h *harness) next() (*cloudevents.Event, *cloudevent.Payload) {
+	h.t.Helper()
+	select {
+	case data := <-h.events:
+		event, payload, err := cloudevent.Decode(data)
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		return event, payload
+	case <-time.After(testTimeout):
+		h.t.Fatal("timed out waiting for an event")
+	}
+	return nil, nil
+}
+
+// expectNone fails the test if an event is received within wait.
+func (h *harness) expectNone(wait time.Duration) {
+	h.t.Helper()
+	select {
+	case data := <-h.events:
+		h.t.Fatalf("unexpected event %s", data)
+	case <-time.After(wait):
+	}
+}
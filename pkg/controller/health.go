@@ -0,0 +1,109 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apiserver/pkg/server/healthz"
+)
+
+// ReadyzChecks returns the checks that keep the auditor from being marked
+// ready until every informer has synced and the sink has connected once.
+// Replicas waiting to become the leader are always ready, since they keep
+// serving the api.
+func (c *AuditorController) ReadyzChecks() []healthz.HealthChecker {
+	return []healthz.HealthChecker{
+		healthz.NamedCheck("informer-sync", c.checkInformersSynced),
+		healthz.NamedCheck("sink-connected", c.checkSinkConnected),
+	}
+}
+
+// LivezChecks returns the checks that fail when the publish path is stuck.
+func (c *AuditorController) LivezChecks() []healthz.HealthChecker {
+	return []healthz.HealthChecker{
+		healthz.NamedCheck("publish", c.checkPublishing),
+	}
+}
+
+func (c *AuditorController) checkInformersSynced(_ *http.Request) error {
+	if c.standby() {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.watching {
+		return fmt.Errorf("watchers are not initialized")
+	}
+	var pending []string
+	for gvr, informer := range c.informers {
+		if !informer.HasSynced() {
+			pending = append(pending, gvr.String())
+		}
+	}
+	if len(pending) > 0 {
+		sort.Strings(pending)
+		return fmt.Errorf("informers not synced:\n  %s", strings.Join(pending, "\n  "))
+	}
+	return nil
+}
+
+func (c *AuditorController) checkSinkConnected(_ *http.Request) error {
+	if c.standby() {
+		return nil
+	}
+	c.mu.RLock()
+	p := c.publisher
+	c.mu.RUnlock()
+
+	if p == nil {
+		return fmt.Errorf("sink has not connected yet")
+	}
+	// a shard that owns no resources has nothing to publish
+	if c.Sharding.Enabled && !c.owning() {
+		return nil
+	}
+	if !p.Connected() {
+		return fmt.Errorf("sink has not connected yet")
+	}
+	return nil
+}
+
+func (c *AuditorController) checkPublishing(_ *http.Request) error {
+	c.mu.RLock()
+	p := c.publisher
+	c.mu.RUnlock()
+
+	if p == nil || c.PublishTimeout <= 0 {
+		return nil
+	}
+	if stalled, d := p.Stalled(c.PublishTimeout); stalled {
+		return fmt.Errorf("no audit event was published for %s", d.Round(time.Second))
+	}
+	return nil
+}
+
+func (c *AuditorController) owning() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.informers) > 0
+}
@@ -0,0 +1,43 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadyWithoutEvents(t *testing.T) {
+	// no objects match the policy, so nothing is ever published
+	h := newHarness(t)
+	h.start()
+	if err := h.ctrl.checkSinkConnected(nil); err == nil {
+		t.Fatal("sink is connected before connecting")
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go h.ctrl.connectPublisher(stopCh)
+
+	deadline := time.Now().Add(testTimeout)
+	for h.ctrl.checkSinkConnected(nil) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("sink never connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,249 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"kubeops.dev/auditor/pkg/dedupe"
+	"kubeops.dev/auditor/pkg/enrich"
+	"kubeops.dev/auditor/pkg/eventer"
+	"kubeops.dev/auditor/pkg/metrics"
+	"kubeops.dev/auditor/pkg/objects"
+	"kubeops.dev/auditor/pkg/pipeline"
+	"kubeops.dev/auditor/pkg/publisher"
+
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+const watchFailedInterval = 10 * time.Minute
+
+// resourceInformer is the informer of one audited resource. Every resource
+// has its own informer so that it can be stopped on its own when the
+// resource moves to another shard.
+type resourceInformer struct {
+	cache.SharedIndexInformer
+	stop chan struct{}
+}
+
+func (c *AuditorController) startWatching(gvr schema.GroupVersionResource, gvk schema.GroupVersionKind) error {
+	if c.isWatching(gvr) {
+		return nil
+	}
+	// resume from the state persisted by the previous owner of the resource
+	if c.tracker != nil {
+		if err := c.tracker.Load(context.TODO(), trackerKey(gvr)); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.informers[gvr]; ok {
+		return nil
+	}
+
+	klog.Infoln("watching", gvr)
+	metrics.InformerSynced.WithLabelValues(metrics.ResourceLabels(gvr)...).Set(0)
+
+	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	createEvent := objects.TrimmingEventCreator(c.TrimFields, c.createEvent)
+	var informer cache.SharedIndexInformer
+	var publish cache.ResourceEventHandler
+	if c.MetadataOnly {
+		// cache only the metadata, and fetch the full object for events
+		informer = metadatainformer.NewFilteredMetadataInformer(c.metadataClient, gvr, metav1.NamespaceAll, c.ResyncPeriod, indexers, nil).Informer()
+		var trim cache.TransformFunc = objects.TrimMetadata
+		if c.Enrich {
+			// owners are enriched from the cached metadata
+			trim = objects.MetadataTrimmer(enrich.Annotations...)
+		}
+		if err := informer.SetTransform(trim); err != nil {
+			return err
+		}
+		// the publisher fetches only the objects of events it publishes,
+		// and hands them to the stream and store
+		consumers := []pipeline.Consumer{c.stream.Broadcast}
+		if c.store != nil {
+			consumers = append(consumers, c.store.Record)
+		}
+		fetcher := objects.NewFetcher(c.dynamicClient, gvr)
+		publish = c.publisher.ForMetadataGVK(gvk, createEvent, publisher.Tee(fetcher.Resolver(createEvent), consumers...))
+	} else {
+		informer = dynamicinformer.NewFilteredDynamicInformer(c.dynamicClient, gvr, metav1.NamespaceAll, c.ResyncPeriod, indexers, nil).Informer()
+		publish = c.publisher.ForGVK(gvk, createEvent)
+	}
+	if err := informer.SetWatchErrorHandler(c.watchErrorHandler(gvr)); err != nil {
+		return err
+	}
+	informer.AddEventHandler(publish)
+	if !c.MetadataOnly {
+		informer.AddEventHandler(c.stream.ForGVK(gvk, createEvent))
+		if c.store != nil {
+			informer.AddEventHandler(c.store.ForGVK(gvk, createEvent))
+		}
+	}
+
+	ri := &resourceInformer{
+		SharedIndexInformer: informer,
+		stop:                make(chan struct{}),
+	}
+	c.informers[gvr] = ri
+	go ri.Run(ri.stop)
+	go func() {
+		if cache.WaitForCacheSync(ri.stop, ri.HasSynced) {
+			metrics.InformerSynced.WithLabelValues(metrics.ResourceLabels(gvr)...).Set(1)
+			if c.tracker != nil {
+				c.pruneTracker(gvr, ri)
+			}
+		}
+	}()
+	return nil
+}
+
+// pruneTracker forgets the tracked objects of a resource that are not in
+// the synced cache, because they were deleted while no replica watched
+// them.
+func (c *AuditorController) pruneTracker(gvr schema.GroupVersionResource, informer cache.SharedIndexInformer) {
+	live := map[types.UID]bool{}
+	for _, obj := range informer.GetStore().List() {
+		if m, err := meta.Accessor(obj); err == nil {
+			live[m.GetUID()] = true
+		}
+	}
+	if pruned := c.tracker.Retain(trackerKey(gvr), live); pruned > 0 {
+		klog.V(3).InfoS("pruned dedupe state", "resource", gvr, "objects", pruned)
+	}
+}
+
+// watchErrorHandler reports watch failures of a resource as events, at most
+// once per watchFailedInterval. Watches that are closed or expire are
+// restarted by the informer and are not reported.
+func (c *AuditorController) watchErrorHandler(gvr schema.GroupVersionResource) cache.WatchErrorHandler {
+	var last time.Time
+	return func(r *cache.Reflector, err error) {
+		cache.DefaultWatchErrorHandler(r, err)
+		if err == io.EOF || err == io.ErrUnexpectedEOF || apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+			return
+		}
+		if time.Since(last) < watchFailedInterval {
+			return
+		}
+		last = time.Now()
+		c.recorder.Eventf(core.EventTypeWarning, eventer.EventReasonWatchFailed, "Failed to watch %s: %v", gvr, err)
+	}
+}
+
+// stopWatching stops the informer of a resource and hands its dedupe state
+// over to the next owner.
+func (c *AuditorController) stopWatching(gvr schema.GroupVersionResource) {
+	c.mu.Lock()
+	stopped := c.stopInformer(gvr)
+	c.mu.Unlock()
+
+	if stopped && c.tracker != nil {
+		if err := c.tracker.Flush(context.TODO()); err != nil {
+			klog.ErrorS(err, "failed to persist dedupe state")
+		}
+		c.tracker.Forget(trackerKey(gvr))
+	}
+}
+
+func (c *AuditorController) stopWatchingAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for gvr := range c.informers {
+		c.stopInformer(gvr)
+	}
+}
+
+// stopInformer must be called with c.mu held.
+func (c *AuditorController) stopInformer(gvr schema.GroupVersionResource) bool {
+	ri, ok := c.informers[gvr]
+	if !ok {
+		return false
+	}
+	klog.Infoln("stopped watching", gvr)
+	close(ri.stop)
+	delete(c.informers, gvr)
+	// unregistered vectors can't delete, eg. when the controller runs
+	// without the api server
+	if metrics.InformerSynced.IsCreated() {
+		metrics.InformerSynced.DeleteLabelValues(metrics.ResourceLabels(gvr)...)
+	}
+	return true
+}
+
+func (c *AuditorController) isWatching(gvr schema.GroupVersionResource) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.informers[gvr]
+	return ok
+}
+
+// cachedObject finds an object in the informer of its resource, whatever
+// version of the resource is watched.
+func (c *AuditorController) cachedObject(gr schema.GroupResource, namespace, name string) (metav1.Object, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for gvr, ri := range c.informers {
+		if gvr.GroupResource() != gr {
+			continue
+		}
+		key := name
+		if namespace != "" {
+			key = namespace + "/" + name
+		}
+		obj, exists, err := ri.GetIndexer().GetByKey(key)
+		if err != nil || !exists {
+			return nil, false
+		}
+		o, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, false
+		}
+		return o, true
+	}
+	return nil, false
+}
+
+func (c *AuditorController) hasSynced() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, ri := range c.informers {
+		if !ri.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func trackerKey(gvr schema.GroupVersionResource) string {
+	return dedupe.Key(kmapi.ResourceID{Group: gvr.Group, Name: gvr.Resource})
+}
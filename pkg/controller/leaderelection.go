@@ -0,0 +1,122 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"os"
+
+	"github.com/google/uuid"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+// runWithLeaderElection runs the controller while this replica holds the
+// lease. On shutdown, the controller is stopped and its dedupe state is
+// persisted before the lease is released, so the next leader can take over
+// right away without republishing objects.
+func (c *AuditorController) runWithLeaderElection(stopCh <-chan struct{}) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		klog.Fatalf("failed to get hostname: %v", err)
+	}
+	id := hostname + "_" + uuid.New().String()
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      c.LeaderElection.LeaseName,
+			Namespace: c.LeaderElection.Namespace,
+		},
+		Client: c.kubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: id,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		<-stopCh
+		select {
+		case <-started:
+			<-finished
+		default:
+		}
+		cancel()
+	}()
+
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   c.LeaderElection.LeaseDuration,
+		RenewDeadline:   c.LeaderElection.RenewDeadline,
+		RetryPeriod:     c.LeaderElection.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            c.LeaderElection.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				close(started)
+				defer close(finished)
+
+				klog.InfoS("started leading", "identity", id)
+				c.setLeading(true)
+
+				stop := make(chan struct{})
+				go func() {
+					select {
+					case <-stopCh:
+					case <-ctx.Done():
+					}
+					close(stop)
+				}()
+				c.run(stop)
+			},
+			OnStoppedLeading: func() {
+				c.setLeading(false)
+				select {
+				case <-stopCh:
+					klog.InfoS("released leadership", "identity", id)
+				default:
+					// informers can't be restarted, so start over as a follower
+					klog.Fatalf("leader election lost: %s", id)
+				}
+			},
+			OnNewLeader: func(identity string) {
+				if identity != id {
+					klog.InfoS("new leader elected", "identity", identity)
+				}
+			},
+		},
+	})
+}
+
+func (c *AuditorController) setLeading(leading bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.leading = leading
+}
+
+// standby reports whether this replica is waiting to become the leader.
+func (c *AuditorController) standby() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.LeaderElection.Enabled && !c.leading
+}
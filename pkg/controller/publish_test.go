@@ -0,0 +1,182 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	api "go.bytebuilders.dev/audit/api/v1"
+	"go.bytebuilders.dev/license-verifier/info"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// quiet is how long tests wait to make sure no event is published.
+const quiet = 500 * time.Millisecond
+
+func newConfigMap(name string, uid types.UID, generation int64, data map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":       name,
+			"namespace":  metav1.NamespaceDefault,
+			"uid":        string(uid),
+			"generation": generation,
+			"managedFields": []interface{}{
+				map[string]interface{}{"manager": "kubectl", "operation": "Update"},
+			},
+		},
+		"data": data,
+	}}
+	return u
+}
+
+// expectEvent checks that a cloudevent is the audit event of type et for obj,
+// published on behalf of the test license from the test cluster.
+func expectEvent(t *testing.T, event *cloudevents.Event, payload *cloudevent.Payload, et api.EventType, obj *unstructured.Unstructured) {
+	t.Helper()
+
+	if got := event.Type(); got != string(et) {
+		t.Errorf("type = %s, want %s", got, et)
+	}
+	if got, want := event.ID(), fmt.Sprintf("%s.%d", obj.GetUID(), obj.GetGeneration()); got != want {
+		t.Errorf("id = %s, want %s", got, want)
+	}
+	if got, want := event.Source(), fmt.Sprintf("/byte.builders/auditor/%s/feature/%s//configmaps", testLicenseID, info.ProductName); got != want {
+		t.Errorf("source = %s, want %s", got, want)
+	}
+	if got := event.Subject(); got != string(obj.GetUID()) {
+		t.Errorf("subject = %s, want %s", got, obj.GetUID())
+	}
+	if got := event.DataContentType(); got != cloudevents.ApplicationJSON {
+		t.Errorf("datacontenttype = %s, want %s", got, cloudevents.ApplicationJSON)
+	}
+	if got := event.Extensions()[cloudevent.ExtClusterUID]; got != testClusterUID {
+		t.Errorf("%s = %v, want %s", cloudevent.ExtClusterUID, got, testClusterUID)
+	}
+
+	if payload.LicenseID != testLicenseID {
+		t.Errorf("licenseID = %s, want %s", payload.LicenseID, testLicenseID)
+	}
+	wantID := kmapi.ResourceID{
+		Version: "v1",
+		Name:    "configmaps",
+		Kind:    "ConfigMap",
+		Scope:   kmapi.NamespaceScoped,
+	}
+	if payload.ResourceID != wantID {
+		t.Errorf("resourceID = %+v, want %+v", payload.ResourceID, wantID)
+	}
+	want := obj.DeepCopy()
+	want.SetManagedFields(nil)
+	got := payload.Resource.DeepCopy()
+	// set by the fake client
+	unstructured.RemoveNestedField(got.Object, "metadata", "resourceVersion")
+	if !reflect.DeepEqual(got.Object, want.Object) {
+		t.Errorf("resource = %v, want %v", got.Object, want.Object)
+	}
+}
+
+func TestPublishCreate(t *testing.T) {
+	existing := newConfigMap("existing", "uid-existing", 1, map[string]interface{}{"k": "v"})
+	h := newHarness(t, existing)
+	h.start()
+
+	event, payload := h.next()
+	expectEvent(t, event, payload, api.EventCreated, existing)
+
+	created := newConfigMap("created", "uid-created", 1, map[string]interface{}{"k": "v"})
+	if _, err := h.client.Resource(configMapGVR).Namespace(created.GetNamespace()).Create(context.TODO(), created, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	event, payload = h.next()
+	expectEvent(t, event, payload, api.EventCreated, created)
+	h.expectNone(quiet)
+}
+
+func TestPublishUpdate(t *testing.T) {
+	obj := newConfigMap("cm", "uid-cm", 1, map[string]interface{}{"k": "v1"})
+	h := newHarness(t, obj)
+	h.start()
+
+	event, payload := h.next()
+	expectEvent(t, event, payload, api.EventCreated, obj)
+
+	// updates that don't change the generation are not audited
+	client := h.client.Resource(configMapGVR).Namespace(obj.GetNamespace())
+	obj.Object["data"] = map[string]interface{}{"k": "v2"}
+	if _, err := client.Update(context.TODO(), obj, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	h.expectNone(quiet)
+
+	// the fake client doesn't bump the generation
+	obj.Object["data"] = map[string]interface{}{"k": "v3"}
+	obj.SetGeneration(2)
+	if _, err := client.Update(context.TODO(), obj, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	event, payload = h.next()
+	expectEvent(t, event, payload, api.EventUpdated, obj)
+	h.expectNone(quiet)
+}
+
+func TestPublishDelete(t *testing.T) {
+	obj := newConfigMap("cm", "uid-cm", 1, map[string]interface{}{"k": "v"})
+	h := newHarness(t, obj)
+	h.start()
+
+	event, payload := h.next()
+	expectEvent(t, event, payload, api.EventCreated, obj)
+
+	if err := h.client.Resource(configMapGVR).Namespace(obj.GetNamespace()).Delete(context.TODO(), obj.GetName(), metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	event, payload = h.next()
+	expectEvent(t, event, payload, api.EventDeleted, obj)
+	h.expectNone(quiet)
+}
+
+func TestPublishTombstone(t *testing.T) {
+	h := newHarness(t)
+	h.start()
+
+	// the informer hands over a tombstone when it missed the delete of an
+	// object, eg. while the watch was down
+	obj := newConfigMap("cm", "uid-cm", 3, map[string]interface{}{"k": "v"})
+	h.handler().OnDelete(cache.DeletedFinalStateUnknown{
+		Key: obj.GetNamespace() + "/" + obj.GetName(),
+		Obj: obj,
+	})
+	event, payload := h.next()
+	expectEvent(t, event, payload, api.EventDeleted, obj)
+
+	// tombstones of unknown types are ignored
+	h.handler().OnDelete(cache.DeletedFinalStateUnknown{Key: "default/unknown", Obj: "unknown"})
+	h.expectNone(quiet)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"kubeops.dev/auditor/pkg/publisher"
+	"kubeops.dev/auditor/pkg/routing"
+)
+
+// openRoutes opens every sink of the routing table and returns them as a
+// mux. The sinks that were opened are closed if any of them fails.
+func openRoutes(table *routing.Table, open func(s routing.Sink) (publisher.Sink, error)) (publisher.Sink, error) {
+	sinks := make(map[string]publisher.Sink, len(table.Sinks))
+	for _, s := range table.Sinks {
+		sink, err := open(s)
+		if err != nil {
+			_ = publisher.NewMux(sinks).Close()
+			return nil, err
+		}
+		sinks[s.Name] = sink
+	}
+	return publisher.NewMux(sinks), nil
+}
+
+// shareRoutes returns a mux where every sink of the routing table is the
+// given sink, so that only routed events are published.
+func shareRoutes(table *routing.Table, sink publisher.Sink) publisher.Sink {
+	sinks := make(map[string]publisher.Sink, len(table.Sinks))
+	for _, s := range table.Sinks {
+		sinks[s.Name] = sink
+	}
+	return publisher.NewMux(sinks)
+}
+
+// openOTLP returns the sink of an otlp routing sink, exporting logs on
+// behalf of the given resource.
+func openOTLP(s *routing.OTLPSink, resource map[string]string) (publisher.Sink, error) {
+	return publisher.NewOTLPSink(publisher.OTLPOptions{
+		Endpoint: s.Endpoint,
+		Protocol: s.Protocol,
+		Insecure: s.Insecure,
+		Headers:  s.Headers,
+		Resource: resource,
+	})
+}
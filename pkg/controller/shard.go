@@ -0,0 +1,132 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"kubeops.dev/auditor/pkg/eventer"
+	"kubeops.dev/auditor/pkg/shard"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// runSharded watches the share of the audited resources assigned to this
+// replica, and rebalances whenever replicas join or leave.
+func (c *AuditorController) runSharded(stopCh <-chan struct{}) {
+	m := shard.NewMembership(c.kubeClient, c.Sharding.Namespace, c.Sharding.Identity, c.Sharding.LeaseDuration)
+
+	var members []string
+	wait.Until(func() {
+		ctx := context.TODO()
+		view, err := m.View(ctx)
+		if err != nil {
+			klog.ErrorS(err, "failed to list shard members")
+		} else {
+			if !equalMembers(members, view.Members) {
+				klog.InfoS("shard members changed", "members", view.Members)
+			}
+			members = view.Members
+			c.rebalance(m.Identity(), view)
+			c.setSiteInfoOwner(shard.Owner(members, siteInfoShardKey) == m.Identity())
+		}
+		// claim the resources this replica watches, which releases the
+		// ones it stopped watching to their new owners
+		if err := m.Renew(ctx, c.watchedResources()); err != nil {
+			klog.ErrorS(err, "failed to renew shard membership")
+		}
+	}, c.Sharding.RenewInterval, stopCh)
+
+	c.stopWatchingAll()
+	if c.tracker != nil {
+		if err := c.tracker.Flush(context.TODO()); err != nil {
+			klog.ErrorS(err, "failed to persist dedupe state")
+		}
+	}
+	if err := m.Leave(context.TODO()); err != nil {
+		klog.ErrorS(err, "failed to leave shard")
+	}
+}
+
+// rebalance starts and stops informers so that this replica watches the
+// resources it owns. Resources are handed over explicitly: a resource that
+// another replica still claims is only picked up once that replica stopped
+// watching it and released it.
+func (c *AuditorController) rebalance(identity string, view *shard.View) {
+	c.mu.RLock()
+	targets := make(map[string]schema.GroupVersionResource, len(c.targets))
+	kinds := make(map[schema.GroupVersionResource]schema.GroupVersionKind, len(c.targets))
+	for gvr, gvk := range c.targets {
+		targets[gvr.GroupResource().String()] = gvr
+		kinds[gvr] = gvk
+	}
+	c.mu.RUnlock()
+
+	resources := make([]string, 0, len(targets))
+	watching := map[string]bool{}
+	for r, gvr := range targets {
+		resources = append(resources, r)
+		watching[r] = c.isWatching(gvr)
+	}
+	plan := shard.Assign(identity, view, resources, watching)
+
+	for _, r := range plan.Stop {
+		c.stopWatching(targets[r])
+	}
+	for _, r := range plan.Waiting {
+		klog.V(3).InfoS("waiting for the handover of resource", "resource", r, "owner", view.Claims[r])
+	}
+	started := 0
+	for _, r := range plan.Start {
+		gvr := targets[r]
+		if err := c.startWatching(gvr, kinds[gvr]); err != nil {
+			klog.ErrorS(err, "failed to start watching", "resource", gvr)
+			c.recorder.Eventf(core.EventTypeWarning, eventer.EventReasonWatchFailed, "Failed to watch %s: %v", gvr, err)
+			continue
+		}
+		started++
+	}
+	if started > 0 {
+		c.recorder.Eventf(core.EventTypeNormal, eventer.EventReasonWatchStarted, "Started watching %d resources assigned to shard %s", started, identity)
+	}
+}
+
+// watchedResources returns the resources this replica watches.
+func (c *AuditorController) watchedResources() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	resources := make([]string, 0, len(c.informers))
+	for gvr := range c.informers {
+		resources = append(resources, gvr.GroupResource().String())
+	}
+	return resources
+}
+
+func equalMembers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	auditorapi "kmodules.xyz/custom-resources/apis/auditor/v1alpha1"
+	"kmodules.xyz/custom-resources/util/siteinfo"
+)
+
+var (
+	// siteInfoShardKey assigns the SiteInfo to one replica of a shard, like
+	// an audited resource.
+	siteInfoShardKey = schema.GroupResource{
+		Group:    auditorapi.SchemeGroupVersion.Group,
+		Resource: auditorapi.ResourceSiteInfos,
+	}.String()
+
+	siteInfoResourceID = kmapi.ResourceID{
+		Group:   auditorapi.SchemeGroupVersion.Group,
+		Version: auditorapi.SchemeGroupVersion.Version,
+		Name:    auditorapi.ResourceSiteInfos,
+		Kind:    auditorapi.ResourceKindSiteInfo,
+		Scope:   kmapi.ClusterScoped,
+	}
+)
+
+// runSiteInfo publishes the SiteInfo of the cluster every interval, and
+// whenever nodes are added, removed or change their capacity.
+func (c *AuditorController) runSiteInfo(stopCh <-chan struct{}) {
+	defer runtime.HandleCrash()
+
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	informer := coreinformers.NewNodeInformer(c.kubeClient, 0, cache.Indexers{})
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { notify() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			o, ok1 := oldObj.(*core.Node)
+			n, ok2 := newObj.(*core.Node)
+			if !ok1 || !ok2 ||
+				!equality.Semantic.DeepEqual(o.Status.Capacity, n.Status.Capacity) ||
+				!equality.Semantic.DeepEqual(o.Status.Allocatable, n.Status.Allocatable) {
+				notify()
+			}
+		},
+		DeleteFunc: func(interface{}) { notify() },
+	})
+	go informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		return
+	}
+
+	ticker := time.NewTicker(c.SiteInfo.Interval)
+	defer ticker.Stop()
+	notify()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-changed:
+		case <-ticker.C:
+		}
+		if !c.ownsSiteInfo() {
+			continue
+		}
+		if err := c.publishSiteInfo(informer.GetStore().List()); err != nil {
+			klog.ErrorS(err, "failed to publish site info")
+		}
+	}
+}
+
+func (c *AuditorController) publishSiteInfo(objs []interface{}) error {
+	nodes := make([]*core.Node, 0, len(objs))
+	for _, obj := range objs {
+		if node, ok := obj.(*core.Node); ok {
+			nodes = append(nodes, node)
+		}
+	}
+
+	lid := c.publisher.LicenseID()
+	// includes the version of the auditor
+	si, err := siteinfo.GetSiteInfo(c.clientConfig, c.kubeClient, nodes, lid)
+	if err != nil {
+		return err
+	}
+	if si.Product == nil {
+		si.Product = new(auditorapi.ProductInfo)
+	}
+	si.Name = fmt.Sprintf("%s.%s", lid, si.Product.ProductName)
+
+	return c.publisher.Publish(&api.Event{
+		ResourceID: siteInfoResourceID,
+		Resource:   si,
+	}, api.EventUpdated)
+}
+
+// ownsSiteInfo reports whether this replica publishes the SiteInfo. Only
+// one replica of a shard does.
+func (c *AuditorController) ownsSiteInfo() bool {
+	if !c.Sharding.Enabled {
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.siteInfoOwner
+}
+
+func (c *AuditorController) setSiteInfoOwner(owner bool) {
+	c.mu.Lock()
+	c.siteInfoOwner = owner
+	c.mu.Unlock()
+}
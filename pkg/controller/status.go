@@ -0,0 +1,227 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"kubeops.dev/auditor/apis/auditor/v1alpha1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+var auditorStatusGVR = v1alpha1.SchemeGroupVersion.WithResource(v1alpha1.ResourceAuditorStatuses)
+
+// runStatus keeps the AuditorStatus of this replica up to date until stopCh
+// is closed.
+func (c *AuditorController) runStatus(stopCh <-chan struct{}) {
+	warned := false
+	wait.Until(func() {
+		err := c.updateStatus(context.TODO())
+		if err == nil {
+			warned = false
+			return
+		}
+		if !warned {
+			klog.ErrorS(err, "failed to update auditor status", "namespace", c.Status.Namespace, "name", c.Status.Name)
+			warned = true
+		} else {
+			klog.V(5).InfoS("failed to update auditor status", "error", err)
+		}
+	}, c.Status.Interval, stopCh)
+}
+
+func (c *AuditorController) updateStatus(ctx context.Context) error {
+	ri := c.dynamicClient.Resource(auditorStatusGVR).Namespace(c.Status.Namespace)
+
+	cur, err := ri.Get(ctx, c.Status.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		obj, err := toUnstructured(&v1alpha1.AuditorStatus{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+				Kind:       v1alpha1.ResourceKindAuditorStatus,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            c.Status.Name,
+				Namespace:       c.Status.Namespace,
+				OwnerReferences: c.statusOwners(ctx),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if cur, err = ri.Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	var as v1alpha1.AuditorStatus
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(cur.Object, &as); err != nil {
+		return err
+	}
+	desired := c.status()
+	conditions := as.Status.Conditions
+	for _, cond := range desired.Conditions {
+		// keeps the transition time of conditions that didn't change
+		meta.SetStatusCondition(&conditions, cond)
+	}
+	desired.Conditions = conditions
+	as.Status = desired
+
+	obj, err := toUnstructured(&as)
+	if err != nil {
+		return err
+	}
+	_, err = ri.UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+// statusOwners makes the auditor pod own the status, so that the status is
+// removed with the pod.
+func (c *AuditorController) statusOwners(ctx context.Context) []metav1.OwnerReference {
+	pod, err := c.kubeClient.CoreV1().Pods(c.Status.Namespace).Get(ctx, c.Status.Name, metav1.GetOptions{})
+	if err != nil {
+		klog.V(3).InfoS("auditor pod not found, status will not be garbage collected", "error", err)
+		return nil
+	}
+	return []metav1.OwnerReference{{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}}
+}
+
+func (c *AuditorController) status() v1alpha1.AuditorStatusStatus {
+	now := metav1.Now()
+	status := v1alpha1.AuditorStatusStatus{
+		Role:           c.role(),
+		PolicyHash:     c.policyHash(),
+		LastUpdateTime: &now,
+	}
+
+	c.mu.RLock()
+	p := c.publisher
+	for gvr, informer := range c.informers {
+		gvk := c.targets[gvr]
+		r := v1alpha1.WatchedResource{
+			Group:    gvr.Group,
+			Version:  gvr.Version,
+			Resource: gvr.Resource,
+			Kind:     gvk.Kind,
+			Synced:   informer.HasSynced(),
+		}
+		if p != nil {
+			if t, ok := p.LastEventTime(gvk); ok {
+				r.LastEventTime = &metav1.Time{Time: t}
+			}
+		}
+		status.Resources = append(status.Resources, r)
+	}
+	c.mu.RUnlock()
+	sort.Slice(status.Resources, func(i, j int) bool {
+		if status.Resources[i].Group != status.Resources[j].Group {
+			return status.Resources[i].Group < status.Resources[j].Group
+		}
+		return status.Resources[i].Resource < status.Resources[j].Resource
+	})
+
+	if p != nil {
+		stats := p.Stats()
+		status.Sink = v1alpha1.SinkStatus{
+			Connected: p.Connected(),
+			Backlog:   int32(stats.Pending),
+			Published: stats.Published,
+			Dropped:   stats.Dropped,
+			Failed:    stats.Failed,
+		}
+	}
+
+	synced := condition(v1alpha1.ConditionInformersSynced, "Synced", "NotSynced", c.checkInformersSynced(nil))
+	connected := condition(v1alpha1.ConditionSinkConnected, "Connected", "NotConnected", c.checkSinkConnected(nil))
+	ready := metav1.Condition{
+		Type:    v1alpha1.ConditionReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Ready",
+		Message: "The audit pipeline is running",
+	}
+	if synced.Status != metav1.ConditionTrue || connected.Status != metav1.ConditionTrue {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "NotReady"
+		ready.Message = "Informers have not synced or the sink is not connected"
+	}
+	status.Conditions = []metav1.Condition{ready, synced, connected}
+	return status
+}
+
+func condition(conditionType, trueReason, falseReason string, err error) metav1.Condition {
+	if err != nil {
+		return metav1.Condition{
+			Type:    conditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  falseReason,
+			Message: err.Error(),
+		}
+	}
+	return metav1.Condition{
+		Type:   conditionType,
+		Status: metav1.ConditionTrue,
+		Reason: trueReason,
+	}
+}
+
+func (c *AuditorController) role() v1alpha1.AuditorRole {
+	switch {
+	case c.LeaderElection.Enabled && c.standby():
+		return v1alpha1.AuditorRoleStandby
+	case c.LeaderElection.Enabled:
+		return v1alpha1.AuditorRoleLeader
+	case c.Sharding.Enabled:
+		return v1alpha1.AuditorRoleShardMember
+	}
+	return v1alpha1.AuditorRoleStandalone
+}
+
+// policyHash returns the sha256 digest of the effective audit policy.
+func (c *AuditorController) policyHash() string {
+	data, err := json.Marshal(c.Policy)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
@@ -18,12 +18,20 @@ package controller
 
 import (
 	"fmt"
-	"strings"
+	"os"
+
+	"kubeops.dev/auditor/pkg/chain"
+	"kubeops.dev/auditor/pkg/cloudevent"
+	"kubeops.dev/auditor/pkg/enrich"
+	"kubeops.dev/auditor/pkg/eventer"
+	"kubeops.dev/auditor/pkg/license"
+	"kubeops.dev/auditor/pkg/policy"
+	"kubeops.dev/auditor/pkg/publisher"
+	"kubeops.dev/auditor/pkg/routing"
 
 	"go.bytebuilders.dev/audit/lib"
-	stringz "gomodules.xyz/x/strings"
+	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/discovery"
 	"k8s.io/klog/v2"
 	disco_util "kmodules.xyz/client-go/discovery"
 	"kmodules.xyz/client-go/tools/clusterid"
@@ -31,51 +39,164 @@ import (
 
 func (c *AuditorController) initWatchers() error {
 	disco := c.kubeClient.Discovery()
-	mapper, err := disco_util.NewDynamicResourceMapper(c.clientConfig)
+	mapper := c.mapper
+	if mapper == nil {
+		var err error
+		mapper, err = disco_util.NewDynamicResourceMapper(c.clientConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	fn := lib.AuditEventCreator{
+		Mapper: mapper,
+	}
+	md, err := clusterid.ClusterMetadata(c.kubeClient.CoreV1().Namespaces())
+	if err != nil {
+		return fmt.Errorf("failed to extract cluster metadata, reason: %v", err)
+	}
+	cid := md.UID
+	cluster, err := cloudevent.NewCluster(*md, c.ClusterLabels)
 	if err != nil {
 		return err
 	}
+	resource := publisher.ClusterResource(*md, c.ClusterLabels)
 
-	cid, err := clusterid.ClusterUID(c.kubeClient.CoreV1().Namespaces())
-	if err != nil {
-		return fmt.Errorf("failed to extract cluster uid, reason: %v", err)
+	opts := publisher.Options{
+		Tracker:      c.tracker,
+		Recorder:     c.recorder,
+		Transformers: []publisher.Transformer{cluster},
 	}
-	fn := lib.AuditEventCreator{
-		Mapper: mapper,
+	if c.Enrich {
+		opts.Enricher = enrich.New(mapper, c.cachedObject, c.metadataClient)
+	}
+	// encrypt before the chain and signatures, so that they cover the data
+	// as published
+	if c.encrypter != nil {
+		opts.Transformers = append(opts.Transformers, c.encrypter)
+	}
+	// every routing sink has a chain of its own, and the signatures cover
+	// the chain of the sink
+	if c.HashChain.Path != "" {
+		open := chain.Open
+		if c.DryRun {
+			open = chain.OpenReadOnly
+		}
+		ch, err := open(c.HashChain.Path, c.HashChain.ID)
+		if err != nil {
+			return err
+		}
+		c.chain = ch
+		opts.SinkTransformers = append(opts.SinkTransformers, ch)
+	}
+	if c.signer != nil {
+		opts.SinkTransformers = append(opts.SinkTransformers, publisher.EverySink(c.signer))
+	}
+
+	var connect func() (publisher.Sink, error)
+	switch {
+	case c.connect != nil:
+		connect = c.connect
+		if c.Routing != nil {
+			connect = func() (publisher.Sink, error) {
+				sink, err := c.connect()
+				if err != nil {
+					return nil, err
+				}
+				return shareRoutes(c.Routing, sink), nil
+			}
+		}
+	case c.DryRun:
+		var sink publisher.Sink = publisher.NewDryRunSink(os.Stdout)
+		if c.Routing != nil {
+			sink = shareRoutes(c.Routing, sink)
+		}
+		connect = func() (publisher.Sink, error) {
+			return sink, nil
+		}
+	case c.Offline.Enabled:
+		l, err := license.VerifyOffline(c.LicenseFile, cid)
+		if err != nil {
+			return err
+		}
+		klog.InfoS("verified license offline", "licenseID", l.ID, "plan", l.PlanName, "expires", l.NotAfter)
+		connect = func() (publisher.Sink, error) {
+			if c.Routing != nil {
+				return openRoutes(c.Routing, func(s routing.Sink) (publisher.Sink, error) {
+					if s.OTLP != nil {
+						return openOTLP(s.OTLP, resource)
+					}
+					return publisher.NewFileSink(s.File.Path, l.ID)
+				})
+			}
+			return publisher.NewFileSink(c.Offline.SinkFile, l.ID)
+		}
+	default:
+		connect = func() (publisher.Sink, error) {
+			cfg, err := lib.NewNatsConfig(cid, c.LicenseFile)
+			if err != nil {
+				return nil, err
+			}
+			if c.Routing != nil {
+				// all NATS sinks share the connection of the license
+				var nc *publisher.NatsSink
+				return openRoutes(c.Routing, func(s routing.Sink) (publisher.Sink, error) {
+					if s.File != nil {
+						return publisher.NewFileSink(s.File.Path, cfg.LicenseID)
+					}
+					if s.OTLP != nil {
+						return openOTLP(s.OTLP, resource)
+					}
+					if nc == nil {
+						nc = publisher.NewTemplatedNatsSink(cfg, s.NATS.Template(), cid)
+						return nc, nil
+					}
+					return nc.Share(s.NATS.Template(), cid), nil
+				})
+			}
+			if c.SubjectTemplate != nil {
+				return publisher.NewTemplatedNatsSink(cfg, c.SubjectTemplate, cid), nil
+			}
+			return publisher.NewNatsSink(cfg), nil
+		}
+	}
+	if c.Routing != nil {
+		opts.Router = c.Routing
+	}
+	pub := publisher.New(connect, opts)
+
+	targets := map[schema.GroupVersionResource]schema.GroupVersionKind{}
+	watch := func(gvr schema.GroupVersionResource, gvk schema.GroupVersionKind) {
+		targets[gvr] = gvk
 	}
-	auditor := lib.NewResilientEventPublisher(func() (*lib.NatsConfig, error) {
-		return lib.NewNatsConfig(cid, c.LicenseFile)
-	}, mapper, fn.CreateEvent)
 
 	if len(c.Policy.Resources) == 0 {
 		// watch all
-		rsLists, err := disco.ServerPreferredResources()
-		if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		rsLists, err := policy.ServerPreferredResources(disco)
+		if err != nil {
 			return err
 		}
 		for _, rsList := range rsLists {
 			for _, rs := range rsList.APIResources {
 				// skip sub resource
-				if strings.ContainsRune(rs.Name, '/') {
+				if policy.IsSubresource(rs.Name) {
 					continue
 				}
 				// if resource can't be listed or read (get) skip it
-				if !stringz.Contains(rs.Verbs, "list") || !stringz.Contains(rs.Verbs, "get") || !stringz.Contains(rs.Verbs, "watch") {
+				if !policy.Watchable(rs) {
 					continue
 				}
 				gv, err := schema.ParseGroupVersion(rsList.GroupVersion)
 				if err != nil {
 					return err
 				}
-				gvr := gv.WithResource(rs.Name)
-				klog.Infoln("watching", gvr)
-				c.dynamicInformerFactory.ForResource(gvr).Informer().AddEventHandler(auditor.ForGVK(gv.WithKind(rs.Kind)))
+				watch(gv.WithResource(rs.Name), gv.WithKind(rs.Kind))
 			}
 		}
 	} else {
 		for _, resource := range c.Policy.Resources {
 			for _, name := range resource.Resources {
-				if strings.ContainsRune(name, '/') {
+				if policy.IsSubresource(name) {
 					continue
 				}
 				gvr := schema.GroupVersionResource{
@@ -87,17 +208,30 @@ func (c *AuditorController) initWatchers() error {
 				gvr, err := mapper.Preferred(gvr)
 				if err != nil {
 					klog.Errorln(err)
+					c.recorder.Eventf(core.EventTypeWarning, eventer.EventReasonPolicyInvalid, "Skipping resource %s of the audit policy: %v", gvr.GroupResource(), err)
 					continue
 				}
 				gvk, err := mapper.GVK(gvr)
 				if err != nil {
 					klog.Errorln(err)
+					c.recorder.Eventf(core.EventTypeWarning, eventer.EventReasonPolicyInvalid, "Skipping resource %s of the audit policy: %v", gvr.GroupResource(), err)
 					continue
 				}
-				klog.Infoln("watching", gvr)
-				c.dynamicInformerFactory.ForResource(gvr).Informer().AddEventHandler(auditor.ForGVK(gvk))
+				watch(gvr, gvk)
 			}
 		}
 	}
+	if len(c.Policy.Resources) == 0 {
+		c.recorder.Eventf(core.EventTypeNormal, eventer.EventReasonPolicyLoaded, "No audit policy set, auditing all %d resources", len(targets))
+	} else {
+		c.recorder.Eventf(core.EventTypeNormal, eventer.EventReasonPolicyLoaded, "Loaded audit policy for %d resources", len(targets))
+	}
+
+	c.mu.Lock()
+	c.publisher = pub
+	c.createEvent = fn.CreateEvent
+	c.targets = targets
+	c.watching = true
+	c.mu.Unlock()
 	return nil
 }
@@ -0,0 +1,410 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dedupe
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+const (
+	LabelState       = "auditor.appscode.com/state"
+	AnnotationKey    = "auditor.appscode.com/resource"
+	AnnotationShards = "auditor.appscode.com/shards"
+	stateDedupe      = "dedupe"
+	dataKey          = "state.json.gz"
+	defaultInterval  = 30 * time.Second
+)
+
+// The state of a resource type is split across more ConfigMaps once it
+// grows past maxShardSize, which leaves room for the metadata below the
+// 1 MiB limit of a ConfigMap. It can't grow past maxShards ConfigMaps.
+var (
+	maxShardSize = 768 << 10
+	maxShards    = 256
+)
+
+// Key identifies the resource type a tracked object belongs to.
+func Key(rid kmapi.ResourceID) string {
+	return rid.Group + "/" + rid.Name
+}
+
+// Tracker remembers the last published generation of every object, so that
+// a new leader doesn't republish objects the previous leader already
+// published. The state of a resource type is persisted in one or more
+// ConfigMaps, the shards, by the hash of the object uid. The first shard
+// records the number of shards.
+type Tracker struct {
+	client    kubernetes.Interface
+	namespace string
+	readOnly  bool
+
+	mu     sync.Mutex
+	state  map[string]map[types.UID]int64
+	shards map[string]int
+	dirty  map[string]map[int]bool
+}
+
+func NewTracker(client kubernetes.Interface, namespace string) *Tracker {
+	return &Tracker{
+		client:    client,
+		namespace: namespace,
+		state:     map[string]map[types.UID]int64{},
+		shards:    map[string]int{},
+		dirty:     map[string]map[int]bool{},
+	}
+}
+
+// NewReadOnlyTracker returns a Tracker that loads the persisted state, but
+// never persists its own, for dry runs.
+func NewReadOnlyTracker(client kubernetes.Interface, namespace string) *Tracker {
+	t := NewTracker(client, namespace)
+	t.readOnly = true
+	return t
+}
+
+// Generation returns the last published generation of an object.
+func (t *Tracker) Generation(key string, uid types.UID) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	gen, ok := t.state[key][uid]
+	return gen, ok
+}
+
+// Published records that the given generation of an object was published.
+func (t *Tracker) Published(key string, uid types.UID, generation int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	objs, ok := t.state[key]
+	if !ok {
+		objs = map[types.UID]int64{}
+		t.state[key] = objs
+	}
+	if gen, ok := objs[uid]; ok && gen == generation {
+		return
+	}
+	objs[uid] = generation
+	t.markDirty(key, uid)
+}
+
+// Deleted forgets an object after its deletion was published.
+func (t *Tracker) Deleted(key string, uid types.UID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.state[key][uid]; ok {
+		delete(t.state[key], uid)
+		t.markDirty(key, uid)
+	}
+}
+
+// Retain forgets the objects of a resource type that are not in live, like
+// objects that were deleted while no replica was watching them.
+func (t *Tracker) Retain(key string, live map[types.UID]bool) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var pruned int
+	for uid := range t.state[key] {
+		if !live[uid] {
+			delete(t.state[key], uid)
+			t.markDirty(key, uid)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// markDirty must be called with t.mu held.
+func (t *Tracker) markDirty(key string, uid types.UID) {
+	if t.dirty[key] == nil {
+		t.dirty[key] = map[int]bool{}
+	}
+	t.dirty[key][shardOf(uid, t.shardCount(key))] = true
+}
+
+// shardCount must be called with t.mu held.
+func (t *Tracker) shardCount(key string) int {
+	if n := t.shards[key]; n > 0 {
+		return n
+	}
+	return 1
+}
+
+// Load replaces the in memory state of a resource type with the persisted
+// one.
+func (t *Tracker) Load(ctx context.Context, key string) error {
+	objs := map[types.UID]int64{}
+	n := 1
+	for i := 0; i < n; i++ {
+		cm, err := t.client.CoreV1().ConfigMaps(t.namespace).Get(ctx, shardName(key, i), metav1.GetOptions{})
+		if kerr.IsNotFound(err) {
+			if i > 0 {
+				klog.InfoS("missing dedupe state shard", "resource", key, "shard", i)
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if i == 0 {
+			if v, ok := cm.Annotations[AnnotationShards]; ok {
+				if n, err = strconv.Atoi(v); err != nil || n < 1 {
+					return fmt.Errorf("invalid shard count %q in configmap %s/%s", v, cm.Namespace, cm.Name)
+				}
+			}
+		}
+		shard, err := decode(cm.BinaryData[dataKey])
+		if err != nil {
+			return fmt.Errorf("invalid dedupe state in configmap %s/%s: %v", cm.Namespace, cm.Name, err)
+		}
+		for uid, gen := range shard {
+			objs[uid] = gen
+		}
+	}
+
+	t.mu.Lock()
+	t.state[key] = objs
+	t.shards[key] = n
+	delete(t.dirty, key)
+	t.mu.Unlock()
+	klog.V(3).InfoS("loaded dedupe state", "resource", key, "objects", len(objs), "shards", n)
+	return nil
+}
+
+// Forget drops the in memory state of a resource type. Pending changes must
+// be flushed first.
+func (t *Tracker) Forget(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.state, key)
+	delete(t.shards, key)
+	delete(t.dirty, key)
+}
+
+// Run persists the state periodically until stopCh is closed.
+func (t *Tracker) Run(stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if err := t.Flush(context.TODO()); err != nil {
+			klog.ErrorS(err, "failed to persist dedupe state")
+		}
+	}, defaultInterval, stopCh)
+}
+
+// pendingState is the encoded state of the changed shards of a resource
+// type.
+type pendingState struct {
+	shards int
+	data   map[int][]byte
+}
+
+// Flush persists the state of every resource type that changed since the
+// last flush. A read only Tracker persists nothing.
+func (t *Tracker) Flush(ctx context.Context) error {
+	if t.readOnly {
+		return nil
+	}
+
+	var errs []error
+	t.mu.Lock()
+	pending := map[string]pendingState{}
+	for key, dirty := range t.dirty {
+		p, err := t.encode(key, dirty)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		pending[key] = p
+		delete(t.dirty, key)
+	}
+	t.mu.Unlock()
+
+	for key, p := range pending {
+		if err := t.save(ctx, key, p); err != nil {
+			errs = append(errs, err)
+			t.mu.Lock()
+			if t.shards[key] == p.shards {
+				for i := range p.data {
+					t.markShardDirty(key, i)
+				}
+			}
+			t.mu.Unlock()
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to persist dedupe state of %d resources: %v", len(errs), errs[0])
+	}
+	return nil
+}
+
+// encode encodes the dirty shards of a resource type. If a shard outgrows
+// maxShardSize, the number of shards is doubled and every shard is
+// encoded. encode must be called with t.mu held.
+func (t *Tracker) encode(key string, dirty map[int]bool) (pendingState, error) {
+	n := t.shardCount(key)
+	for {
+		p := pendingState{shards: n, data: map[int][]byte{}}
+		parts := split(t.state[key], n)
+		fits := true
+		for i := range parts {
+			if !dirty[i] && n == t.shardCount(key) {
+				continue
+			}
+			data, err := encode(parts[i])
+			if err != nil {
+				return p, err
+			}
+			if len(data) > maxShardSize {
+				fits = false
+				break
+			}
+			p.data[i] = data
+		}
+		if fits {
+			if n != t.shardCount(key) {
+				klog.InfoS("split dedupe state", "resource", key, "shards", n)
+				t.shards[key] = n
+			}
+			return p, nil
+		}
+		if n*2 > maxShards {
+			return p, fmt.Errorf("dedupe state of %s with %d objects doesn't fit in %d configmaps", key, len(t.state[key]), maxShards)
+		}
+		n *= 2
+	}
+}
+
+// markShardDirty must be called with t.mu held.
+func (t *Tracker) markShardDirty(key string, shard int) {
+	if t.dirty[key] == nil {
+		t.dirty[key] = map[int]bool{}
+	}
+	t.dirty[key][shard] = true
+}
+
+// save writes the first shard last, so that it never records more shards
+// than were written.
+func (t *Tracker) save(ctx context.Context, key string, p pendingState) error {
+	for i := p.shards - 1; i >= 0; i-- {
+		data, ok := p.data[i]
+		if !ok {
+			continue
+		}
+		if err := t.saveShard(ctx, key, i, p.shards, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tracker) saveShard(ctx context.Context, key string, shard, shards int, data []byte) error {
+	cm := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      shardName(key, shard),
+			Namespace: t.namespace,
+			Labels: map[string]string{
+				LabelState: stateDedupe,
+			},
+			Annotations: map[string]string{
+				AnnotationKey: key,
+			},
+		},
+		BinaryData: map[string][]byte{
+			dataKey: data,
+		},
+	}
+	if shard == 0 {
+		cm.Annotations[AnnotationShards] = strconv.Itoa(shards)
+	}
+
+	cms := t.client.CoreV1().ConfigMaps(t.namespace)
+	_, err := cms.Update(ctx, cm, metav1.UpdateOptions{})
+	if kerr.IsNotFound(err) {
+		_, err = cms.Create(ctx, cm, metav1.CreateOptions{})
+	}
+	return err
+}
+
+// shardName returns the name of a shard ConfigMap. The first shard keeps
+// the name of the ConfigMap of unsharded state.
+func shardName(key string, shard int) string {
+	if shard == 0 {
+		return configMapName(key)
+	}
+	return fmt.Sprintf("%s-%d", configMapName(key), shard)
+}
+
+func shardOf(uid types.UID, shards int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(uid))
+	return int(h.Sum32() % uint32(shards))
+}
+
+func split(objs map[types.UID]int64, shards int) []map[types.UID]int64 {
+	split := make([]map[types.UID]int64, shards)
+	for i := range split {
+		split[i] = map[types.UID]int64{}
+	}
+	for uid, gen := range objs {
+		split[shardOf(uid, shards)][uid] = gen
+	}
+	return split
+}
+
+func configMapName(key string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return fmt.Sprintf("auditor-dedupe-%x", h.Sum64())
+}
+
+func encode(objs map[types.UID]int64) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(objs); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(data []byte) (map[types.UID]int64, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	objs := map[types.UID]int64{}
+	if err := json.NewDecoder(zr).Decode(&objs); err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
@@ -0,0 +1,167 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dedupe
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNamespace = "kube-system"
+	testKey       = "apps/deployments"
+)
+
+func configMaps(t *testing.T, client *fake.Clientset) int {
+	t.Helper()
+	list, err := client.CoreV1().ConfigMaps(testNamespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(list.Items)
+}
+
+func TestTrackerRoundTrip(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	tr := NewTracker(client, testNamespace)
+	tr.Published(testKey, "uid-1", 1)
+	tr.Published(testKey, "uid-2", 3)
+	tr.Deleted(testKey, "uid-2")
+	if err := tr.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	next := NewTracker(client, testNamespace)
+	if err := next.Load(context.TODO(), testKey); err != nil {
+		t.Fatal(err)
+	}
+	if gen, ok := next.Generation(testKey, "uid-1"); !ok || gen != 1 {
+		t.Errorf("generation of uid-1 = %d, %v, want 1", gen, ok)
+	}
+	if _, ok := next.Generation(testKey, "uid-2"); ok {
+		t.Error("deleted uid-2 is still tracked")
+	}
+}
+
+func TestTrackerShards(t *testing.T) {
+	defer func(size int) { maxShardSize = size }(maxShardSize)
+	maxShardSize = 512
+
+	client := fake.NewSimpleClientset()
+	tr := NewTracker(client, testNamespace)
+	for i := 0; i < 200; i++ {
+		tr.Published(testKey, types.UID(fmt.Sprintf("uid-%d", i)), int64(i))
+	}
+	if err := tr.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	shards := tr.shards[testKey]
+	if shards < 2 {
+		t.Fatalf("state was not split, shards = %d", shards)
+	}
+	if n := configMaps(t, client); n != shards {
+		t.Errorf("got %d configmaps, want %d", n, shards)
+	}
+
+	next := NewTracker(client, testNamespace)
+	if err := next.Load(context.TODO(), testKey); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		if gen, ok := next.Generation(testKey, types.UID(fmt.Sprintf("uid-%d", i))); !ok || gen != int64(i) {
+			t.Fatalf("generation of uid-%d = %d, %v, want %d", i, gen, ok, i)
+		}
+	}
+
+	// only the shard of a changed object is written again
+	next.Published(testKey, "uid-7", 100)
+	if err := next.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(next.dirty); got != 0 {
+		t.Errorf("%d resources are still dirty", got)
+	}
+}
+
+func TestTrackerStateTooLarge(t *testing.T) {
+	defer func(size, shards int) { maxShardSize, maxShards = size, shards }(maxShardSize, maxShards)
+	maxShardSize, maxShards = 256, 2
+
+	tr := NewTracker(fake.NewSimpleClientset(), testNamespace)
+	for i := 0; i < 200; i++ {
+		tr.Published(testKey, types.UID(fmt.Sprintf("uid-%d", i)), int64(i))
+	}
+	if err := tr.Flush(context.TODO()); err == nil {
+		t.Fatal("expected an error for state that doesn't fit")
+	}
+	if len(tr.dirty[testKey]) == 0 {
+		t.Error("state that failed to persist is no longer dirty")
+	}
+}
+
+func TestTrackerRetain(t *testing.T) {
+	tr := NewTracker(fake.NewSimpleClientset(), testNamespace)
+	tr.Published(testKey, "uid-1", 1)
+	tr.Published(testKey, "uid-2", 1)
+	if err := tr.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	if pruned := tr.Retain(testKey, map[types.UID]bool{"uid-1": true}); pruned != 1 {
+		t.Errorf("pruned %d objects, want 1", pruned)
+	}
+	if _, ok := tr.Generation(testKey, "uid-2"); ok {
+		t.Error("uid-2 is still tracked")
+	}
+	if len(tr.dirty[testKey]) == 0 {
+		t.Error("pruning didn't mark the state dirty")
+	}
+}
+
+func TestReadOnlyTracker(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	tr := NewTracker(client, testNamespace)
+	tr.Published(testKey, "uid-1", 1)
+	if err := tr.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	ro := NewReadOnlyTracker(client, testNamespace)
+	if err := ro.Load(context.TODO(), testKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ro.Generation(testKey, "uid-1"); !ok {
+		t.Error("read only tracker didn't load the persisted state")
+	}
+	ro.Published(testKey, "uid-2", 1)
+	if err := ro.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	check := NewTracker(client, testNamespace)
+	if err := check.Load(context.TODO(), testKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := check.Generation(testKey, "uid-2"); ok {
+		t.Error("read only tracker persisted its state")
+	}
+}
@@ -0,0 +1,369 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// FieldEncrypted is the only field of the object that replaces an encrypted
+// value in the audited object.
+const FieldEncrypted = "$encrypted"
+
+const algorithm = "A256GCM"
+
+// Envelope is an encrypted field value. The value is encrypted with a random
+// data key, which is stored wrapped by a key encryption key. All fields of
+// an event share the same data key.
+type Envelope struct {
+	Algorithm string `json:"alg"`
+	// KeyID identifies the key encryption key.
+	KeyID string `json:"kid"`
+	// DataKey is the base64 encoded nonce and wrapped data key.
+	DataKey string `json:"dataKey"`
+	// Ciphertext is the base64 encoded nonce and encrypted json value.
+	Ciphertext string `json:"ciphertext"`
+	// Digest is the base64 encoded keyed digest of the value and the
+	// field it was taken from. It doesn't change while the value doesn't,
+	// so that encrypted fields can be compared without decrypting them.
+	Digest string `json:"digest,omitempty"`
+}
+
+// additionalData binds a ciphertext to the field and object it was taken
+// from, so that it can't be moved elsewhere.
+func additionalData(uid types.UID, fields []string) []byte {
+	data, _ := json.Marshal(struct {
+		UID  types.UID `json:"uid"`
+		Path []string  `json:"path"`
+	}{uid, fields})
+	return data
+}
+
+// digest returns the keyed digest of a field value. The digest key is
+// derived from the key encryption key, so that values can't be guessed
+// without it.
+func digest(kek, plaintext, ad []byte) string {
+	mac := hmac.New(sha256.New, kek)
+	mac.Write([]byte("auditor field digest"))
+	key := mac.Sum(nil)
+
+	mac = hmac.New(sha256.New, key)
+	mac.Write(ad)
+	mac.Write([]byte{0})
+	mac.Write(plaintext)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func seal(key, plaintext, ad []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, ad)), nil
+}
+
+func open(key []byte, sealed string, ad []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], ad)
+}
+
+// Encrypter encrypts the fields selected by a policy in the data of every
+// event.
+type Encrypter struct {
+	policy *Policy
+	kid    string
+	kek    []byte
+}
+
+// NewEncrypter loads the keys in dir and encrypts with the key named kid. If
+// kid is empty, dir must hold exactly one key.
+func NewEncrypter(policy *Policy, dir, kid string) (*Encrypter, error) {
+	keys, err := LoadKeys(dir)
+	if err != nil {
+		return nil, err
+	}
+	if kid == "" {
+		if len(keys) > 1 {
+			return nil, fmt.Errorf("found more than one key in %s, the encryption key id must be set", dir)
+		}
+		for id := range keys {
+			kid = id
+		}
+	}
+	kek, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("no key with id %q found in %s", kid, dir)
+	}
+	return &Encrypter{
+		policy: policy,
+		kid:    kid,
+		kek:    kek,
+	}, nil
+}
+
+// Transform encrypts the selected fields of the event data.
+func (e *Encrypter) Transform(event *cloudevents.Event) error {
+	var payload cloudevent.Payload
+	if err := event.DataAs(&payload); err != nil {
+		return err
+	}
+	if payload.Resource == nil {
+		return nil
+	}
+	encrypted, err := e.EncryptObject(payload.ResourceID, payload.Resource)
+	if err != nil || !encrypted {
+		return err
+	}
+	return event.SetData(cloudevents.ApplicationJSON, payload)
+}
+
+// EncryptObject encrypts the selected fields of an object in place, and
+// reports whether any field was encrypted. The last applied configuration
+// annotation holds a copy of the fields, so it is removed from objects with
+// encrypted fields.
+func (e *Encrypter) EncryptObject(rid kmapi.ResourceID, obj *unstructured.Unstructured) (bool, error) {
+	paths := e.policy.Paths(rid)
+	if len(paths) == 0 {
+		return false, nil
+	}
+
+	var dataKey []byte
+	var wrapped string
+	encrypted := false
+	for _, fields := range paths {
+		v, found, err := unstructured.NestedFieldNoCopy(obj.Object, fields...)
+		if err != nil || !found {
+			continue
+		}
+		if dataKey == nil {
+			dataKey = make([]byte, keySize)
+			if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+				return false, err
+			}
+			if wrapped, err = seal(e.kek, dataKey, []byte(e.kid)); err != nil {
+				return false, err
+			}
+		}
+
+		plaintext, err := json.Marshal(v)
+		if err != nil {
+			return false, err
+		}
+		ad := additionalData(obj.GetUID(), fields)
+		ciphertext, err := seal(dataKey, plaintext, ad)
+		if err != nil {
+			return false, err
+		}
+		env := Envelope{
+			Algorithm:  algorithm,
+			KeyID:      e.kid,
+			DataKey:    wrapped,
+			Ciphertext: ciphertext,
+			Digest:     digest(e.kek, plaintext, ad),
+		}
+		if err := unstructured.SetNestedField(obj.Object, env.value(), fields...); err != nil {
+			return false, err
+		}
+		encrypted = true
+	}
+	if encrypted {
+		unstructured.RemoveNestedField(obj.Object, "metadata", "annotations", core.LastAppliedConfigAnnotation)
+	}
+	return encrypted, nil
+}
+
+// Decrypter decrypts the encrypted fields of events.
+type Decrypter struct {
+	keys map[string][]byte
+}
+
+func NewDecrypter(keys map[string][]byte) *Decrypter {
+	return &Decrypter{keys: keys}
+}
+
+// Decrypt replaces the encrypted fields in the event data with their values.
+// It returns the number of decrypted fields.
+func (d *Decrypter) Decrypt(event *cloudevents.Event) (int, error) {
+	var payload cloudevent.Payload
+	if err := event.DataAs(&payload); err != nil {
+		return 0, err
+	}
+	if payload.Resource == nil {
+		return 0, nil
+	}
+	n, err := d.DecryptObject(payload.Resource)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	return n, event.SetData(cloudevents.ApplicationJSON, payload)
+}
+
+// DecryptObject replaces the encrypted fields of an object with their values.
+// It returns the number of decrypted fields.
+func (d *Decrypter) DecryptObject(obj *unstructured.Unstructured) (int, error) {
+	return d.walk(obj.Object, nil, obj.GetUID(), map[string][]byte{})
+}
+
+// Stable replaces the encrypted fields of an object with their digests, so
+// that revisions of the object can be compared. Fields encrypted without a
+// digest are left as they are.
+func Stable(obj map[string]interface{}) {
+	for k, v := range obj {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		env, ok := envelope(m)
+		if !ok {
+			Stable(m)
+			continue
+		}
+		if env.Digest != "" {
+			obj[k] = map[string]interface{}{
+				FieldEncrypted: map[string]interface{}{"digest": env.Digest},
+			}
+		}
+	}
+}
+
+func (d *Decrypter) walk(obj map[string]interface{}, path []string, uid types.UID, dataKeys map[string][]byte) (int, error) {
+	n := 0
+	for k, v := range obj {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fields := append(append([]string{}, path...), k)
+		env, ok := envelope(m)
+		if !ok {
+			c, err := d.walk(m, fields, uid, dataKeys)
+			if err != nil {
+				return n, err
+			}
+			n += c
+			continue
+		}
+		value, err := d.open(env, uid, fields, dataKeys)
+		if err != nil {
+			return n, fmt.Errorf("failed to decrypt %v: %v", fields, err)
+		}
+		obj[k] = value
+		n++
+	}
+	return n, nil
+}
+
+// value returns the object that replaces an encrypted field.
+func (e Envelope) value() map[string]interface{} {
+	return map[string]interface{}{
+		FieldEncrypted: map[string]interface{}{
+			"alg":        e.Algorithm,
+			"kid":        e.KeyID,
+			"dataKey":    e.DataKey,
+			"ciphertext": e.Ciphertext,
+			"digest":     e.Digest,
+		},
+	}
+}
+
+func envelope(m map[string]interface{}) (Envelope, bool) {
+	if len(m) != 1 {
+		return Envelope{}, false
+	}
+	e, ok := m[FieldEncrypted].(map[string]interface{})
+	if !ok {
+		return Envelope{}, false
+	}
+	str := func(k string) string {
+		s, _ := e[k].(string)
+		return s
+	}
+	return Envelope{
+		Algorithm:  str("alg"),
+		KeyID:      str("kid"),
+		DataKey:    str("dataKey"),
+		Ciphertext: str("ciphertext"),
+		Digest:     str("digest"),
+	}, true
+}
+
+func (d *Decrypter) open(env Envelope, uid types.UID, fields []string, dataKeys map[string][]byte) (interface{}, error) {
+	if env.Algorithm != algorithm {
+		return nil, fmt.Errorf("unsupported algorithm %q", env.Algorithm)
+	}
+	dataKey, ok := dataKeys[env.DataKey]
+	if !ok {
+		kek, ok := d.keys[env.KeyID]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", env.KeyID)
+		}
+		var err error
+		dataKey, err = open(kek, env.DataKey, []byte(env.KeyID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap data key: %v", err)
+		}
+		dataKeys[env.DataKey] = dataKey
+	}
+	plaintext, err := open(dataKey, env.Ciphertext, additionalData(uid, fields))
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(plaintext, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
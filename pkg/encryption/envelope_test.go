@@ -0,0 +1,211 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	api "go.bytebuilders.dev/audit/api/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+var secretsID = kmapi.ResourceID{Version: "v1", Name: "secrets", Kind: "Secret", Scope: kmapi.NamespaceScoped}
+
+func newEncrypter(t *testing.T) (*Encrypter, map[string][]byte) {
+	t.Helper()
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{7}, keySize)
+	if err := os.WriteFile(filepath.Join(dir, "k1"+KeyFileExt), key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy := &Policy{Rules: []Rule{{Resources: []string{"secrets"}, Paths: []string{"$.data", ".metadata.labels.token"}}}}
+	e, err := NewEncrypter(policy, dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, map[string][]byte{"k1": key}
+}
+
+func newSecret(uid string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"data":       map[string]interface{}{"password": "c2VjcmV0"},
+	}}
+	u.SetName("db")
+	u.SetNamespace("default")
+	u.SetUID(types.UID(uid))
+	u.SetLabels(map[string]string{"token": "abc", "app": "db"})
+	u.SetAnnotations(map[string]string{
+		core.LastAppliedConfigAnnotation: `{"data":{"password":"c2VjcmV0"}}`,
+		"team":                           "storage",
+	})
+	return u
+}
+
+func newSecretEvent(t *testing.T, obj *unstructured.Unstructured) *cloudevents.Event {
+	t.Helper()
+	event, err := cloudevent.New(&api.Event{ResourceID: secretsID, Resource: obj}, api.EventCreated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func resource(t *testing.T, event *cloudevents.Event) *unstructured.Unstructured {
+	t.Helper()
+	var payload cloudevent.Payload
+	if err := event.DataAs(&payload); err != nil {
+		t.Fatal(err)
+	}
+	return payload.Resource
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	e, keys := newEncrypter(t)
+	obj := newSecret("uid-1")
+	event := newSecretEvent(t, obj)
+	if err := e.Transform(event); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(event.Data()), "c2VjcmV0") || strings.Contains(string(event.Data()), `"abc"`) {
+		t.Fatalf("encrypted event holds plaintext: %s", event.Data())
+	}
+	encrypted := resource(t, event)
+	if _, found := encrypted.GetAnnotations()[core.LastAppliedConfigAnnotation]; found {
+		t.Error("last applied configuration was not removed")
+	}
+	if encrypted.GetAnnotations()["team"] != "storage" || encrypted.GetName() != "db" {
+		t.Error("fields that are not selected changed")
+	}
+
+	n, err := NewDecrypter(keys).Decrypt(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("decrypted %d fields, want 2", n)
+	}
+	decrypted := resource(t, event)
+	if !reflect.DeepEqual(decrypted.Object["data"], obj.Object["data"]) {
+		t.Errorf("data = %v, want %v", decrypted.Object["data"], obj.Object["data"])
+	}
+	if decrypted.GetLabels()["token"] != "abc" {
+		t.Errorf("labels = %v, want the token restored", decrypted.GetLabels())
+	}
+}
+
+func TestEncryptUnselected(t *testing.T) {
+	e, _ := newEncrypter(t)
+	obj := newSecret("uid-1")
+	encrypted, err := e.EncryptObject(kmapi.ResourceID{Version: "v1", Name: "configmaps", Kind: "ConfigMap"}, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted {
+		t.Error("encrypted an object the policy doesn't select")
+	}
+	if _, found := obj.GetAnnotations()[core.LastAppliedConfigAnnotation]; !found {
+		t.Error("removed the last applied configuration of an unencrypted object")
+	}
+}
+
+func TestDecryptBindsFields(t *testing.T) {
+	e, keys := newEncrypter(t)
+	obj := newSecret("uid-1")
+	if _, err := e.EncryptObject(secretsID, obj); err != nil {
+		t.Fatal(err)
+	}
+	data := obj.Object["data"]
+
+	tests := map[string]func(u *unstructured.Unstructured){
+		// a ciphertext moved to another field
+		"moved": func(u *unstructured.Unstructured) {
+			u.Object["stringData"] = data
+			delete(u.Object, "data")
+		},
+		// a ciphertext copied to another object
+		"other object": func(u *unstructured.Unstructured) {
+			u.SetUID("uid-2")
+		},
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			u := obj.DeepCopy()
+			tamper(u)
+			event := newSecretEvent(t, u)
+			if _, err := NewDecrypter(keys).Decrypt(event); err == nil {
+				t.Error("decrypted a ciphertext outside of its field")
+			}
+		})
+	}
+}
+
+func TestDecryptUnknownKey(t *testing.T) {
+	e, _ := newEncrypter(t)
+	event := newSecretEvent(t, newSecret("uid-1"))
+	if err := e.Transform(event); err != nil {
+		t.Fatal(err)
+	}
+	other := map[string][]byte{"k1": bytes.Repeat([]byte{8}, keySize)}
+	if _, err := NewDecrypter(other).Decrypt(event); err == nil {
+		t.Error("decrypted with the wrong key")
+	}
+	if _, err := NewDecrypter(map[string][]byte{}).Decrypt(event); err == nil {
+		t.Error("decrypted without the key")
+	}
+}
+
+func TestStable(t *testing.T) {
+	e, _ := newEncrypter(t)
+	a, b := newSecret("uid-1"), newSecret("uid-1")
+	for _, u := range []*unstructured.Unstructured{a, b} {
+		if _, err := e.EncryptObject(secretsID, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reflect.DeepEqual(a.Object["data"], b.Object["data"]) {
+		t.Fatal("encrypting the same value twice gave the same ciphertext")
+	}
+	Stable(a.Object)
+	Stable(b.Object)
+	if !reflect.DeepEqual(a.Object, b.Object) {
+		t.Errorf("stable forms of the same value differ: %v, %v", a.Object, b.Object)
+	}
+
+	c := newSecret("uid-1")
+	c.Object["data"] = map[string]interface{}{"password": "b3RoZXI="}
+	if _, err := e.EncryptObject(secretsID, c); err != nil {
+		t.Fatal(err)
+	}
+	Stable(c.Object)
+	if reflect.DeepEqual(a.Object["data"], c.Object["data"]) {
+		t.Error("stable forms of different values are equal")
+	}
+}
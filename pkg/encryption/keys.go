@@ -0,0 +1,73 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeyFileExt is the extension of the key files in a key directory. The file
+// name without the extension is used as the key ID.
+const KeyFileExt = ".key"
+
+const keySize = 32
+
+// LoadKeys loads the AES-256 key encryption keys in dir, usually a mounted
+// Secret, by key ID. Key files hold 32 raw bytes, or their base64 encoding.
+func LoadKeys(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string][]byte{}
+	for _, e := range entries {
+		// skip the ..data links and hidden files of mounted volumes
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || filepath.Ext(e.Name()) != KeyFileExt {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %v", path, err)
+		}
+		keys[strings.TrimSuffix(e.Name(), KeyFileExt)] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys found in %s", dir)
+	}
+	return keys, nil
+}
+
+func parseKey(data []byte) ([]byte, error) {
+	if len(data) == keySize {
+		return data, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes, raw or base64 encoded", keySize)
+	}
+	return key, nil
+}
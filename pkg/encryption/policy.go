@@ -0,0 +1,118 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"kubeops.dev/auditor/pkg/objects"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Policy selects the fields of audited objects that are encrypted.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule encrypts the given paths of the objects of the matching resources.
+type Rule struct {
+	// Group is the API group of the resources. Use "*" for all groups.
+	Group string `json:"group"`
+	// Resources are the plural resource names. Use "*" for all resources
+	// of the group.
+	Resources []string `json:"resources"`
+	// Paths are JSONPaths of fields in the object, like "$.data" or
+	// ".spec.credentials". Only child field names are supported; the whole
+	// value of the field is encrypted.
+	Paths []string `json:"paths"`
+}
+
+// LoadPolicy reads an encryption policy from a yaml or json file.
+func LoadPolicy(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption policy file: %v", err)
+	}
+	var p Policy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse encryption policy file: %v", err)
+	}
+	for i, r := range p.Rules {
+		if len(r.Resources) == 0 {
+			return nil, fmt.Errorf("encryption policy rule %d has no resources", i)
+		}
+		if len(r.Paths) == 0 {
+			return nil, fmt.Errorf("encryption policy rule %d has no paths", i)
+		}
+		for _, path := range r.Paths {
+			if _, err := parsePath(path); err != nil {
+				return nil, fmt.Errorf("encryption policy rule %d: %v", i, err)
+			}
+		}
+	}
+	return &p, nil
+}
+
+// parsePath converts a JSONPath with child field names only into the field
+// path used by unstructured helpers.
+func parsePath(path string) ([]string, error) {
+	p := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(path), "$"), ".")
+	if p == "" {
+		return nil, fmt.Errorf("invalid path %q, the whole object can't be encrypted", path)
+	}
+	if strings.ContainsAny(p, "[]*") {
+		return nil, fmt.Errorf("invalid path %q, only child field names are supported", path)
+	}
+	fields := objects.ParseFieldPaths([]string{p})[0]
+	for _, f := range fields {
+		if f == "" {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+	}
+	return fields, nil
+}
+
+// Paths returns the field paths to encrypt in objects of the resource.
+func (p *Policy) Paths(rid kmapi.ResourceID) [][]string {
+	var paths [][]string
+	for _, r := range p.Rules {
+		if !r.matches(rid) {
+			continue
+		}
+		for _, path := range r.Paths {
+			fields, _ := parsePath(path)
+			paths = append(paths, fields)
+		}
+	}
+	return paths
+}
+
+func (r Rule) matches(rid kmapi.ResourceID) bool {
+	if r.Group != "*" && r.Group != rid.Group {
+		return false
+	}
+	for _, name := range r.Resources {
+		if name == "*" || name == rid.Name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package enrich
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/metadata"
+	"k8s.io/klog/v2"
+	disco_util "kmodules.xyz/client-go/discovery"
+)
+
+const (
+	// maxOwnerDepth bounds the owner chain, in case of reference cycles.
+	maxOwnerDepth = 10
+
+	ownerCacheSize = 1024
+	ownerCacheTTL  = time.Minute
+)
+
+// Well known labels and annotations of the workload context.
+const (
+	labelAppName      = "app.kubernetes.io/name"
+	labelAppInstance  = "app.kubernetes.io/instance"
+	labelAppVersion   = "app.kubernetes.io/version"
+	labelAppComponent = "app.kubernetes.io/component"
+	labelAppPartOf    = "app.kubernetes.io/part-of"
+	labelAppManagedBy = "app.kubernetes.io/managed-by"
+
+	labelHelmChart           = "helm.sh/chart"
+	annotationHelmRelease    = "meta.helm.sh/release-name"
+	annotationHelmReleaseNS  = "meta.helm.sh/release-namespace"
+	labelArgoCDInstance      = "argocd.argoproj.io/instance"
+	annotationArgoCDTracking = "argocd.argoproj.io/tracking-id"
+)
+
+// Annotations are the annotations of owners that the context is read from.
+// Metadata-only informers must keep them for owners to be enriched.
+var Annotations = []string{
+	annotationHelmRelease,
+	annotationHelmReleaseNS,
+	annotationArgoCDTracking,
+}
+
+// Lister finds an object in the informer caches. It returns false if the
+// resource is not watched or the object is not cached.
+type Lister func(gr schema.GroupResource, namespace, name string) (metav1.Object, bool)
+
+// Enricher resolves the owner chain and workload context of audited
+// objects. Owners are read from the informer caches, and from the api
+// server for resources that are not watched.
+type Enricher struct {
+	mapper disco_util.ResourceMapper
+	lister Lister
+	client metadata.Interface
+	cache  *utilcache.LRUExpireCache
+}
+
+// New returns an Enricher. client may be nil, to resolve owners from the
+// informer caches only.
+func New(mapper disco_util.ResourceMapper, lister Lister, client metadata.Interface) *Enricher {
+	return &Enricher{
+		mapper: mapper,
+		lister: lister,
+		client: client,
+		cache:  utilcache.NewLRUExpireCache(ownerCacheSize),
+	}
+}
+
+// Enrich returns the context of the object of an audit event. Owners that
+// can't be found end the chain.
+func (e *Enricher) Enrich(ev *api.Event) *cloudevent.Context {
+	var ctx cloudevent.Context
+	objs := []metav1.Object{ev.Resource}
+	obj := metav1.Object(ev.Resource)
+	for len(ctx.Owners) < maxOwnerDepth {
+		ref := metav1.GetControllerOfNoCopy(obj)
+		if ref == nil {
+			break
+		}
+		ctx.Owners = append(ctx.Owners, cloudevent.Owner{
+			APIVersion: ref.APIVersion,
+			Kind:       ref.Kind,
+			Name:       ref.Name,
+			UID:        ref.UID,
+		})
+		owner, ok := e.owner(obj.GetNamespace(), ref)
+		if !ok {
+			break
+		}
+		objs = append(objs, owner)
+		obj = owner
+	}
+
+	ctx.App = app(objs)
+	ctx.Helm = helm(objs)
+	ctx.ArgoCD = argoCD(objs)
+	if len(ctx.Owners) == 0 && ctx.App == nil && ctx.Helm == nil && ctx.ArgoCD == nil {
+		return nil
+	}
+	return &ctx
+}
+
+// owner finds the object of an owner reference. Owners are in the namespace
+// of the object, or cluster scoped.
+func (e *Enricher) owner(namespace string, ref *metav1.OwnerReference) (metav1.Object, bool) {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return nil, false
+	}
+	gvr, err := e.mapper.GVR(gv.WithKind(ref.Kind))
+	if err != nil {
+		klog.V(5).InfoS("failed to map owner kind", "apiVersion", ref.APIVersion, "kind", ref.Kind, "error", err)
+		return nil, false
+	}
+	if namespaced, err := e.mapper.IsGVRNamespaced(gvr); err == nil && !namespaced {
+		namespace = ""
+	}
+
+	if obj, ok := e.lister(gvr.GroupResource(), namespace, ref.Name); ok {
+		return obj, obj.GetUID() == ref.UID
+	}
+	if e.client == nil {
+		return nil, false
+	}
+	if obj, ok := e.cache.Get(ref.UID); ok {
+		return obj.(metav1.Object), true
+	}
+	obj, err := e.client.Resource(gvr).Namespace(namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+	if err != nil {
+		klog.V(5).InfoS("failed to get owner", "resource", gvr, "namespace", namespace, "name", ref.Name, "error", err)
+		return nil, false
+	}
+	if obj.GetUID() != ref.UID {
+		return nil, false
+	}
+	e.cache.Add(ref.UID, obj, ownerCacheTTL)
+	return obj, true
+}
+
+// lookup returns the first value of the key in the labels or annotations
+// of the objects, starting with the audited object and moving up its
+// owners.
+func lookup(objs []metav1.Object, annotation bool, key string) string {
+	for _, obj := range objs {
+		m := obj.GetLabels()
+		if annotation {
+			m = obj.GetAnnotations()
+		}
+		if v := m[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func app(objs []metav1.Object) *cloudevent.App {
+	a := cloudevent.App{
+		Name:      lookup(objs, false, labelAppName),
+		Instance:  lookup(objs, false, labelAppInstance),
+		Version:   lookup(objs, false, labelAppVersion),
+		Component: lookup(objs, false, labelAppComponent),
+		PartOf:    lookup(objs, false, labelAppPartOf),
+		ManagedBy: lookup(objs, false, labelAppManagedBy),
+	}
+	if a == (cloudevent.App{}) {
+		return nil
+	}
+	return &a
+}
+
+func helm(objs []metav1.Object) *cloudevent.Helm {
+	h := cloudevent.Helm{
+		Release:   lookup(objs, true, annotationHelmRelease),
+		Namespace: lookup(objs, true, annotationHelmReleaseNS),
+		Chart:     lookup(objs, false, labelHelmChart),
+	}
+	if h == (cloudevent.Helm{}) {
+		return nil
+	}
+	return &h
+}
+
+func argoCD(objs []metav1.Object) *cloudevent.ArgoCD {
+	a := cloudevent.ArgoCD{
+		Application: lookup(objs, false, labelArgoCDInstance),
+		TrackingID:  lookup(objs, true, annotationArgoCDTracking),
+	}
+	// the tracking id is <application>:<group>/<kind>:<namespace>/<name>
+	if a.Application == "" && a.TrackingID != "" {
+		a.Application, _, _ = strings.Cut(a.TrackingID, ":")
+	}
+	if a == (cloudevent.ArgoCD{}) {
+		return nil
+	}
+	return &a
+}
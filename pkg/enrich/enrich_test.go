@@ -0,0 +1,108 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package enrich
+
+import (
+	"testing"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+	"kubeops.dev/auditor/pkg/objects"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	disco_util "kmodules.xyz/client-go/discovery"
+)
+
+var (
+	replicaSetGVK = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}
+	deploymentGVK = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	podGVK        = schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+)
+
+func newMapper() disco_util.ResourceMapper {
+	m := meta.NewDefaultRESTMapper([]schema.GroupVersion{podGVK.GroupVersion(), deploymentGVK.GroupVersion()})
+	m.Add(podGVK, meta.RESTScopeNamespace)
+	m.Add(replicaSetGVK, meta.RESTScopeNamespace)
+	m.Add(deploymentGVK, meta.RESTScopeNamespace)
+	return disco_util.NewResourceMapper(m)
+}
+
+func newObject(gvk schema.GroupVersionKind, name string, owner *metav1.PartialObjectMetadata) *metav1.PartialObjectMetadata {
+	m := &metav1.PartialObjectMetadata{}
+	m.SetGroupVersionKind(gvk)
+	m.SetNamespace("demo")
+	m.SetName(name)
+	m.SetUID(types.UID(name + "-uid"))
+	if owner != nil {
+		m.SetOwnerReferences([]metav1.OwnerReference{
+			*metav1.NewControllerRef(owner, owner.GroupVersionKind()),
+		})
+	}
+	return m
+}
+
+// TestEnrichMetadataOnly enriches events from owners cached by metadata-only
+// informers, which keep only some annotations.
+func TestEnrichMetadataOnly(t *testing.T) {
+	deploy := newObject(deploymentGVK, "web", nil)
+	deploy.SetLabels(map[string]string{labelHelmChart: "web-1.0.0"})
+	deploy.SetAnnotations(map[string]string{
+		annotationHelmRelease:                              "web",
+		annotationHelmReleaseNS:                            "demo",
+		annotationArgoCDTracking:                           "apps:apps/Deployment:demo/web",
+		"kubectl.kubernetes.io/last-applied-configuration": "{}",
+	})
+	rs := newObject(replicaSetGVK, "web-abc", deploy)
+	pod := newObject(podGVK, "web-abc-xyz", rs)
+
+	cached := map[string]metav1.Object{}
+	trim := objects.MetadataTrimmer(Annotations...)
+	for _, obj := range []*metav1.PartialObjectMetadata{deploy.DeepCopy(), rs.DeepCopy()} {
+		trimmed, err := trim(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o := trimmed.(*metav1.PartialObjectMetadata)
+		cached[o.Name] = o
+	}
+	if _, ok := cached["web"].GetAnnotations()["kubectl.kubernetes.io/last-applied-configuration"]; ok {
+		t.Fatal("expected other annotations to be trimmed")
+	}
+
+	e := New(newMapper(), func(_ schema.GroupResource, _, name string) (metav1.Object, bool) {
+		obj, ok := cached[name]
+		return obj, ok
+	}, nil)
+	ctx := e.Enrich(&api.Event{Resource: pod})
+	if ctx == nil {
+		t.Fatal("expected a context")
+	}
+	if len(ctx.Owners) != 2 || ctx.Owners[0].Name != "web-abc" || ctx.Owners[1].Name != "web" {
+		t.Errorf("owners = %+v, want web-abc and web", ctx.Owners)
+	}
+	wantHelm := cloudevent.Helm{Release: "web", Namespace: "demo", Chart: "web-1.0.0"}
+	if ctx.Helm == nil || *ctx.Helm != wantHelm {
+		t.Errorf("helm = %+v, want %+v", ctx.Helm, wantHelm)
+	}
+	wantArgoCD := cloudevent.ArgoCD{Application: "apps", TrackingID: "apps:apps/Deployment:demo/web"}
+	if ctx.ArgoCD == nil || *ctx.ArgoCD != wantArgoCD {
+		t.Errorf("argocd = %+v, want %+v", ctx.ArgoCD, wantArgoCD)
+	}
+}
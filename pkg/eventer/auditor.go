@@ -0,0 +1,80 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventer
+
+import (
+	"context"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"kmodules.xyz/client-go/meta"
+)
+
+// Recorder records events about the health of the audit pipeline. Events
+// are attached to the auditor pod, so that `kubectl describe pod` shows
+// them. Outside a cluster, events are only logged.
+type Recorder struct {
+	recorder record.EventRecorder
+	ref      *core.ObjectReference
+}
+
+// NewRecorder returns a Recorder for the pod the auditor runs in.
+func NewRecorder(client kubernetes.Interface, component string) *Recorder {
+	r := &Recorder{
+		recorder: NewEventRecorder(client, component),
+	}
+	pod, err := client.CoreV1().Pods(meta.PodNamespace()).Get(context.TODO(), meta.PodName(), metav1.GetOptions{})
+	if err != nil {
+		klog.InfoS("auditor pod not found, pipeline events will only be logged", "error", err)
+		return r
+	}
+	r.ref = &core.ObjectReference{
+		APIVersion:      "v1",
+		Kind:            "Pod",
+		Namespace:       pod.Namespace,
+		Name:            pod.Name,
+		UID:             pod.UID,
+		ResourceVersion: pod.ResourceVersion,
+	}
+	return r
+}
+
+// NewLogRecorder returns a Recorder that only logs events.
+func NewLogRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Event records an event. It is a no-op on a nil Recorder.
+func (r *Recorder) Event(eventtype, reason, message string) {
+	if r == nil {
+		return
+	}
+	if r.ref == nil {
+		klog.InfoS(message, "type", eventtype, "reason", reason)
+		return
+	}
+	r.recorder.Event(r.ref, eventtype, reason, message)
+}
+
+// Eventf is like Event, but with a formatted message.
+func (r *Recorder) Eventf(eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
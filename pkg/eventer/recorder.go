@@ -32,29 +32,13 @@ import (
 )
 
 const (
-	EventReasonInvalidRestic                          = "InvalidRestic"
-	EventReasonInvalidRecovery                        = "InvalidRecovery"
-	EventReasonInvalidCronExpression                  = "InvalidCronExpression"
-	EventReasonSuccessfulCronExpressionReset          = "SuccessfulCronExpressionReset"
-	EventReasonSuccessfulBackup                       = "SuccessfulBackup"
-	EventReasonFailedToBackup                         = "FailedBackup"
-	EventReasonSuccessfulRecovery                     = "SuccessfulRecovery"
-	EventReasonFailedToRecover                        = "FailedRecovery"
-	EventReasonSuccessfulCheck                        = "SuccessfulCheck"
-	EventReasonFailedToCheck                          = "FailedCheck"
-	EventReasonFailedToRetention                      = "FailedRetention"
-	EventReasonFailedToStart                          = "FailedToStart"
-	EventReasonFailedToUpdate                         = "FailedToUpdate"
-	EventReasonFailedCronJob                          = "FailedCronJob"
-	EventReasonFailedToDelete                         = "FailedToDelete"
-	EventReasonJobCreated                             = "RecoveryJobCreated"
-	EventReasonJobFailedToCreate                      = "RecoveryJobFailedToCreate"
-	EventReasonCheckJobCreated                        = "CheckJobCreated"
-	EventReasonFailedSetup                            = "SetupFailed"
-	EventReasonAdmissionWebhookNotActivated    string = "AdmissionWebhookNotActivated"
-	EventReasonStatsServiceDeleteSuccessful           = "StatsServiceDeleteSuccessful"
-	EventReasonStatsServiceReconcileFailed            = "StatsServiceReconcileFailed"
-	EventReasonStatsServiceReconcileSuccessful        = "StatsServiceReconcileSuccessful"
+	EventReasonPolicyLoaded     = "PolicyLoaded"
+	EventReasonPolicyInvalid    = "PolicyInvalid"
+	EventReasonWatchStarted     = "WatchStarted"
+	EventReasonWatchFailed      = "WatchFailed"
+	EventReasonSinkDisconnected = "SinkDisconnected"
+	EventReasonSinkRecovered    = "SinkRecovered"
+	EventReasonEventsDropped    = "EventsDropped"
 )
 
 func NewEventRecorder(client kubernetes.Interface, component string) record.EventRecorder {
@@ -0,0 +1,51 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package license
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	verifier "go.bytebuilders.dev/license-verifier"
+	"go.bytebuilders.dev/license-verifier/apis/licenses/v1alpha1"
+	"go.bytebuilders.dev/license-verifier/info"
+)
+
+// VerifyOffline verifies the license in licenseFile for the cluster against
+// the license CA embedded in the binary. Unlike the registration flow, it
+// never contacts the license server or the license proxy server, so it works
+// in disconnected clusters.
+func VerifyOffline(licenseFile, clusterUID string) (*v1alpha1.License, error) {
+	if info.LicenseCA == "" {
+		return nil, errors.New("offline mode requires a build with an embedded license CA")
+	}
+	data, err := os.ReadFile(licenseFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read license: %v", err)
+	}
+	l, err := verifier.VerifyLicense(verifier.Options{
+		ClusterUID: clusterUID,
+		Features:   info.ProductName,
+		CACert:     []byte(info.LicenseCA),
+		License:    data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid license: %v", err)
+	}
+	return &l, nil
+}
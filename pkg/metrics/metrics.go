@@ -0,0 +1,171 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const namespace = "auditor"
+
+// Reasons of filtered informer notifications.
+const (
+	// FilterUnchanged is an update that didn't change the object generation.
+	FilterUnchanged = "Unchanged"
+	// FilterDuplicate is an object the dedupe tracker has already published.
+	FilterDuplicate = "Duplicate"
+	// FilterUnrouted is an event that matches no route.
+	FilterUnrouted = "Unrouted"
+	// FilterStale is an event superseded by a newer version of the object.
+	FilterStale = "Stale"
+)
+
+var (
+	eventLabels    = []string{"group", "version", "kind", "type"}
+	filterLabels   = []string{"group", "version", "kind", "type", "reason"}
+	resourceLabels = []string{"group", "version", "resource"}
+
+	EventsObserved = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Name:           "events_observed_total",
+			Help:           "Number of informer notifications received for audited resources",
+			StabilityLevel: metrics.ALPHA,
+		},
+		eventLabels,
+	)
+	EventsFiltered = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Name:           "events_filtered_total",
+			Help:           "Number of informer notifications that did not result in an audit event, by reason: Unchanged, Duplicate, Unrouted or Stale",
+			StabilityLevel: metrics.ALPHA,
+		},
+		filterLabels,
+	)
+	EventsPublished = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Name:           "events_published_total",
+			Help:           "Number of audit events delivered to the sink",
+			StabilityLevel: metrics.ALPHA,
+		},
+		eventLabels,
+	)
+	EventsFailed = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Name:           "events_failed_total",
+			Help:           "Number of audit events that could not be built or delivered to the sink",
+			StabilityLevel: metrics.ALPHA,
+		},
+		eventLabels,
+	)
+	EventsDropped = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Name:           "events_dropped_total",
+			Help:           "Number of audit events discarded without a delivery attempt because no sink was connected",
+			StabilityLevel: metrics.ALPHA,
+		},
+		eventLabels,
+	)
+	PublishDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      namespace,
+			Name:           "publish_duration_seconds",
+			Help:           "Time taken to deliver an audit event to the sink, including retries",
+			Buckets:        metrics.ExponentialBuckets(0.001, 2, 15),
+			StabilityLevel: metrics.ALPHA,
+		},
+		eventLabels,
+	)
+	PublishQueueDepth = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace:      namespace,
+			Name:           "publish_queue_depth",
+			Help:           "Number of audit events waiting to be delivered to the sink",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+	SinkConnected = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace:      namespace,
+			Name:           "sink_connected",
+			Help:           "Whether the auditor is connected to its sink",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+	SinkReconnects = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Name:           "sink_reconnects_total",
+			Help:           "Number of times the connection to the sink was re-established",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+	InformerSynced = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      namespace,
+			Name:           "informer_synced",
+			Help:           "Whether the informer of an audited resource has synced",
+			StabilityLevel: metrics.ALPHA,
+		},
+		resourceLabels,
+	)
+)
+
+var registerMetrics sync.Once
+
+// Register registers the audit pipeline metrics with the legacy registry,
+// which is served by the generic api server on /metrics.
+func Register() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(
+			EventsObserved,
+			EventsFiltered,
+			EventsPublished,
+			EventsFailed,
+			EventsDropped,
+			PublishDuration,
+			PublishQueueDepth,
+			SinkConnected,
+			SinkReconnects,
+			InformerSynced,
+		)
+	})
+}
+
+// EventLabels returns the label values of an event metric.
+func EventLabels(gvk schema.GroupVersionKind, et api.EventType) []string {
+	return []string{gvk.Group, gvk.Version, gvk.Kind, string(et)}
+}
+
+// FilterLabels returns the label values of a filtered event.
+func FilterLabels(gvk schema.GroupVersionKind, et api.EventType, reason string) []string {
+	return append(EventLabels(gvk, et), reason)
+}
+
+// ResourceLabels returns the label values of a resource metric.
+func ResourceLabels(gvr schema.GroupVersionResource) []string {
+	return []string{gvr.Group, gvr.Version, gvr.Resource}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objects
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"kubeops.dev/auditor/pkg/pipeline"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	"go.bytebuilders.dev/audit/lib"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	fetchCacheSize = 1024
+	fetchCacheTTL  = time.Minute
+)
+
+// ErrStale is returned when the object has moved on to a newer generation
+// since the notification. The notification of that generation follows.
+var ErrStale = errors.New("object changed since the notification")
+
+// Fetcher reads the full object for notifications of metadata-only
+// informers. Recently fetched objects are cached by resource version, so
+// the notification of a newer version that was already fetched doesn't
+// fetch it again.
+type Fetcher struct {
+	client dynamic.Interface
+	gvr    schema.GroupVersionResource
+	cache  *utilcache.LRUExpireCache
+	// ahead holds the generation of objects whose stale notification was
+	// resolved to a newer generation, by uid.
+	ahead *utilcache.LRUExpireCache
+}
+
+func NewFetcher(client dynamic.Interface, gvr schema.GroupVersionResource) *Fetcher {
+	return &Fetcher{
+		client: client,
+		gvr:    gvr,
+		cache:  utilcache.NewLRUExpireCache(fetchCacheSize),
+		ahead:  utilcache.NewLRUExpireCache(fetchCacheSize),
+	}
+}
+
+// Resolver returns a function that builds the event of the full object for
+// an event built from object metadata, and returns the actor of the change,
+// see pipeline.Actor.
+//
+// If the object moved on to a newer generation since the notification, the
+// event is resolved to the newer generation under the event type of the
+// notification, so that no create is lost. The update notification of that
+// generation then resolves to nil.
+func (f *Fetcher) Resolver(fn lib.EventCreator) func(ev *api.Event, et api.EventType) (*api.Event, string, error) {
+	return func(ev *api.Event, et api.EventType) (*api.Event, string, error) {
+		obj := ev.Resource
+		if gen, ok := f.ahead.Get(string(obj.GetUID())); ok && et == api.EventUpdated && obj.GetGeneration() <= gen.(int64) {
+			klog.V(5).InfoS("skipping event of a generation that was already resolved", "resource", f.gvr, "namespace", obj.GetNamespace(), "name", obj.GetName())
+			return nil, "", nil
+		}
+
+		full, err := f.Fetch(obj)
+		if errors.Is(err, ErrStale) {
+			klog.V(5).InfoS("resolving event of a stale object to its newer generation", "resource", f.gvr, "namespace", obj.GetNamespace(), "name", obj.GetName())
+			f.ahead.Add(string(full.GetUID()), full.GetGeneration(), fetchCacheTTL)
+		} else if err != nil {
+			return nil, "", err
+		}
+		actor := pipeline.Actor(full)
+		full.SetManagedFields(nil)
+		out, err := fn(full)
+		return out, actor, err
+	}
+}
+
+// Fetch returns the full object of the notified metadata. If the object has
+// changed since the notification, it is cached under its own resource
+// version for the notification that follows. Objects that moved on to a
+// newer generation are returned with ErrStale. Objects that only changed
+// their status or metadata are returned without an error, as are objects
+// without a generation, whose later changes are never notified as audit
+// events.
+func (f *Fetcher) Fetch(obj client.Object) (client.Object, error) {
+	key := string(obj.GetUID()) + "/" + obj.GetResourceVersion()
+	if u, ok := f.cache.Get(key); ok {
+		return u.(*unstructured.Unstructured).DeepCopy(), nil
+	}
+
+	u, err := f.client.Resource(f.gvr).Namespace(obj.GetNamespace()).Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+	if kerr.IsNotFound(err) || (err == nil && u.GetUID() != obj.GetUID()) {
+		klog.V(5).InfoS("object is gone, using its metadata", "resource", f.gvr, "namespace", obj.GetNamespace(), "name", obj.GetName())
+		return metadataOnly(obj)
+	} else if err != nil {
+		return nil, err
+	}
+
+	f.cache.Add(string(u.GetUID())+"/"+u.GetResourceVersion(), u, fetchCacheTTL)
+	if u.GetResourceVersion() != obj.GetResourceVersion() && u.GetGeneration() != obj.GetGeneration() {
+		return u.DeepCopy(), fmt.Errorf("%w: %s %s/%s is at generation %d, not %d", ErrStale, f.gvr, obj.GetNamespace(), obj.GetName(), u.GetGeneration(), obj.GetGeneration())
+	}
+	return u.DeepCopy(), nil
+}
+
+func metadataOnly(obj client.Object) (client.Object, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(obj.GetObjectKind().GroupVersionKind())
+	return u, nil
+}
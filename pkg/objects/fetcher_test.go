@@ -0,0 +1,181 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objects
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var deploymentGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+func newFakeClient(objs ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		deploymentGVR: "DeploymentList",
+	}, objs...)
+}
+
+// notified returns the metadata of obj, as seen by a metadata informer.
+func notified(obj *unstructured.Unstructured, resourceVersion string, generation int64) *metav1.PartialObjectMetadata {
+	m := &metav1.PartialObjectMetadata{}
+	m.SetGroupVersionKind(obj.GroupVersionKind())
+	m.SetNamespace(obj.GetNamespace())
+	m.SetName(obj.GetName())
+	m.SetUID(obj.GetUID())
+	m.SetResourceVersion(resourceVersion)
+	m.SetGeneration(generation)
+	return m
+}
+
+func gets(c *dynamicfake.FakeDynamicClient) int {
+	n := 0
+	for _, a := range c.Actions() {
+		if a.GetVerb() == "get" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFetch(t *testing.T) {
+	obj := newDeployment(1)
+	c := newFakeClient(obj)
+	f := NewFetcher(c, deploymentGVR)
+
+	// the object changed its status since the notification
+	full, err := f.Fetch(notified(obj, "1", obj.GetGeneration()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.GetName() != obj.GetName() {
+		t.Errorf("name = %s, want %s", full.GetName(), obj.GetName())
+	}
+
+	// the fetched object is cached under its own resource version
+	if _, err := f.Fetch(notified(obj, full.GetResourceVersion(), obj.GetGeneration())); err != nil {
+		t.Fatal(err)
+	}
+	if n := gets(c); n != 1 {
+		t.Errorf("got %d GET requests, want 1", n)
+	}
+}
+
+func TestFetchStale(t *testing.T) {
+	obj := newDeployment(1)
+	f := NewFetcher(newFakeClient(obj), deploymentGVR)
+
+	full, err := f.Fetch(notified(obj, "1", obj.GetGeneration()-1))
+	if !errors.Is(err, ErrStale) {
+		t.Fatalf("expected ErrStale, got %v", err)
+	}
+	if full == nil || full.GetGeneration() != obj.GetGeneration() {
+		t.Fatalf("expected the newer object with ErrStale, got %v", full)
+	}
+}
+
+func TestResolverStale(t *testing.T) {
+	obj := newDeployment(1)
+	c := newFakeClient(obj)
+	stored, err := c.Resource(deploymentGVR).Namespace(obj.GetNamespace()).Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolve := NewFetcher(c, deploymentGVR).Resolver(func(obj client.Object) (*api.Event, error) {
+		return &api.Event{Resource: obj}, nil
+	})
+
+	// the object was updated before its create was resolved
+	ev, _, err := resolve(&api.Event{Resource: notified(obj, "1", obj.GetGeneration()-1)}, api.EventCreated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev == nil || ev.Resource.GetGeneration() != obj.GetGeneration() {
+		t.Fatalf("expected the create to resolve to the newer generation, got %v", ev)
+	}
+
+	// the update to that generation was published with the create
+	latest := notified(obj, stored.GetResourceVersion(), obj.GetGeneration())
+	ev, _, err = resolve(&api.Event{Resource: latest}, api.EventUpdated)
+	if err != nil || ev != nil {
+		t.Fatalf("expected the update to resolve to nil, got %v, %v", ev, err)
+	}
+	if n := gets(c); n != 2 {
+		t.Errorf("got %d GET requests, want 2", n)
+	}
+
+	// but the delete is not skipped
+	ev, _, err = resolve(&api.Event{Resource: latest}, api.EventDeleted)
+	if err != nil || ev == nil {
+		t.Fatalf("expected the delete to resolve, got %v, %v", ev, err)
+	}
+}
+
+func TestFetchGone(t *testing.T) {
+	obj := newDeployment(1)
+	f := NewFetcher(newFakeClient(), deploymentGVR)
+
+	full, err := f.Fetch(notified(obj, "1", obj.GetGeneration()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.GetUID() != obj.GetUID() {
+		t.Errorf("uid = %s, want %s", full.GetUID(), obj.GetUID())
+	}
+	if _, found, _ := unstructured.NestedMap(full.(*unstructured.Unstructured).Object, "spec"); found {
+		t.Error("expected only the metadata of a deleted object")
+	}
+}
+
+func TestResolver(t *testing.T) {
+	obj := newDeployment(1)
+	older, newer := metav1.Unix(1000, 0), metav1.Unix(2000, 0)
+	obj.SetManagedFields([]metav1.ManagedFieldsEntry{
+		{Manager: "kube-controller-manager", Operation: metav1.ManagedFieldsOperationUpdate, Time: &older},
+		{Manager: "kubectl-edit", Operation: metav1.ManagedFieldsOperationUpdate, Time: &newer},
+	})
+	c := newFakeClient(obj)
+	stored, err := c.Resource(deploymentGVR).Namespace(obj.GetNamespace()).Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolve := NewFetcher(c, deploymentGVR).Resolver(func(obj client.Object) (*api.Event, error) {
+		return &api.Event{Resource: obj}, nil
+	})
+	ev, actor, err := resolve(&api.Event{Resource: notified(obj, stored.GetResourceVersion(), obj.GetGeneration())}, api.EventCreated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actor != "kubectl-edit" {
+		t.Errorf("actor = %q, want kubectl-edit", actor)
+	}
+	if len(ev.Resource.GetManagedFields()) != 0 {
+		t.Error("expected the managed fields to be removed")
+	}
+	if _, found, _ := unstructured.NestedMap(ev.Resource.(*unstructured.Unstructured).Object, "spec"); !found {
+		t.Error("expected the full object")
+	}
+}
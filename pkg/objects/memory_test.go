@@ -0,0 +1,138 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objects
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+const benchmarkObjects = 5000
+
+func newDeployment(i int) *unstructured.Unstructured {
+	containers := make([]interface{}, 0, 3)
+	for c := 0; c < 3; c++ {
+		containers = append(containers, map[string]interface{}{
+			"name":  fmt.Sprintf("container-%d", c),
+			"image": fmt.Sprintf("registry.example.com/team/app-%d:v1.2.%d", c, i),
+			"args":  []interface{}{"--config=/etc/app/config.yaml", "--log-level=info", "--metrics-addr=:8080"},
+			"env": []interface{}{
+				map[string]interface{}{"name": "POD_NAME", "valueFrom": map[string]interface{}{"fieldRef": map[string]interface{}{"fieldPath": "metadata.name"}}},
+				map[string]interface{}{"name": "POD_NAMESPACE", "valueFrom": map[string]interface{}{"fieldRef": map[string]interface{}{"fieldPath": "metadata.namespace"}}},
+			},
+			"resources": map[string]interface{}{
+				"limits":   map[string]interface{}{"cpu": "500m", "memory": "512Mi"},
+				"requests": map[string]interface{}{"cpu": "100m", "memory": "128Mi"},
+			},
+		})
+	}
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":              fmt.Sprintf("app-%d", i),
+			"namespace":         fmt.Sprintf("team-%d", i%50),
+			"uid":               fmt.Sprintf("00000000-0000-0000-0000-%012d", i),
+			"resourceVersion":   fmt.Sprint(100000 + i),
+			"generation":        int64(3),
+			"creationTimestamp": "2023-01-01T00:00:00Z",
+			"labels":            map[string]interface{}{"app.kubernetes.io/name": "app", "app.kubernetes.io/instance": fmt.Sprintf("app-%d", i)},
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app.kubernetes.io/instance": fmt.Sprintf("app-%d", i)}},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app.kubernetes.io/instance": fmt.Sprintf("app-%d", i)}},
+				"spec":     map[string]interface{}{"containers": containers},
+			},
+		},
+		"status": map[string]interface{}{
+			"replicas":           int64(2),
+			"readyReplicas":      int64(2),
+			"observedGeneration": int64(3),
+		},
+	}}
+	applied, _ := json.Marshal(u.Object)
+	u.SetAnnotations(map[string]string{"kubectl.kubernetes.io/last-applied-configuration": string(applied)})
+	return u
+}
+
+func toMetadata(u *unstructured.Unstructured) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{
+		TypeMeta: metav1.TypeMeta{APIVersion: "meta.k8s.io/v1", Kind: "PartialObjectMetadata"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            u.GetName(),
+			Namespace:       u.GetNamespace(),
+			UID:             types.UID(u.GetUID()),
+			ResourceVersion: u.GetResourceVersion(),
+			Generation:      u.GetGeneration(),
+			Labels:          u.GetLabels(),
+			Annotations:     u.GetAnnotations(),
+		},
+	}
+}
+
+func heapInUse() uint64 {
+	runtime.GC()
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// BenchmarkInformerCacheMemory reports the heap used by an informer cache
+// holding full objects, as the dynamic informers do, compared to one holding
+// only their metadata, as in --metadata-only mode. Run with
+//
+//	go test -run=^$ -bench=InformerCacheMemory ./pkg/objects/
+func BenchmarkInformerCacheMemory(b *testing.B) {
+	cases := []struct {
+		name    string
+		convert func(*unstructured.Unstructured) interface{}
+	}{
+		{name: "full", convert: func(u *unstructured.Unstructured) interface{} { return u }},
+		{name: "metadata-only", convert: func(u *unstructured.Unstructured) interface{} {
+			obj, _ := TrimMetadata(toMetadata(u))
+			return obj
+		}},
+	}
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			var perObject float64
+			for n := 0; n < b.N; n++ {
+				before := heapInUse()
+				store := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+				for i := 0; i < benchmarkObjects; i++ {
+					if err := store.Add(tc.convert(newDeployment(i))); err != nil {
+						b.Fatal(err)
+					}
+				}
+				after := heapInUse()
+				perObject = float64(after-before) / benchmarkObjects
+				runtime.KeepAlive(store)
+			}
+			b.ReportMetric(perObject, "heap-bytes/object")
+		})
+	}
+}
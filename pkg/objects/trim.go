@@ -0,0 +1,119 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objects
+
+import (
+	"strings"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	"go.bytebuilders.dev/audit/lib"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ParseFieldPaths parses dot separated field paths, like
+// "metadata.annotations". Use "\." for dots inside a field name, like
+// "metadata.annotations.kubectl\.kubernetes\.io/last-applied-configuration".
+func ParseFieldPaths(paths []string) [][]string {
+	result := make([][]string, 0, len(paths))
+	for _, p := range paths {
+		var fields []string
+		var cur strings.Builder
+		for i := 0; i < len(p); i++ {
+			switch {
+			case p[i] == '\\' && i+1 < len(p) && p[i+1] == '.':
+				cur.WriteByte('.')
+				i++
+			case p[i] == '.':
+				fields = append(fields, cur.String())
+				cur.Reset()
+			default:
+				cur.WriteByte(p[i])
+			}
+		}
+		fields = append(fields, cur.String())
+		result = append(result, fields)
+	}
+	return result
+}
+
+// TrimmingEventCreator returns an event creator that removes the given
+// fields from objects before calling fn.
+func TrimmingEventCreator(fields [][]string, fn lib.EventCreator) lib.EventCreator {
+	if len(fields) == 0 {
+		return fn
+	}
+	return func(obj client.Object) (*api.Event, error) {
+		trimmed, err := Trim(obj, fields)
+		if err != nil {
+			return nil, err
+		}
+		return fn(trimmed)
+	}
+}
+
+// Trim removes the given fields from obj. obj may be modified.
+func Trim(obj client.Object, fields [][]string) (client.Object, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		u = &unstructured.Unstructured{Object: content}
+		u.SetGroupVersionKind(obj.GetObjectKind().GroupVersionKind())
+	}
+	for _, f := range fields {
+		unstructured.RemoveNestedField(u.Object, f...)
+	}
+	return u, nil
+}
+
+// TrimMetadata is a cache.TransformFunc for metadata-only informers. It
+// drops the fields that are not needed to detect changes, so that they are
+// not kept in the informer cache.
+func TrimMetadata(obj interface{}) (interface{}, error) {
+	return trimMetadata(obj, nil)
+}
+
+// MetadataTrimmer is like TrimMetadata, and keeps the given annotations,
+// like the ones that events are enriched with.
+func MetadataTrimmer(annotations ...string) cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		return trimMetadata(obj, annotations)
+	}
+}
+
+func trimMetadata(obj interface{}, keep []string) (interface{}, error) {
+	if m, ok := obj.(*metav1.PartialObjectMetadata); ok {
+		m.ManagedFields = nil
+		var annotations map[string]string
+		for _, k := range keep {
+			if v, ok := m.Annotations[k]; ok {
+				if annotations == nil {
+					annotations = map[string]string{}
+				}
+				annotations[k] = v
+			}
+		}
+		m.Annotations = annotations
+	}
+	return obj, nil
+}
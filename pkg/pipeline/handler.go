@@ -0,0 +1,147 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	"go.bytebuilders.dev/audit/lib"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Consumer receives the audit events built from informer notifications,
+// and the actor of the change, see Actor.
+type Consumer func(ev *api.Event, et api.EventType, actor string)
+
+// Observer is notified about every informer notification, including the ones
+// that don't result in an audit event.
+type Observer interface {
+	Observed(et api.EventType)
+	Filtered(et api.EventType)
+	Failed(et api.EventType, err error)
+}
+
+// ForGVK returns an informer event handler that turns notifications for the
+// given kind into audit events, following the same rules as
+// lib.EventPublisher: updates that don't change the generation are skipped
+// and deletes are recovered from tombstones.
+func ForGVK(gvk schema.GroupVersionKind, createEvent lib.EventCreator, consume Consumer, observers ...Observer) cache.ResourceEventHandler {
+	if gvk.Version == "" || gvk.Kind == "" {
+		panic(fmt.Sprintf("incomplete GVK; %+v", gvk))
+	}
+
+	return &eventHandler{
+		createEvent: func(obj client.Object) (*api.Event, error) {
+			r := obj.DeepCopyObject().(client.Object)
+			r.GetObjectKind().SetGroupVersionKind(gvk)
+			r.SetManagedFields(nil)
+			return createEvent(r)
+		},
+		consume:   consume,
+		observers: observers,
+	}
+}
+
+type eventHandler struct {
+	createEvent lib.EventCreator
+	consume     Consumer
+	observers   []Observer
+}
+
+var _ cache.ResourceEventHandler = &eventHandler{}
+
+func (h *eventHandler) OnAdd(o interface{}) {
+	if obj, ok := o.(client.Object); ok {
+		h.handle(obj, api.EventCreated)
+	}
+}
+
+func (h *eventHandler) OnUpdate(oldObj, newObj interface{}) {
+	uOld, ok := oldObj.(client.Object)
+	if !ok {
+		return
+	}
+	uNew, ok := newObj.(client.Object)
+	if !ok {
+		return
+	}
+	if uOld.GetUID() == uNew.GetUID() && uOld.GetGeneration() == uNew.GetGeneration() {
+		for _, o := range h.observers {
+			o.Observed(api.EventUpdated)
+			o.Filtered(api.EventUpdated)
+		}
+		return
+	}
+	h.handle(uNew, api.EventUpdated)
+}
+
+func (h *eventHandler) OnDelete(obj interface{}) {
+	object, ok := obj.(client.Object)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			klog.V(5).Info("error decoding object, invalid type")
+			return
+		}
+		if object, ok = tombstone.Obj.(client.Object); !ok {
+			klog.V(5).Info("error decoding object tombstone, invalid type")
+			return
+		}
+	}
+	h.handle(object, api.EventDeleted)
+}
+
+func (h *eventHandler) handle(obj client.Object, et api.EventType) {
+	for _, o := range h.observers {
+		o.Observed(et)
+	}
+	ev, err := h.createEvent(obj)
+	if err != nil {
+		for _, o := range h.observers {
+			o.Failed(et, err)
+		}
+		klog.V(5).InfoS("failed to create event data", "error", err)
+		return
+	}
+	var actor string
+	if et != api.EventDeleted {
+		actor = Actor(obj)
+	}
+	h.consume(ev, et, actor)
+}
+
+// Actor returns the field manager that changed the object last, or an empty
+// string if the object has no managed fields. Deletes are not recorded in
+// managed fields, so the actor of a delete is unknown.
+func Actor(obj client.Object) string {
+	var actor string
+	var last time.Time
+	for _, f := range obj.GetManagedFields() {
+		if f.Time == nil {
+			continue
+		}
+		if t := f.Time.Time; actor == "" || !t.Before(last) {
+			actor, last = f.Manager, t
+		}
+	}
+	return actor
+}
@@ -0,0 +1,79 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/yaml"
+)
+
+// ServerPreferredResources returns the preferred resources of the cluster,
+// ignoring api groups that failed discovery.
+func ServerPreferredResources(disco discovery.DiscoveryInterface) ([]*metav1.APIResourceList, error) {
+	rsLists, err := disco.ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	return rsLists, nil
+}
+
+// LoadDiscoveryDump reads cached discovery data. path is either a file with
+// a list of APIResourceLists, or a kubectl discovery cache directory
+// containing serverresources.json files.
+func LoadDiscoveryDump(path string) ([]*metav1.APIResourceList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var rsLists []*metav1.APIResourceList
+		if err = yaml.Unmarshal(data, &rsLists); err != nil {
+			return nil, err
+		}
+		return rsLists, nil
+	}
+
+	var rsLists []*metav1.APIResourceList
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != "serverresources.json" {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var rsList metav1.APIResourceList
+		if err = yaml.Unmarshal(data, &rsList); err != nil {
+			return err
+		}
+		rsLists = append(rsLists, &rsList)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rsLists, nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestLoadDiscoveryDump(t *testing.T) {
+	want := testResources()
+
+	file := filepath.Join(t.TempDir(), "discovery.yaml")
+	data, err := yaml.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a kubectl discovery cache has a serverresources.json per group version
+	cache := t.TempDir()
+	for _, rsList := range want {
+		dir := filepath.Join(cache, filepath.FromSlash(rsList.GroupVersion))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(rsList)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "serverresources.json"), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(cache, "servergroups.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, path := range map[string]string{"file": file, "cache directory": cache} {
+		t.Run(name, func(t *testing.T) {
+			got, err := LoadDiscoveryDump(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(indexResources(got), indexResources(want)) {
+				t.Errorf("LoadDiscoveryDump() = %v, want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := LoadDiscoveryDump(filepath.Join(cache, "missing")); err == nil {
+		t.Error("loaded a missing discovery dump")
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"path"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kmodules.xyz/custom-resources/apis/auditor/v1alpha1"
+)
+
+// CoreGroup is the name used in group patterns for the core ("") api group.
+const CoreGroup = "core"
+
+// Generate builds a policy watching every watchable resource of the groups
+// matching include and not matching exclude. An empty include matches all
+// groups. Patterns use path.Match syntax, e.g. "*.kubedb.com".
+func Generate(rsLists []*metav1.APIResourceList, include, exclude []string) (*v1alpha1.AuditRegistration, error) {
+	groups := indexResources(rsLists)
+
+	names := make([]string, 0, len(groups))
+	for group := range groups {
+		name := group
+		if name == "" {
+			name = CoreGroup
+		}
+		ok, err := matchGroup(name, include, exclude)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			names = append(names, group)
+		}
+	}
+	sort.Strings(names)
+
+	p := &v1alpha1.AuditRegistration{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       v1alpha1.ResourceKindAuditRegistration,
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		},
+	}
+	for _, group := range names {
+		var resources []string
+		for name, rs := range groups[group] {
+			if !IsSubresource(name) && Watchable(rs) {
+				resources = append(resources, name)
+			}
+		}
+		if len(resources) == 0 {
+			continue
+		}
+		sort.Strings(resources)
+		p.Resources = append(p.Resources, v1alpha1.GroupResources{
+			Group:     group,
+			Resources: resources,
+		})
+	}
+	return p, nil
+}
+
+func matchGroup(group string, include, exclude []string) (bool, error) {
+	for _, pattern := range exclude {
+		if ok, err := path.Match(pattern, group); err != nil || ok {
+			return false, err
+		}
+	}
+	if len(include) == 0 {
+		return true, nil
+	}
+	for _, pattern := range include {
+		if ok, err := path.Match(pattern, group); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
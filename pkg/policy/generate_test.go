@@ -0,0 +1,93 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	"kmodules.xyz/custom-resources/apis/auditor/v1alpha1"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []v1alpha1.GroupResources
+		wantErr bool
+	}{
+		{
+			name: "all groups",
+			want: []v1alpha1.GroupResources{
+				{Resources: []string{"pods"}},
+				{Group: "apps", Resources: []string{"deployments"}},
+				{Group: "catalog.kubedb.com", Resources: []string{"mysqlversions"}},
+				{Group: "kubedb.com", Resources: []string{"mysqls"}},
+			},
+		},
+		{
+			name:    "core group",
+			include: []string{CoreGroup},
+			want:    []v1alpha1.GroupResources{{Resources: []string{"pods"}}},
+		},
+		{
+			name:    "include pattern",
+			include: []string{"*kubedb.com"},
+			want: []v1alpha1.GroupResources{
+				{Group: "catalog.kubedb.com", Resources: []string{"mysqlversions"}},
+				{Group: "kubedb.com", Resources: []string{"mysqls"}},
+			},
+		},
+		{
+			name:    "exclude wins",
+			include: []string{"*kubedb.com"},
+			exclude: []string{"catalog.*"},
+			want:    []v1alpha1.GroupResources{{Group: "kubedb.com", Resources: []string{"mysqls"}}},
+		},
+		{
+			name:    "no match",
+			include: []string{"stash.appscode.com"},
+		},
+		{
+			name:    "bad pattern",
+			include: []string{"["},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Generate(testResources(), tt.include, tt.exclude)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if p.Kind != v1alpha1.ResourceKindAuditRegistration || p.APIVersion != v1alpha1.SchemeGroupVersion.String() {
+				t.Errorf("Generate() type = %v", p.TypeMeta)
+			}
+			if !reflect.DeepEqual(p.Resources, tt.want) {
+				t.Errorf("Generate() = %v, want %v", p.Resources, tt.want)
+			}
+			// a generated policy is always valid
+			if issues := Validate(p, testResources()); len(issues) > 0 {
+				t.Errorf("generated policy has issues: %v", issues)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	stringz "gomodules.xyz/x/strings"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kmodules.xyz/custom-resources/apis/auditor/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+// Load reads an AuditRegistration policy from a yaml or json file.
+func Load(filename string) (*v1alpha1.AuditRegistration, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %v", err)
+	}
+	var policy v1alpha1.AuditRegistration
+	if err = yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %v", err)
+	}
+	return &policy, nil
+}
+
+// IsSubresource reports whether name refers to a subresource like pods/log.
+func IsSubresource(name string) bool {
+	return strings.ContainsRune(name, '/')
+}
+
+// Watchable reports whether the auditor can run an informer for rs.
+func Watchable(rs metav1.APIResource) bool {
+	return stringz.Contains(rs.Verbs, "list") &&
+		stringz.Contains(rs.Verbs, "get") &&
+		stringz.Contains(rs.Verbs, "watch")
+}
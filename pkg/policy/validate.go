@@ -0,0 +1,92 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"kmodules.xyz/custom-resources/apis/auditor/v1alpha1"
+)
+
+const (
+	ReasonUnknownGroup    = "UnknownGroup"
+	ReasonUnknownResource = "UnknownResource"
+	ReasonNotWatchable    = "NotWatchable"
+	ReasonSubresource     = "Subresource"
+)
+
+// Issue is a policy entry the auditor will not be able to watch.
+type Issue struct {
+	Group    string `json:"group"`
+	Resource string `json:"resource"`
+	Reason   string `json:"reason"`
+}
+
+// Validate resolves every group/resource of the policy against discovery.
+func Validate(p *v1alpha1.AuditRegistration, rsLists []*metav1.APIResourceList) []Issue {
+	groups := indexResources(rsLists)
+
+	var issues []Issue
+	for _, gr := range p.Resources {
+		resources, groupFound := groups[gr.Group]
+		for _, name := range gr.Resources {
+			issue := Issue{Group: gr.Group, Resource: name}
+			switch {
+			case IsSubresource(name):
+				issue.Reason = ReasonSubresource
+			case !groupFound:
+				issue.Reason = ReasonUnknownGroup
+			default:
+				rs, ok := resources[name]
+				if !ok {
+					issue.Reason = ReasonUnknownResource
+				} else if !Watchable(rs) {
+					issue.Reason = ReasonNotWatchable
+				}
+			}
+			if issue.Reason != "" {
+				issues = append(issues, issue)
+			}
+		}
+	}
+	return issues
+}
+
+// indexResources maps group -> resource name -> resource. A resource
+// served by multiple versions is recorded once, preferring a watchable one.
+func indexResources(rsLists []*metav1.APIResourceList) map[string]map[string]metav1.APIResource {
+	groups := map[string]map[string]metav1.APIResource{}
+	for _, rsList := range rsLists {
+		gv, err := schema.ParseGroupVersion(rsList.GroupVersion)
+		if err != nil {
+			continue
+		}
+		resources, ok := groups[gv.Group]
+		if !ok {
+			resources = map[string]metav1.APIResource{}
+			groups[gv.Group] = resources
+		}
+		for _, rs := range rsList.APIResources {
+			if existing, ok := resources[rs.Name]; ok && Watchable(existing) {
+				continue
+			}
+			rs.Group, rs.Version = gv.Group, gv.Version
+			resources[rs.Name] = rs
+		}
+	}
+	return groups
+}
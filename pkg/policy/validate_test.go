@@ -0,0 +1,111 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kmodules.xyz/custom-resources/apis/auditor/v1alpha1"
+)
+
+var watchVerbs = metav1.Verbs{"get", "list", "watch"}
+
+// testResources is the discovery of a small cluster.
+func testResources() []*metav1.APIResourceList {
+	return []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Kind: "Pod", Verbs: watchVerbs},
+				{Name: "pods/log", Kind: "Pod", Verbs: metav1.Verbs{"get"}},
+				{Name: "bindings", Kind: "Binding", Verbs: metav1.Verbs{"create"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Verbs: watchVerbs},
+			},
+		},
+		{
+			GroupVersion: "kubedb.com/v1alpha1",
+			APIResources: []metav1.APIResource{
+				{Name: "mysqls", Kind: "MySQL", Verbs: metav1.Verbs{"get"}},
+			},
+		},
+		// the watchable version of a resource is preferred
+		{
+			GroupVersion: "kubedb.com/v1alpha2",
+			APIResources: []metav1.APIResource{
+				{Name: "mysqls", Kind: "MySQL", Verbs: watchVerbs},
+			},
+		},
+		{
+			GroupVersion: "catalog.kubedb.com/v1alpha1",
+			APIResources: []metav1.APIResource{
+				{Name: "mysqlversions", Kind: "MySQLVersion", Verbs: watchVerbs},
+			},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources []v1alpha1.GroupResources
+		want      []Issue
+	}{
+		{
+			name: "valid",
+			resources: []v1alpha1.GroupResources{
+				{Resources: []string{"pods"}},
+				{Group: "apps", Resources: []string{"deployments"}},
+				{Group: "kubedb.com", Resources: []string{"mysqls"}},
+			},
+		},
+		{
+			name:      "unknown group",
+			resources: []v1alpha1.GroupResources{{Group: "stash.appscode.com", Resources: []string{"tasks"}}},
+			want:      []Issue{{Group: "stash.appscode.com", Resource: "tasks", Reason: ReasonUnknownGroup}},
+		},
+		{
+			name:      "unknown resource",
+			resources: []v1alpha1.GroupResources{{Group: "apps", Resources: []string{"deployments", "daemonsets"}}},
+			want:      []Issue{{Group: "apps", Resource: "daemonsets", Reason: ReasonUnknownResource}},
+		},
+		{
+			name:      "not watchable",
+			resources: []v1alpha1.GroupResources{{Resources: []string{"bindings"}}},
+			want:      []Issue{{Resource: "bindings", Reason: ReasonNotWatchable}},
+		},
+		{
+			name:      "subresource",
+			resources: []v1alpha1.GroupResources{{Resources: []string{"pods/log"}}},
+			want:      []Issue{{Resource: "pods/log", Reason: ReasonSubresource}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &v1alpha1.AuditRegistration{Resources: tt.resources}
+			if got := Validate(p, testResources()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type volumeKey struct {
+	gvk       schema.GroupVersionKind
+	eventType string
+}
+
+// DryRunSink prints a summary of every event instead of sending it, and
+// reports the event volume per kind and event type when closed.
+type DryRunSink struct {
+	out   io.Writer
+	start time.Time
+
+	mu     sync.Mutex
+	counts map[volumeKey]int64
+}
+
+var _ Sink = &DryRunSink{}
+
+func NewDryRunSink(out io.Writer) *DryRunSink {
+	return &DryRunSink{
+		out:    out,
+		start:  time.Now(),
+		counts: map[volumeKey]int64{},
+	}
+}
+
+func (s *DryRunSink) Send(event *cloudevents.Event) error {
+	var payload cloudevent.Payload
+	if err := event.DataAs(&payload); err != nil {
+		return err
+	}
+	if payload.Resource == nil {
+		return fmt.Errorf("event %s has no resource", event.ID())
+	}
+	gvk := payload.Resource.GroupVersionKind()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[volumeKey{gvk: gvk, eventType: event.Type()}]++
+	_, err := fmt.Fprintf(s.out, "%s %s %s %s generation=%d\n",
+		event.Time().Format(time.RFC3339),
+		event.Type(),
+		gvk,
+		objectKey(payload.Resource.GetNamespace(), payload.Resource.GetName()),
+		payload.Resource.GetGeneration(),
+	)
+	return err
+}
+
+// Close writes the volume report.
+func (s *DryRunSink) Close() error {
+	return s.Report(s.out)
+}
+
+// Report writes the number of events and the rate per minute for every kind
+// and event type seen so far.
+func (s *DryRunSink) Report(w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]volumeKey, 0, len(s.counts))
+	var total int64
+	for k, n := range s.counts {
+		keys = append(keys, k)
+		total += n
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].gvk != keys[j].gvk {
+			return keys[i].gvk.String() < keys[j].gvk.String()
+		}
+		return keys[i].eventType < keys[j].eventType
+	})
+
+	elapsed := time.Since(s.start)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Dry run volume report for %s\n", elapsed.Round(time.Second))
+	fmt.Fprintln(tw, "GROUP\tVERSION\tKIND\tTYPE\tEVENTS\tEVENTS/MIN")
+	for _, k := range keys {
+		n := s.counts[k]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%.2f\n", k.gvk.Group, k.gvk.Version, k.gvk.Kind, k.eventType, n, ratePerMinute(n, elapsed))
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t\t\t%d\t%.2f\n", total, ratePerMinute(total, elapsed))
+	return tw.Flush()
+}
+
+func ratePerMinute(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Minutes()
+}
+
+func objectKey(namespace, name string) string {
+	return strings.TrimPrefix(namespace+"/"+name, "/")
+}
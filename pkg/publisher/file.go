@@ -0,0 +1,71 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"os"
+	"sync"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+)
+
+// FileSink appends events to a file as newline delimited structured JSON
+// cloudevents, the format read by `auditor tail --file`.
+type FileSink struct {
+	licenseID string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+var (
+	_ Sink     = &FileSink{}
+	_ Licensed = &FileSink{}
+)
+
+// NewFileSink opens path for appending, creating it if needed. Events are
+// published on behalf of the given license.
+func NewFileSink(path, licenseID string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{licenseID: licenseID, f: f}, nil
+}
+
+func (s *FileSink) LicenseID() string {
+	return s.licenseID
+}
+
+func (s *FileSink) Send(event *cloudevents.Event) error {
+	data, err := cloudevent.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
@@ -0,0 +1,113 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"fmt"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// Mux sends events to named sinks. Several names may share one sink; an
+// event routed to more than one of them is sent to that sink once.
+type Mux struct {
+	sinks map[string]Sink
+}
+
+var (
+	_ Sink     = &Mux{}
+	_ Licensed = &Mux{}
+)
+
+func NewMux(sinks map[string]Sink) *Mux {
+	return &Mux{sinks: sinks}
+}
+
+// SendTo sends the event to every named sink, and returns the errors of the
+// sinks that failed.
+func (m *Mux) SendTo(names []string, event *cloudevents.Event) error {
+	sent := map[Sink]bool{}
+	var errs []error
+	for _, name := range names {
+		sink, ok := m.sinks[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown sink %q", name))
+			continue
+		}
+		if sent[sink] {
+			continue
+		}
+		sent[sink] = true
+		if err := sink.Send(event); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %v", name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Distinct returns the names of the distinct sinks of names, keeping the
+// first name of every sink that is shared.
+func (m *Mux) Distinct(names []string) []string {
+	seen := map[Sink]bool{}
+	distinct := make([]string, 0, len(names))
+	for _, name := range names {
+		if sink, ok := m.sinks[name]; ok {
+			if seen[sink] {
+				continue
+			}
+			seen[sink] = true
+		}
+		distinct = append(distinct, name)
+	}
+	return distinct
+}
+
+// Send sends the event to all sinks.
+func (m *Mux) Send(event *cloudevents.Event) error {
+	names := make([]string, 0, len(m.sinks))
+	for name := range m.sinks {
+		names = append(names, name)
+	}
+	return m.SendTo(names, event)
+}
+
+// LicenseID returns the license of the first licensed sink. All sinks
+// publish on behalf of the same license.
+func (m *Mux) LicenseID() string {
+	for _, sink := range m.sinks {
+		if l, ok := sink.(Licensed); ok {
+			return l.LicenseID()
+		}
+	}
+	return ""
+}
+
+func (m *Mux) Close() error {
+	closed := map[Sink]bool{}
+	var errs []error
+	for _, sink := range m.sinks {
+		if closed[sink] {
+			continue
+		}
+		closed[sink] = true
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
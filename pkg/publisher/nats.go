@@ -0,0 +1,167 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+	"kubeops.dev/auditor/pkg/metrics"
+	"kubeops.dev/auditor/pkg/subject"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	"github.com/nats-io/nats.go"
+	"go.bytebuilders.dev/audit/lib"
+	"k8s.io/klog/v2"
+)
+
+const (
+	natsEventPublishTimeout = 10 * time.Second
+	natsRequestTimeout      = 2 * time.Second
+	// failed requests are retried with an exponential backoff
+	natsRetryInterval    = 100 * time.Millisecond
+	natsMaxRetryInterval = 2 * time.Second
+)
+
+// NatsSink sends events to the NATS subject assigned to the license, or to
+// the subject rendered from a template for every event. Every event is sent
+// as a request and retried until the receiver acknowledges it.
+type NatsSink struct {
+	conn      *natsConn
+	config    *lib.NatsConfig
+	template  *subject.Template
+	clusterID string
+	closeOnce sync.Once
+}
+
+// natsConn counts the sinks that share the connection of a license. The
+// connection is closed with the last of them.
+type natsConn struct {
+	mu   sync.Mutex
+	refs int
+}
+
+var (
+	_ Sink     = &NatsSink{}
+	_ Licensed = &NatsSink{}
+)
+
+func NewNatsSink(config *lib.NatsConfig) *NatsSink {
+	config.Client.SetDisconnectErrHandler(func(_ *nats.Conn, err error) {
+		metrics.SinkConnected.Set(0)
+		if err != nil {
+			klog.V(5).Infof("Disconnected from event receiver due to error: %v", err)
+		} else {
+			klog.V(5).Infof("Disconnected from event receiver")
+		}
+	})
+	config.Client.SetReconnectHandler(func(nc *nats.Conn) {
+		metrics.SinkConnected.Set(1)
+		metrics.SinkReconnects.Inc()
+		klog.V(5).Infof("Reconnected to %s", nc.ConnectedUrl())
+	})
+	return &NatsSink{conn: &natsConn{refs: 1}, config: config}
+}
+
+// NewTemplatedNatsSink returns a NatsSink that sends every event to the
+// subject rendered from tmpl, or to the subject of the license if tmpl is
+// nil.
+func NewTemplatedNatsSink(config *lib.NatsConfig, tmpl *subject.Template, clusterID string) *NatsSink {
+	s := NewNatsSink(config)
+	s.template = tmpl
+	s.clusterID = clusterID
+	return s
+}
+
+// Share returns a NatsSink that uses the connection of s, and sends every
+// event to the subject rendered from tmpl, or to the subject of the license
+// if tmpl is nil. The connection stays open until every sink sharing it is
+// closed.
+func (s *NatsSink) Share(tmpl *subject.Template, clusterID string) *NatsSink {
+	s.conn.mu.Lock()
+	s.conn.refs++
+	s.conn.mu.Unlock()
+	return &NatsSink{conn: s.conn, config: s.config, template: tmpl, clusterID: clusterID}
+}
+
+func (s *NatsSink) LicenseID() string {
+	return s.config.LicenseID
+}
+
+func (s *NatsSink) subject(event *cloudevents.Event) (string, error) {
+	if s.template == nil {
+		return s.config.Subject, nil
+	}
+	data, err := subject.NewData(event, s.config.Subject, s.clusterID)
+	if err != nil {
+		return "", err
+	}
+	return s.template.Execute(data)
+}
+
+func (s *NatsSink) Send(event *cloudevents.Event) error {
+	subj, err := s.subject(event)
+	if err != nil {
+		return err
+	}
+	data, err := cloudevent.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), natsEventPublishTimeout)
+	defer cancel()
+
+	interval := natsRetryInterval
+	for {
+		_, err = s.config.Client.Request(subj, data, natsRequestTimeout)
+		if err == nil {
+			klog.V(5).Infof("Published event `%s` to channel `%s` and acknowledged", event.Type(), subj)
+			return nil
+		}
+		// a closed connection is not reconnected
+		if errors.Is(err, nats.ErrConnectionClosed) {
+			return fmt.Errorf("failed to send event %s: %w", event.ID(), err)
+		}
+		klog.V(5).Infoln(err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to send event %s: %v", event.ID(), err)
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > natsMaxRetryInterval {
+			interval = natsMaxRetryInterval
+		}
+	}
+}
+
+func (s *NatsSink) Close() error {
+	s.closeOnce.Do(func() {
+		s.conn.mu.Lock()
+		defer s.conn.mu.Unlock()
+		if s.conn.refs--; s.conn.refs == 0 {
+			s.config.Client.Close()
+			metrics.SinkConnected.Set(0)
+		}
+	})
+	return nil
+}
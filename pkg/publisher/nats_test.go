@@ -0,0 +1,117 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	api "go.bytebuilders.dev/audit/api/v1"
+	"go.bytebuilders.dev/audit/lib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+func runNatsServer(t *testing.T) *server.Server {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{
+		Host:   "127.0.0.1",
+		Port:   server.RANDOM_PORT,
+		NoLog:  true,
+		NoSigs: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	t.Cleanup(srv.Shutdown)
+	if !srv.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server is not ready for connections")
+	}
+	return srv
+}
+
+func TestNatsSinkShare(t *testing.T) {
+	srv := runNatsServer(t)
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &lib.NatsConfig{LicenseID: "license", Subject: "audit", Client: nc}
+	first := NewNatsSink(cfg)
+	second := first.Share(nil, "cluster")
+	// sinks of the same connection are closed once by a mux
+	mux := NewMux(map[string]Sink{"a": first, "b": second, "c": second})
+
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if nc.IsClosed() {
+		t.Fatal("connection was closed while a sink still uses it")
+	}
+	if err := mux.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !nc.IsClosed() {
+		t.Fatal("connection was not closed with the last sink")
+	}
+}
+
+func TestNatsSinkRetry(t *testing.T) {
+	srv := runNatsServer(t)
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := NewNatsSink(&lib.NatsConfig{LicenseID: "license", Subject: "audit", Client: nc})
+
+	event, err := cloudevent.New(&api.Event{ResourceID: kmapi.ResourceID{Version: "v1", Kind: "ConfigMap"}, Resource: &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "cm", "uid": "uid-1"},
+	}}}, api.EventCreated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nobody receives events on the subject, so every request fails at once
+	errCh := make(chan error, 1)
+	go func() { errCh <- sink.Send(event) }()
+	time.Sleep(time.Second)
+	nc.Close()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, nats.ErrConnectionClosed) {
+			t.Errorf("Send() error = %v, want %v", err, nats.ErrConnectionClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send() kept retrying on a closed connection")
+	}
+	// 100ms, 200ms and 400ms apart
+	if sent := nc.Stats().OutMsgs; sent > 5 {
+		t.Errorf("sent %d requests in a second, want at most 5", sent)
+	}
+}
@@ -0,0 +1,308 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+const (
+	otlpExportTimeout = 10 * time.Second
+	otlpLogsPath      = "/v1/logs"
+	otlpScopeName     = "kubeops.dev/auditor"
+)
+
+// OTLP protocols.
+const (
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http"
+)
+
+// OTLPOptions configure an OTLPSink.
+type OTLPOptions struct {
+	// Endpoint is the host:port of the collector for grpc, or the URL of
+	// the collector for http. The http path defaults to /v1/logs.
+	Endpoint string
+	// Protocol is grpc or http. Defaults to grpc.
+	Protocol string
+	// Insecure disables TLS for grpc.
+	Insecure bool
+	// Headers are sent with every export.
+	Headers map[string]string
+	// Resource are the attributes of the resource that emits the logs,
+	// see ClusterResource.
+	Resource map[string]string
+}
+
+// OTLPSink exports every event as an OpenTelemetry log record to an OTLP
+// collector, over grpc or http with protobuf encoding. The object is the
+// structured body of the log record, and its kind, name and the type of the
+// change are attributes.
+type OTLPSink struct {
+	resource *resourcepb.Resource
+	headers  map[string]string
+
+	conn   *grpc.ClientConn
+	client collogspb.LogsServiceClient
+
+	url  string
+	http *http.Client
+}
+
+var _ Sink = &OTLPSink{}
+
+// NewOTLPSink returns an OTLPSink. Grpc connections are established in the
+// background and don't fail if the collector is unreachable.
+func NewOTLPSink(opts OTLPOptions) (*OTLPSink, error) {
+	s := &OTLPSink{
+		resource: &resourcepb.Resource{Attributes: stringAttributes(opts.Resource)},
+		headers:  opts.Headers,
+	}
+	switch opts.Protocol {
+	case "", OTLPProtocolGRPC:
+		creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+		if opts.Insecure {
+			creds = insecure.NewCredentials()
+		}
+		conn, err := grpc.Dial(opts.Endpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to otlp collector: %v", err)
+		}
+		s.conn = conn
+		s.client = collogspb.NewLogsServiceClient(conn)
+	case OTLPProtocolHTTP:
+		u, err := url.Parse(opts.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid otlp http endpoint %q", opts.Endpoint)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = otlpLogsPath
+		}
+		s.url = u.String()
+		s.http = &http.Client{Timeout: otlpExportTimeout}
+	default:
+		return nil, fmt.Errorf("unknown otlp protocol %q", opts.Protocol)
+	}
+	return s, nil
+}
+
+// ClusterResource returns the resource attributes of a cluster. The labels
+// of the cluster are added as k8s.cluster.label.<key>.
+func ClusterResource(md kmapi.ClusterMetadata, labels map[string]string) map[string]string {
+	attrs := map[string]string{
+		"service.name":     "auditor",
+		"k8s.cluster.uid":  md.UID,
+		"k8s.cluster.name": md.Name,
+	}
+	if md.Provider != "" {
+		attrs["cloud.provider"] = string(md.Provider)
+	}
+	for k, v := range labels {
+		attrs["k8s.cluster.label."+k] = v
+	}
+	return attrs
+}
+
+func (s *OTLPSink) Send(event *cloudevents.Event) error {
+	record, err := LogRecord(event)
+	if err != nil {
+		return err
+	}
+	req := &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: s.resource,
+			InstrumentationLibraryLogs: []*logspb.InstrumentationLibraryLogs{{
+				InstrumentationLibrary: &commonpb.InstrumentationLibrary{Name: otlpScopeName},
+				Logs:                   []*logspb.LogRecord{record},
+			}},
+		}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), otlpExportTimeout)
+	defer cancel()
+	if s.client != nil {
+		if len(s.headers) > 0 {
+			ctx = metadata.NewOutgoingContext(ctx, metadata.New(s.headers))
+		}
+		if _, err := s.client.Export(ctx, req); err != nil {
+			return fmt.Errorf("failed to export event %s: %v", event.ID(), err)
+		}
+		return nil
+	}
+	return s.post(ctx, req)
+}
+
+func (s *OTLPSink) post(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range s.headers {
+		r.Header.Set(k, v)
+	}
+	resp, err := s.http.Do(r)
+	if err != nil {
+		return fmt.Errorf("failed to export event: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to export event: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (s *OTLPSink) Close() error {
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	s.http.CloseIdleConnections()
+	return nil
+}
+
+// LogRecord maps an audit cloudevent to an OpenTelemetry log record. The
+// attributes follow the OpenTelemetry semantic conventions where they
+// exist.
+func LogRecord(event *cloudevents.Event) (*logspb.LogRecord, error) {
+	var payload cloudevent.Payload
+	if err := event.DataAs(&payload); err != nil {
+		return nil, err
+	}
+	if payload.Resource == nil {
+		return nil, fmt.Errorf("event %s has no resource", event.ID())
+	}
+
+	rid := payload.ResourceID
+	obj := payload.Resource
+	attrs := map[string]string{
+		"cloudevents.event_id":      event.ID(),
+		"cloudevents.event_source":  event.Source(),
+		"cloudevents.event_type":    event.Type(),
+		"cloudevents.event_subject": event.Subject(),
+		"k8s.resource.group":        rid.Group,
+		"k8s.resource.version":      rid.Version,
+		"k8s.resource.name":         rid.Name,
+		"k8s.resource.kind":         rid.Kind,
+		"k8s.object.name":           obj.GetName(),
+		"k8s.object.uid":            string(obj.GetUID()),
+		"auditor.event.type":        cloudevent.TypeName(event.Type()),
+	}
+	if ns := obj.GetNamespace(); ns != "" {
+		attrs["k8s.namespace.name"] = ns
+	}
+	if actor, ok := event.Extensions()[cloudevent.ExtActor].(string); ok && actor != "" {
+		attrs["auditor.actor"] = actor
+	}
+
+	now := time.Now()
+	t := event.Time()
+	if t.IsZero() {
+		t = now
+	}
+	return &logspb.LogRecord{
+		TimeUnixNano:   uint64(t.UnixNano()),
+		SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+		SeverityText:   "INFO",
+		Name:           fmt.Sprintf("%s %s", rid.Kind, cloudevent.TypeName(event.Type())),
+		Body:           anyValue(obj.Object),
+		Attributes:     stringAttributes(attrs),
+	}, nil
+}
+
+// stringAttributes returns the attributes sorted by key. Empty values are
+// skipped.
+func stringAttributes(m map[string]string) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(m))
+	for k, v := range m {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	attrs := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, &commonpb.KeyValue{
+			Key:   k,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: m[k]}},
+		})
+	}
+	return attrs
+}
+
+// anyValue converts json values, as found in unstructured objects.
+func anyValue(v interface{}) *commonpb.AnyValue {
+	switch v := v.(type) {
+	case nil:
+		return &commonpb.AnyValue{}
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}
+	case int64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v}}
+	case int:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case float64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v}}
+	case []interface{}:
+		values := make([]*commonpb.AnyValue, 0, len(v))
+		for _, e := range v {
+			values = append(values, anyValue(e))
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		values := make([]*commonpb.KeyValue, 0, len(keys))
+		for _, k := range keys {
+			values = append(values, &commonpb.KeyValue{Key: k, Value: anyValue(v[k])})
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: values}}}
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(v)}}
+}
@@ -0,0 +1,270 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	api "go.bytebuilders.dev/audit/api/v1"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// collector is a stand-in for an OTLP collector that records the exports
+// it receives.
+type collector struct {
+	collogspb.UnimplementedLogsServiceServer
+
+	requests chan *collogspb.ExportLogsServiceRequest
+	headers  chan string
+}
+
+func newCollector() *collector {
+	return &collector{
+		requests: make(chan *collogspb.ExportLogsServiceRequest, 1),
+		headers:  make(chan string, 1),
+	}
+}
+
+func (c *collector) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	c.headers <- first(md.Get("authorization"))
+	c.requests <- req
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/logs" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req collogspb.ExportLogsServiceRequest
+	if err := proto.Unmarshal(data, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.headers <- r.Header.Get("Authorization")
+	c.requests <- &req
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func newOTLPEvent(t *testing.T) *cloudevents.Event {
+	t.Helper()
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("apps/v1")
+	u.SetKind("Deployment")
+	u.SetNamespace("demo")
+	u.SetName("web")
+	u.SetUID("uid-1")
+	u.SetGeneration(2)
+	_ = unstructured.SetNestedField(u.Object, int64(3), "spec", "replicas")
+	ev := &api.Event{
+		ResourceID: kmapi.ResourceID{
+			Group:   "apps",
+			Version: "v1",
+			Name:    "deployments",
+			Kind:    "Deployment",
+			Scope:   kmapi.NamespaceScoped,
+		},
+		Resource: u,
+	}
+	event, err := cloudevent.New(ev, api.EventUpdated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.SetExtension(cloudevent.ExtActor, "kubectl-edit")
+	return event
+}
+
+var testResource = ClusterResource(kmapi.ClusterMetadata{
+	UID:      "cluster-uid",
+	Name:     "prod",
+	Provider: kmapi.HostingProviderAWS,
+}, map[string]string{"region": "us-east-1"})
+
+func attributes(kvs []*commonpb.KeyValue) map[string]*commonpb.AnyValue {
+	m := map[string]*commonpb.AnyValue{}
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func checkExport(t *testing.T, c *collector) {
+	t.Helper()
+	if auth := <-c.headers; auth != "Bearer secret" {
+		t.Errorf("authorization = %q, want %q", auth, "Bearer secret")
+	}
+	req := <-c.requests
+	if len(req.ResourceLogs) != 1 || len(req.ResourceLogs[0].InstrumentationLibraryLogs) != 1 ||
+		len(req.ResourceLogs[0].InstrumentationLibraryLogs[0].Logs) != 1 {
+		t.Fatalf("expected a single log record, got %v", req)
+	}
+	rl := req.ResourceLogs[0]
+
+	resource := attributes(rl.Resource.Attributes)
+	for k, v := range map[string]string{
+		"service.name":             "auditor",
+		"k8s.cluster.uid":          "cluster-uid",
+		"k8s.cluster.name":         "prod",
+		"cloud.provider":           string(kmapi.HostingProviderAWS),
+		"k8s.cluster.label.region": "us-east-1",
+	} {
+		if got := resource[k].GetStringValue(); got != v {
+			t.Errorf("resource attribute %s = %q, want %q", k, got, v)
+		}
+	}
+
+	record := rl.InstrumentationLibraryLogs[0].Logs[0]
+	attrs := attributes(record.Attributes)
+	for k, v := range map[string]string{
+		"k8s.resource.group":   "apps",
+		"k8s.resource.version": "v1",
+		"k8s.resource.kind":    "Deployment",
+		"k8s.namespace.name":   "demo",
+		"k8s.object.name":      "web",
+		"k8s.object.uid":       "uid-1",
+		"auditor.event.type":   "updated",
+		"auditor.actor":        "kubectl-edit",
+		"cloudevents.event_id": "uid-1.2",
+	} {
+		if got := attrs[k].GetStringValue(); got != v {
+			t.Errorf("log attribute %s = %q, want %q", k, got, v)
+		}
+	}
+	if record.TimeUnixNano == 0 {
+		t.Error("log record has no time")
+	}
+
+	body := attributes(record.Body.GetKvlistValue().GetValues())
+	spec := attributes(body["spec"].GetKvlistValue().GetValues())
+	if got := spec["replicas"].GetIntValue(); got != 3 {
+		t.Errorf("body spec.replicas = %d, want 3", got)
+	}
+	meta := attributes(body["metadata"].GetKvlistValue().GetValues())
+	if got := meta["name"].GetStringValue(); got != "web" {
+		t.Errorf("body metadata.name = %q, want web", got)
+	}
+}
+
+func TestOTLPSinkGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCollector()
+	srv := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(srv, c)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	defer srv.Stop()
+
+	sink, err := NewOTLPSink(OTLPOptions{
+		Endpoint: lis.Addr().String(),
+		Protocol: OTLPProtocolGRPC,
+		Insecure: true,
+		Headers:  map[string]string{"authorization": "Bearer secret"},
+		Resource: testResource,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Send(newOTLPEvent(t)); err != nil {
+		t.Fatal(err)
+	}
+	checkExport(t, c)
+}
+
+func TestOTLPSinkHTTP(t *testing.T) {
+	c := newCollector()
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	sink, err := NewOTLPSink(OTLPOptions{
+		Endpoint: srv.URL,
+		Protocol: OTLPProtocolHTTP,
+		Headers:  map[string]string{"Authorization": "Bearer secret"},
+		Resource: testResource,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Send(newOTLPEvent(t)); err != nil {
+		t.Fatal(err)
+	}
+	checkExport(t, c)
+}
+
+func TestOTLPSinkHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "collector is overloaded", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	sink, err := NewOTLPSink(OTLPOptions{
+		Endpoint: srv.URL + "/v1/logs",
+		Protocol: OTLPProtocolHTTP,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Send(newOTLPEvent(t)); err == nil {
+		t.Fatal("expected the export to fail")
+	}
+}
+
+func TestNewOTLPSinkInvalid(t *testing.T) {
+	for _, opts := range []OTLPOptions{
+		{Endpoint: "collector:4318", Protocol: OTLPProtocolHTTP},
+		{Endpoint: "collector:4317", Protocol: "thrift"},
+	} {
+		if _, err := NewOTLPSink(opts); err == nil {
+			t.Errorf("expected %+v to be invalid", opts)
+		}
+	}
+}
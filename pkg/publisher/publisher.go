@@ -0,0 +1,513 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"errors"
+	"fmt"
+	gosync "sync"
+	"time"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+	"kubeops.dev/auditor/pkg/dedupe"
+	"kubeops.dev/auditor/pkg/eventer"
+	"kubeops.dev/auditor/pkg/metrics"
+	"kubeops.dev/auditor/pkg/pipeline"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	api "go.bytebuilders.dev/audit/api/v1"
+	"go.bytebuilders.dev/audit/lib"
+	"gomodules.xyz/sync"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+var ErrNotConnected = errors.New("not connected to event receiver")
+
+// Sink delivers audit cloudevents to an event receiver.
+type Sink interface {
+	Send(event *cloudevents.Event) error
+	Close() error
+}
+
+// Licensed is implemented by sinks that publish events on behalf of a license.
+type Licensed interface {
+	LicenseID() string
+}
+
+// Router selects the named sinks an event is published to.
+type Router interface {
+	Route(ev *api.Event, et api.EventType) []string
+}
+
+// Enricher adds context to the audit events that are published.
+type Enricher interface {
+	Enrich(ev *api.Event) *cloudevent.Context
+}
+
+// Resolver builds the event of the full object for an event built from
+// object metadata, and returns the actor of the change. A nil event is not
+// published.
+type Resolver func(ev *api.Event, et api.EventType) (*api.Event, string, error)
+
+// Tee returns a Resolver that hands every event resolved by resolve to the
+// consumers as well, so that they don't fetch the full object again.
+func Tee(resolve Resolver, consumers ...pipeline.Consumer) Resolver {
+	return func(ev *api.Event, et api.EventType) (*api.Event, string, error) {
+		full, actor, err := resolve(ev, et)
+		if err != nil || full == nil {
+			return full, actor, err
+		}
+		for _, consume := range consumers {
+			consume(full, et, actor)
+		}
+		return full, actor, nil
+	}
+}
+
+// Transformer modifies every cloudevent before it is sent.
+type Transformer interface {
+	Transform(event *cloudevents.Event) error
+}
+
+// SinkTransformer modifies the copy of a cloudevent that is sent to one
+// sink. The sink is the name of a routing sink, or empty if events are not
+// routed.
+type SinkTransformer interface {
+	TransformFor(sink string, event *cloudevents.Event) error
+}
+
+// EverySink returns a SinkTransformer that applies t to the copy of every
+// sink.
+func EverySink(t Transformer) SinkTransformer {
+	return everySink{t}
+}
+
+type everySink struct {
+	Transformer
+}
+
+func (t everySink) TransformFor(_ string, event *cloudevents.Event) error {
+	return t.Transform(event)
+}
+
+type Options struct {
+	// Tracker, if set, keeps objects that were already published with the
+	// same generation from being published again, and reports objects that
+	// were published before as updated instead of created.
+	Tracker *dedupe.Tracker
+	// Enricher, if set, adds context to every event before it is wrapped
+	// in a cloudevent.
+	Enricher Enricher
+	// Transformers are applied to every cloudevent, in order.
+	Transformers []Transformer
+	// SinkTransformers are applied in order to the copy of every cloudevent
+	// for each sink it is routed to, after the Transformers.
+	SinkTransformers []SinkTransformer
+	// Recorder, if set, records events when publishing fails and recovers.
+	Recorder *eventer.Recorder
+	// Router, if set, selects the sinks of every event, and the sink must
+	// be a Mux. Events routed to no sink are filtered.
+	Router Router
+}
+
+// Publisher turns informer notifications into audit cloudevents and sends
+// them to a Sink. The sink is connected lazily on the first event, and
+// connecting is retried on later events until it succeeds.
+type Publisher struct {
+	once         sync.Once
+	connect      func() (Sink, error)
+	sink         Sink
+	tracker      *dedupe.Tracker
+	enricher     Enricher
+	transformers []Transformer
+	perSink      []SinkTransformer
+	recorder     *eventer.Recorder
+	router       Router
+
+	mu           gosync.Mutex
+	connected    bool
+	pending      int
+	lastProgress time.Time
+	// failing and dropping are set while events are lost, until an event is
+	// published again. lost counts the events lost in the meantime.
+	failing  bool
+	dropping bool
+	lost     int
+
+	published int64
+	dropped   int64
+	failed    int64
+	lastEvent map[schema.GroupVersionKind]time.Time
+}
+
+// Stats are the counts of events handled by a Publisher since it was
+// created.
+type Stats struct {
+	// Pending is the number of events waiting to be published.
+	Pending   int
+	Published int64
+	Dropped   int64
+	Failed    int64
+}
+
+// New returns a Publisher that sends events to the sink returned by connect.
+func New(connect func() (Sink, error), opts Options) *Publisher {
+	return &Publisher{
+		connect:      connect,
+		tracker:      opts.Tracker,
+		enricher:     opts.Enricher,
+		transformers: opts.Transformers,
+		perSink:      opts.SinkTransformers,
+		recorder:     opts.Recorder,
+		router:       opts.Router,
+		lastEvent:    map[schema.GroupVersionKind]time.Time{},
+	}
+}
+
+// ForGVK returns an informer event handler that publishes the events of the
+// given kind, following the same rules as lib.EventPublisher.
+func (p *Publisher) ForGVK(gvk schema.GroupVersionKind, fn lib.EventCreator) cache.ResourceEventHandler {
+	return pipeline.ForGVK(gvk, fn, p.publish, observer(gvk))
+}
+
+// ForMetadataGVK is like ForGVK, for informers that cache only object
+// metadata. Events are built from the metadata, and resolved to the full
+// object only once the dedupe and routing filters let them through.
+func (p *Publisher) ForMetadataGVK(gvk schema.GroupVersionKind, fn lib.EventCreator, resolve Resolver) cache.ResourceEventHandler {
+	return pipeline.ForGVK(gvk, fn, func(ev *api.Event, et api.EventType, actor string) {
+		if err := p.publishAs(ev, et, actor, resolve); err != nil {
+			klog.V(5).InfoS("failed to publish event", "error", err)
+		}
+	}, observer(gvk))
+}
+
+func (p *Publisher) publish(ev *api.Event, et api.EventType, actor string) {
+	if err := p.publishAs(ev, et, actor, nil); err != nil {
+		klog.V(5).InfoS("failed to publish event", "error", err)
+	}
+}
+
+func (p *Publisher) dial() error {
+	sink, err := p.connect()
+	if err != nil {
+		klog.V(5).InfoS("failed to connect with event receiver", "error", err)
+		return err
+	}
+	p.sink = sink
+	metrics.SinkConnected.Set(1)
+
+	p.mu.Lock()
+	p.connected = true
+	p.mu.Unlock()
+	return nil
+}
+
+// LicenseID returns the license events are published on behalf of. It
+// connects to the sink if needed, and returns an empty string if that fails
+// or the sink isn't licensed.
+func (p *Publisher) LicenseID() string {
+	p.once.Do(p.dial)
+	if l, ok := p.sink.(Licensed); ok {
+		return l.LicenseID()
+	}
+	return ""
+}
+
+// Connect connects to the sink, unless it is already connected, and reports
+// whether it is connected.
+func (p *Publisher) Connect() bool {
+	p.once.Do(p.dial)
+	return p.Connected()
+}
+
+// Connected reports whether the sink has connected at least once.
+func (p *Publisher) Connected() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.connected
+}
+
+// Stalled reports whether events have been waiting to be published without
+// any of them finishing for longer than timeout.
+func (p *Publisher) Stalled(timeout time.Duration) (bool, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending == 0 {
+		return false, 0
+	}
+	d := time.Since(p.lastProgress)
+	return d > timeout, d
+}
+
+func (p *Publisher) begin() {
+	metrics.PublishQueueDepth.Inc()
+	p.mu.Lock()
+	if p.pending == 0 {
+		p.lastProgress = time.Now()
+	}
+	p.pending++
+	p.mu.Unlock()
+}
+
+func (p *Publisher) done() {
+	metrics.PublishQueueDepth.Dec()
+	p.mu.Lock()
+	p.pending--
+	p.lastProgress = time.Now()
+	p.mu.Unlock()
+}
+
+// Stats returns the counts of events handled so far.
+func (p *Publisher) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Stats{
+		Pending:   p.pending,
+		Published: p.published,
+		Dropped:   p.dropped,
+		Failed:    p.failed,
+	}
+}
+
+// LastEventTime returns the time the last event of a kind was published.
+func (p *Publisher) LastEventTime(gvk schema.GroupVersionKind) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.lastEvent[gvk]
+	return t, ok
+}
+
+func (p *Publisher) drop() {
+	p.mu.Lock()
+	first := !p.dropping
+	p.dropping = true
+	p.lost++
+	p.dropped++
+	p.mu.Unlock()
+	if first {
+		p.recorder.Event(core.EventTypeWarning, eventer.EventReasonEventsDropped, "Dropping audit events until the event receiver can be reached")
+	}
+}
+
+func (p *Publisher) sendFailed(err error) {
+	p.mu.Lock()
+	first := !p.failing
+	p.failing = true
+	p.lost++
+	p.failed++
+	p.mu.Unlock()
+	if first {
+		p.recorder.Eventf(core.EventTypeWarning, eventer.EventReasonSinkDisconnected, "Failed to publish audit events: %v", err)
+	}
+}
+
+func (p *Publisher) fail() {
+	p.mu.Lock()
+	p.failed++
+	p.mu.Unlock()
+}
+
+func (p *Publisher) sent(gvk schema.GroupVersionKind) {
+	p.mu.Lock()
+	p.published++
+	p.lastEvent[gvk] = time.Now()
+	recovered := p.failing || p.dropping
+	lost := p.lost
+	p.failing, p.dropping, p.lost = false, false, 0
+	p.mu.Unlock()
+	if recovered {
+		p.recorder.Eventf(core.EventTypeNormal, eventer.EventReasonSinkRecovered, "Publishing audit events again, %d events were lost", lost)
+	}
+}
+
+// Publish wraps the event in a cloudevent and sends it to the sink.
+func (p *Publisher) Publish(ev *api.Event, et api.EventType) error {
+	return p.publishAs(ev, et, "", nil)
+}
+
+// publishAs is like Publish, and records the actor of the change, if known.
+// If resolve is set, the event is resolved after it passed the filters.
+func (p *Publisher) publishAs(ev *api.Event, et api.EventType, actor string, resolve Resolver) error {
+	gvk := ev.Resource.GetObjectKind().GroupVersionKind()
+	labels := metrics.EventLabels(gvk, et)
+
+	// objects without a uid, like the SiteInfo, can't be tracked
+	track := p.tracker != nil && ev.Resource.GetUID() != ""
+	var key string
+	if track {
+		key = dedupe.Key(ev.ResourceID)
+		if gen, found := p.tracker.Generation(key, ev.Resource.GetUID()); found && et == api.EventCreated {
+			if gen == ev.Resource.GetGeneration() {
+				metrics.EventsFiltered.WithLabelValues(metrics.FilterLabels(gvk, et, metrics.FilterDuplicate)...).Inc()
+				return nil
+			}
+			et = api.EventUpdated
+			labels = metrics.EventLabels(gvk, et)
+		}
+	}
+
+	var routes []string
+	if p.router != nil {
+		if routes = p.router.Route(ev, et); len(routes) == 0 {
+			metrics.EventsFiltered.WithLabelValues(metrics.FilterLabels(gvk, et, metrics.FilterUnrouted)...).Inc()
+			return nil
+		}
+	}
+
+	if resolve != nil {
+		full, a, err := resolve(ev, et)
+		if err != nil {
+			metrics.EventsFailed.WithLabelValues(labels...).Inc()
+			p.fail()
+			return err
+		}
+		if full == nil {
+			metrics.EventsFiltered.WithLabelValues(metrics.FilterLabels(gvk, et, metrics.FilterStale)...).Inc()
+			return nil
+		}
+		ev = full
+		// deletes are not recorded in managed fields
+		if et != api.EventDeleted {
+			actor = a
+		}
+	}
+
+	p.begin()
+	defer p.done()
+
+	p.once.Do(p.dial)
+	if p.sink == nil {
+		metrics.EventsDropped.WithLabelValues(labels...).Inc()
+		p.drop()
+		return ErrNotConnected
+	}
+	if l, ok := p.sink.(Licensed); ok {
+		ev.LicenseID = l.LicenseID()
+	}
+
+	var ctx *cloudevent.Context
+	if p.enricher != nil {
+		ctx = p.enricher.Enrich(ev)
+	}
+	event, err := cloudevent.NewWithContext(ev, et, ctx)
+	if err != nil {
+		metrics.EventsFailed.WithLabelValues(labels...).Inc()
+		p.fail()
+		return err
+	}
+	if actor != "" {
+		event.SetExtension(cloudevent.ExtActor, actor)
+	}
+	for _, t := range p.transformers {
+		if err := t.Transform(event); err != nil {
+			metrics.EventsFailed.WithLabelValues(labels...).Inc()
+			p.fail()
+			return err
+		}
+	}
+
+	start := time.Now()
+	err = p.send(routes, event)
+	metrics.PublishDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.EventsFailed.WithLabelValues(labels...).Inc()
+		p.sendFailed(err)
+		return err
+	}
+	metrics.EventsPublished.WithLabelValues(labels...).Inc()
+	p.sent(ev.Resource.GetObjectKind().GroupVersionKind())
+
+	if track {
+		if et == api.EventDeleted {
+			p.tracker.Deleted(key, ev.Resource.GetUID())
+		} else {
+			p.tracker.Published(key, ev.Resource.GetUID(), ev.Resource.GetGeneration())
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) send(routes []string, event *cloudevents.Event) error {
+	if p.router == nil {
+		if err := p.transformFor("", event); err != nil {
+			return err
+		}
+		return p.sink.Send(event)
+	}
+	mux, ok := p.sink.(*Mux)
+	if !ok {
+		return errors.New("routed events require a sink mux")
+	}
+	if len(p.perSink) == 0 {
+		return mux.SendTo(routes, event)
+	}
+	var errs []error
+	for _, name := range mux.Distinct(routes) {
+		e := event.Clone()
+		if err := p.transformFor(name, &e); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %v", name, err))
+			continue
+		}
+		if err := mux.SendTo([]string{name}, &e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (p *Publisher) transformFor(sink string, event *cloudevents.Event) error {
+	for _, t := range p.perSink {
+		if err := t.TransformFor(sink, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the sink, if it was ever connected.
+func (p *Publisher) Close() error {
+	var err error
+	p.once.Do(func() error {
+		// never connected, don't connect now
+		return nil
+	})
+	if p.sink != nil {
+		err = p.sink.Close()
+	}
+	return err
+}
+
+// observer counts the informer notifications of a kind.
+type observer schema.GroupVersionKind
+
+var _ pipeline.Observer = observer{}
+
+func (o observer) Observed(et api.EventType) {
+	metrics.EventsObserved.WithLabelValues(metrics.EventLabels(schema.GroupVersionKind(o), et)...).Inc()
+}
+
+func (o observer) Filtered(et api.EventType) {
+	metrics.EventsFiltered.WithLabelValues(metrics.FilterLabels(schema.GroupVersionKind(o), et, metrics.FilterUnchanged)...).Inc()
+}
+
+func (o observer) Failed(et api.EventType, _ error) {
+	metrics.EventsFailed.WithLabelValues(metrics.EventLabels(schema.GroupVersionKind(o), et)...).Inc()
+}
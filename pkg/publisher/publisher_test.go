@@ -0,0 +1,206 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"sync"
+	"testing"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+	"kubeops.dev/auditor/pkg/metrics"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	api "go.bytebuilders.dev/audit/api/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/component-base/metrics/testutil"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var configMapGVK = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+
+type captureSink struct {
+	mu     sync.Mutex
+	events []*cloudevents.Event
+}
+
+func (s *captureSink) Send(event *cloudevents.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *captureSink) Close() error {
+	return nil
+}
+
+type routerFunc func(ev *api.Event, et api.EventType) []string
+
+func (f routerFunc) Route(ev *api.Event, et api.EventType) []string {
+	return f(ev, et)
+}
+
+func newConfigMapEvent(obj client.Object) (*api.Event, error) {
+	return &api.Event{
+		ResourceID: kmapi.ResourceID{Version: "v1", Name: "configmaps", Kind: "ConfigMap", Scope: kmapi.NamespaceScoped},
+		Resource:   obj,
+	}, nil
+}
+
+func TestForMetadataGVKResolvesPublishedEvents(t *testing.T) {
+	sink := &captureSink{}
+	p := New(func() (Sink, error) {
+		return NewMux(map[string]Sink{"all": sink}), nil
+	}, Options{
+		Router: routerFunc(func(ev *api.Event, _ api.EventType) []string {
+			if ev.Resource.GetLabels()["audit"] == "false" {
+				return nil
+			}
+			return []string{"all"}
+		}),
+	})
+
+	var resolved, consumed []string
+	resolve := func(ev *api.Event, _ api.EventType) (*api.Event, string, error) {
+		resolved = append(resolved, ev.Resource.GetName())
+		full := ev.Resource.DeepCopyObject().(*unstructured.Unstructured)
+		full.Object["data"] = map[string]interface{}{"key": "value"}
+		out, err := newConfigMapEvent(full)
+		return out, "kubectl-edit", err
+	}
+	consume := func(ev *api.Event, _ api.EventType, actor string) {
+		if _, found, _ := unstructured.NestedString(ev.Resource.(*unstructured.Unstructured).Object, "data", "key"); found && actor == "kubectl-edit" {
+			consumed = append(consumed, ev.Resource.GetName())
+		}
+	}
+	h := p.ForMetadataGVK(configMapGVK, newConfigMapEvent, Tee(resolve, consume))
+
+	skipped := &unstructured.Unstructured{}
+	skipped.SetName("skipped")
+	skipped.SetUID("uid-1")
+	skipped.SetLabels(map[string]string{"audit": "false"})
+	h.OnAdd(skipped)
+
+	published := &unstructured.Unstructured{}
+	published.SetName("published")
+	published.SetUID("uid-2")
+	h.OnAdd(published)
+
+	if len(resolved) != 1 || resolved[0] != "published" {
+		t.Fatalf("resolved %v, want only the published object", resolved)
+	}
+	// consumers get the resolved events without resolving them again
+	if len(consumed) != 1 || consumed[0] != "published" {
+		t.Errorf("consumed %v, want the resolved published object", consumed)
+	}
+	if len(sink.events) != 1 {
+		t.Fatalf("got %d events, want 1", len(sink.events))
+	}
+	event := sink.events[0]
+	if got := event.Extensions()[cloudevent.ExtActor]; got != "kubectl-edit" {
+		t.Errorf("%s = %v, want kubectl-edit", cloudevent.ExtActor, got)
+	}
+	var payload cloudevent.Payload
+	if err := event.DataAs(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := unstructured.NestedString(payload.Resource.Object, "data", "key"); !found {
+		t.Error("expected the resolved object to be published")
+	}
+}
+
+func TestFilterReasons(t *testing.T) {
+	metrics.Register()
+	filtered := func(et api.EventType, reason string) float64 {
+		v, err := testutil.GetCounterMetricValue(metrics.EventsFiltered.WithLabelValues(metrics.FilterLabels(configMapGVK, et, reason)...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	unrouted, stale := filtered(api.EventCreated, metrics.FilterUnrouted), filtered(api.EventCreated, metrics.FilterStale)
+
+	p := New(func() (Sink, error) {
+		return NewMux(map[string]Sink{"all": &captureSink{}}), nil
+	}, Options{
+		Router: routerFunc(func(ev *api.Event, _ api.EventType) []string {
+			if ev.Resource.GetLabels()["audit"] == "false" {
+				return nil
+			}
+			return []string{"all"}
+		}),
+	})
+	// a newer version of the object was already published
+	resolve := func(_ *api.Event, _ api.EventType) (*api.Event, string, error) {
+		return nil, "", nil
+	}
+	h := p.ForMetadataGVK(configMapGVK, newConfigMapEvent, resolve)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetName("cm")
+	obj.SetUID("uid-1")
+	h.OnAdd(obj)
+	obj = obj.DeepCopy()
+	obj.SetLabels(map[string]string{"audit": "false"})
+	h.OnAdd(obj)
+
+	if got := filtered(api.EventCreated, metrics.FilterUnrouted) - unrouted; got != 1 {
+		t.Errorf("filtered %v unrouted events, want 1", got)
+	}
+	if got := filtered(api.EventCreated, metrics.FilterStale) - stale; got != 1 {
+		t.Errorf("filtered %v stale events, want 1", got)
+	}
+}
+
+type sinkNameTransformer struct{}
+
+func (sinkNameTransformer) TransformFor(sink string, event *cloudevents.Event) error {
+	event.SetExtension("sink", sink)
+	return nil
+}
+
+func TestSinkTransformers(t *testing.T) {
+	audit, shared := &captureSink{}, &captureSink{}
+	p := New(func() (Sink, error) {
+		return NewMux(map[string]Sink{"audit": audit, "a": shared, "b": shared}), nil
+	}, Options{
+		Router: routerFunc(func(*api.Event, api.EventType) []string {
+			return []string{"audit", "a", "b"}
+		}),
+		SinkTransformers: []SinkTransformer{sinkNameTransformer{}},
+	})
+
+	obj := &unstructured.Unstructured{}
+	obj.SetName("cm")
+	obj.SetUID("uid-1")
+	ev, _ := newConfigMapEvent(obj)
+	if err := p.Publish(ev, api.EventCreated); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(audit.events) != 1 || audit.events[0].Extensions()["sink"] != "audit" {
+		t.Errorf("audit sink got %v, want one event transformed for it", audit.events)
+	}
+	// a shared sink gets the event once, transformed for its first name
+	if len(shared.events) != 1 || shared.events[0].Extensions()["sink"] != "a" {
+		t.Errorf("shared sink got %v, want one event transformed for a", shared.events)
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routing
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+	"kubeops.dev/auditor/pkg/subject"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+)
+
+// Table routes audit events to named sinks. An event is sent to the sinks
+// of every route it matches, or to the default sinks if it matches none.
+type Table struct {
+	Sinks  []Sink  `json:"sinks"`
+	Routes []Route `json:"routes,omitempty"`
+	// Default lists the sinks of events that match no route. If empty,
+	// those events are not published.
+	Default []string `json:"default,omitempty"`
+}
+
+// Sink is a named destination of audit events. Exactly one of the sink
+// types must be set.
+type Sink struct {
+	Name string    `json:"name"`
+	NATS *NatsSink `json:"nats,omitempty"`
+	File *FileSink `json:"file,omitempty"`
+	OTLP *OTLPSink `json:"otlp,omitempty"`
+}
+
+// NatsSink publishes to the event receiver of the license.
+type NatsSink struct {
+	// Subject overrides the subject assigned to the license. It is a
+	// template evaluated for every event, see subject.Data.
+	Subject string `json:"subject,omitempty"`
+
+	template *subject.Template
+}
+
+// Template returns the parsed subject, or nil if the subject of the license
+// is used.
+func (s *NatsSink) Template() *subject.Template {
+	return s.template
+}
+
+// FileSink appends newline delimited cloudevents to a file.
+type FileSink struct {
+	Path string `json:"path"`
+}
+
+// OTLPSink exports events as OpenTelemetry log records to an OTLP
+// collector.
+type OTLPSink struct {
+	// Endpoint is the host:port of the collector for grpc, or the URL of
+	// the collector for http. The http path defaults to /v1/logs.
+	Endpoint string `json:"endpoint"`
+	// Protocol is grpc or http. Defaults to grpc.
+	Protocol string `json:"protocol,omitempty"`
+	// Insecure disables TLS for grpc.
+	Insecure bool `json:"insecure,omitempty"`
+	// Headers are sent with every export, like an authorization header.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Route sends the events selected by Match to Sinks.
+type Route struct {
+	Name  string   `json:"name,omitempty"`
+	Match Match    `json:"match"`
+	Sinks []string `json:"sinks"`
+
+	selector labels.Selector
+	types    sets.String
+}
+
+// Match selects audit events. Empty fields match every event; a field with
+// values matches if any of them does.
+type Match struct {
+	// Groups are API groups, "" for the core group. Use "*" for all groups.
+	Groups []string `json:"groups,omitempty"`
+	// Kinds are object kinds, like "Secret". Use "*" for all kinds.
+	Kinds []string `json:"kinds,omitempty"`
+	// Namespaces never match cluster scoped objects.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Selector matches the labels of the object.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// EventTypes are any of "created", "updated" and "deleted".
+	EventTypes []string `json:"eventTypes,omitempty"`
+}
+
+// Load reads a routing table from a yaml or json file.
+func Load(filename string) (*Table, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing file: %v", err)
+	}
+	var t Table
+	if err := yaml.UnmarshalStrict(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse routing file: %v", err)
+	}
+	if err := t.compile(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (t *Table) compile() error {
+	if len(t.Sinks) == 0 {
+		return fmt.Errorf("routing table has no sinks")
+	}
+	names := sets.NewString()
+	for i, s := range t.Sinks {
+		if s.Name == "" {
+			return fmt.Errorf("routing sink %d has no name", i)
+		}
+		if names.Has(s.Name) {
+			return fmt.Errorf("duplicate routing sink %q", s.Name)
+		}
+		names.Insert(s.Name)
+		if count(s.NATS != nil, s.File != nil, s.OTLP != nil) != 1 {
+			return fmt.Errorf("routing sink %q must set exactly one of nats, file and otlp", s.Name)
+		}
+		if s.File != nil && s.File.Path == "" {
+			return fmt.Errorf("routing sink %q has no file path", s.Name)
+		}
+		if s.OTLP != nil {
+			if s.OTLP.Endpoint == "" {
+				return fmt.Errorf("routing sink %q has no otlp endpoint", s.Name)
+			}
+			if p := s.OTLP.Protocol; p != "" && p != "grpc" && p != "http" {
+				return fmt.Errorf("routing sink %q has unknown otlp protocol %q", s.Name, p)
+			}
+		}
+		if s.NATS != nil && s.NATS.Subject != "" {
+			tmpl, err := subject.Parse(s.NATS.Subject)
+			if err != nil {
+				return fmt.Errorf("routing sink %q: %v", s.Name, err)
+			}
+			s.NATS.template = tmpl
+		}
+	}
+
+	for i := range t.Routes {
+		r := &t.Routes[i]
+		name := r.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		if len(r.Sinks) == 0 {
+			return fmt.Errorf("route %s has no sinks", name)
+		}
+		for _, s := range r.Sinks {
+			if !names.Has(s) {
+				return fmt.Errorf("route %s uses unknown sink %q", name, s)
+			}
+		}
+		if r.Match.Selector != nil {
+			sel, err := metav1.LabelSelectorAsSelector(r.Match.Selector)
+			if err != nil {
+				return fmt.Errorf("route %s has an invalid selector: %v", name, err)
+			}
+			r.selector = sel
+		}
+		if len(r.Match.EventTypes) > 0 {
+			r.types = sets.NewString()
+			for _, et := range r.Match.EventTypes {
+				v, ok := cloudevent.ParseTypeName(et)
+				if !ok {
+					return fmt.Errorf("route %s has unknown event type %q", name, et)
+				}
+				r.types.Insert(string(v))
+			}
+		}
+	}
+	for _, s := range t.Default {
+		if !names.Has(s) {
+			return fmt.Errorf("default route uses unknown sink %q", s)
+		}
+	}
+	return nil
+}
+
+// Route returns the sorted names of the sinks the event is sent to.
+func (t *Table) Route(ev *api.Event, et api.EventType) []string {
+	matched := sets.NewString()
+	for _, r := range t.Routes {
+		if r.matches(ev, et) {
+			matched.Insert(r.Sinks...)
+		}
+	}
+	if matched.Len() == 0 {
+		matched.Insert(t.Default...)
+	}
+	return matched.List()
+}
+
+func (r Route) matches(ev *api.Event, et api.EventType) bool {
+	gvk := ev.Resource.GetObjectKind().GroupVersionKind()
+	if !matchAny(r.Match.Groups, gvk.Group) || !matchAny(r.Match.Kinds, gvk.Kind) {
+		return false
+	}
+	if len(r.Match.Namespaces) > 0 && !contains(r.Match.Namespaces, ev.Resource.GetNamespace()) {
+		return false
+	}
+	if r.types != nil && !r.types.Has(string(et)) {
+		return false
+	}
+	if r.selector != nil && !r.selector.Matches(labels.Set(ev.Resource.GetLabels())) {
+		return false
+	}
+	return true
+}
+
+func matchAny(values []string, v string) bool {
+	return len(values) == 0 || contains(values, "*") || contains(values, v)
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func count(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
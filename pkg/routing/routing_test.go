@@ -0,0 +1,165 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routing
+
+import (
+	"reflect"
+	"testing"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+const testTable = `
+sinks:
+- name: security
+  file:
+    path: /var/log/security.jsonl
+- name: apps
+  nats:
+    subject: "audit.{{.ResourceID.Kind}}"
+- name: all
+  nats: {}
+routes:
+- name: secrets
+  match:
+    groups: [""]
+    kinds: [Secret]
+  sinks: [security]
+- name: deletes
+  match:
+    eventTypes: [deleted]
+  sinks: [security, all]
+- name: prod-apps
+  match:
+    groups: [apps]
+    kinds: ["*"]
+    namespaces: [prod]
+    selector:
+      matchLabels:
+        tier: frontend
+  sinks: [apps]
+default: [all]
+`
+
+func parse(t *testing.T, data string) *Table {
+	t.Helper()
+	var table Table
+	if err := yaml.UnmarshalStrict([]byte(data), &table); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.compile(); err != nil {
+		t.Fatal(err)
+	}
+	return &table
+}
+
+func newEvent(gvk schema.GroupVersionKind, ns string, labels map[string]string) *api.Event {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	u.SetNamespace(ns)
+	u.SetName("obj")
+	u.SetLabels(labels)
+	return &api.Event{Resource: u}
+}
+
+var (
+	secretGVK     = schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+	configMapGVK  = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	deploymentGVK = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+)
+
+func TestRoute(t *testing.T) {
+	table := parse(t, testTable)
+	frontend := map[string]string{"tier": "frontend"}
+	cases := []struct {
+		name string
+		ev   *api.Event
+		et   api.EventType
+		want []string
+	}{
+		{"group and kind", newEvent(secretGVK, "prod", nil), api.EventCreated, []string{"security"}},
+		{"event type", newEvent(configMapGVK, "prod", nil), api.EventDeleted, []string{"all", "security"}},
+		{"several routes", newEvent(secretGVK, "prod", nil), api.EventDeleted, []string{"all", "security"}},
+		{"namespace and selector", newEvent(deploymentGVK, "prod", frontend), api.EventUpdated, []string{"apps"}},
+		{"other namespace", newEvent(deploymentGVK, "dev", frontend), api.EventUpdated, []string{"all"}},
+		{"selector mismatch", newEvent(deploymentGVK, "prod", map[string]string{"tier": "db"}), api.EventUpdated, []string{"all"}},
+		{"cluster scoped", newEvent(deploymentGVK, "", frontend), api.EventUpdated, []string{"all"}},
+		{"default", newEvent(configMapGVK, "prod", nil), api.EventCreated, []string{"all"}},
+	}
+	for _, c := range cases {
+		if got := table.Route(c.ev, c.et); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: Route() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRouteWithoutDefault(t *testing.T) {
+	table := &Table{
+		Sinks: []Sink{{Name: "security", File: &FileSink{Path: "/tmp/security.jsonl"}}},
+		Routes: []Route{{
+			Match: Match{Kinds: []string{"Secret"}},
+			Sinks: []string{"security"},
+		}},
+	}
+	if err := table.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if got := table.Route(newEvent(configMapGVK, "prod", nil), api.EventCreated); len(got) != 0 {
+		t.Errorf("Route() = %v, want no sinks", got)
+	}
+	if got := table.Route(newEvent(secretGVK, "prod", nil), api.EventCreated); !reflect.DeepEqual(got, []string{"security"}) {
+		t.Errorf("Route() = %v, want [security]", got)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	file := func(name string) Sink {
+		return Sink{Name: name, File: &FileSink{Path: "/tmp/" + name}}
+	}
+	cases := map[string]Table{
+		"no sinks":       {},
+		"unnamed sink":   {Sinks: []Sink{{File: &FileSink{Path: "/tmp/a"}}}},
+		"duplicate sink": {Sinks: []Sink{file("a"), file("a")}},
+		"no sink type":   {Sinks: []Sink{{Name: "a"}}},
+		"two sink types": {Sinks: []Sink{{Name: "a", File: &FileSink{Path: "/tmp/a"}, NATS: &NatsSink{}}}},
+		"no file path":   {Sinks: []Sink{{Name: "a", File: &FileSink{}}}},
+		"bad subject":    {Sinks: []Sink{{Name: "a", NATS: &NatsSink{Subject: "{{.Nope}}"}}}},
+		"no endpoint":    {Sinks: []Sink{{Name: "a", OTLP: &OTLPSink{}}}},
+		"bad protocol":   {Sinks: []Sink{{Name: "a", OTLP: &OTLPSink{Endpoint: "c:4317", Protocol: "udp"}}}},
+		"unknown sink":   {Sinks: []Sink{file("a")}, Routes: []Route{{Sinks: []string{"b"}}}},
+		"route no sinks": {Sinks: []Sink{file("a")}, Routes: []Route{{}}},
+		"unknown type": {Sinks: []Sink{file("a")}, Routes: []Route{{
+			Match: Match{EventTypes: []string{"patched"}},
+			Sinks: []string{"a"},
+		}}},
+		"bad selector": {Sinks: []Sink{file("a")}, Routes: []Route{{
+			Match: Match{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"a b": "c"}}},
+			Sinks: []string{"a"},
+		}}},
+		"unknown default": {Sinks: []Sink{file("a")}, Default: []string{"b"}},
+	}
+	for name, table := range cases {
+		table := table
+		if err := table.compile(); err == nil {
+			t.Errorf("%s: compile() succeeded, want an error", name)
+		}
+	}
+}
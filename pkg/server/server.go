@@ -21,6 +21,8 @@ import (
 	"strings"
 
 	"kubeops.dev/auditor/pkg/controller"
+	"kubeops.dev/auditor/pkg/metrics"
+	"kubeops.dev/auditor/pkg/timeline"
 
 	license "go.bytebuilders.dev/license-verifier/kubernetes"
 	admission "k8s.io/api/admission/v1beta1"
@@ -71,8 +73,15 @@ type Auditor struct {
 }
 
 func (op *Auditor) Run(stopCh <-chan struct{}) error {
-	go op.Controller.Run(stopCh)
-	return op.GenericAPIServer.PrepareRun().Run(stopCh)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		op.Controller.Run(stopCh)
+	}()
+	err := op.GenericAPIServer.PrepareRun().Run(stopCh)
+	// wait for the controller to flush its sink
+	<-done
+	return err
 }
 
 type completedConfig struct {
@@ -109,10 +118,25 @@ func (c completedConfig) New() (*Auditor, error) {
 
 	license.NewLicenseEnforcer(c.ExtraConfig.ClientConfig, c.ExtraConfig.LicenseFile).Install(genericServer.Handler.NonGoRestfulMux)
 
+	metrics.Register()
+
 	ctrl, err := c.ExtraConfig.New()
 	if err != nil {
 		return nil, err
 	}
+	if err := genericServer.AddReadyzChecks(ctrl.ReadyzChecks()...); err != nil {
+		return nil, err
+	}
+	if err := genericServer.AddLivezChecks(0, ctrl.LivezChecks()...); err != nil {
+		return nil, err
+	}
+	ctrl.Stream().Install(genericServer.Handler.NonGoRestfulMux)
+	if signer := ctrl.Signer(); signer != nil {
+		signer.Install(genericServer.Handler.NonGoRestfulMux)
+	}
+	if st := ctrl.Store(); st != nil {
+		timeline.NewHandler(st).Install(genericServer.Handler.NonGoRestfulMux)
+	}
 
 	var admissionHooks []hooks.AdmissionHook
 
@@ -0,0 +1,53 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shard
+
+// Plan is the change of the resources watched by one replica.
+type Plan struct {
+	// Start are the owned resources that no other replica claims.
+	Start []string
+	// Stop are the watched resources that another replica owns.
+	Stop []string
+	// Waiting are the owned resources that another replica still claims.
+	Waiting []string
+}
+
+// Assign returns the resources that the replica identity must start and stop
+// watching. A replica only starts watching a resource once no other live
+// replica claims it, so the previous owner hands a resource over by
+// releasing its claim after it stopped watching the resource and persisted
+// its dedupe state.
+func Assign(identity string, view *View, resources []string, watching map[string]bool) Plan {
+	var plan Plan
+	for _, r := range resources {
+		if Owner(view.Members, r) != identity {
+			if watching[r] {
+				plan.Stop = append(plan.Stop, r)
+			}
+			continue
+		}
+		if watching[r] {
+			continue
+		}
+		if _, claimed := view.Claims[r]; claimed {
+			plan.Waiting = append(plan.Waiting, r)
+			continue
+		}
+		plan.Start = append(plan.Start, r)
+	}
+	return plan
+}
@@ -0,0 +1,139 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shard
+
+import (
+	"testing"
+)
+
+// cluster simulates the rebalance rounds of replicas that share resources,
+// with every replica seeing the claims of the previous round.
+type cluster struct {
+	resources []string
+	watching  map[string]map[string]bool
+}
+
+func newCluster(resources []string, members ...string) *cluster {
+	c := &cluster{resources: resources, watching: map[string]map[string]bool{}}
+	for _, m := range members {
+		c.watching[m] = map[string]bool{}
+	}
+	return c
+}
+
+func (c *cluster) members() []string {
+	members := make([]string, 0, len(c.watching))
+	for m := range c.watching {
+		members = append(members, m)
+	}
+	return members
+}
+
+func (c *cluster) view() *View {
+	view := &View{Members: c.members(), Claims: map[string]string{}}
+	for m, watching := range c.watching {
+		for r := range watching {
+			view.Claims[r] = m
+		}
+	}
+	return view
+}
+
+// round runs one rebalance round of every member, and fails the test if a
+// resource is watched by two members at once.
+func (c *cluster) round(t *testing.T) {
+	t.Helper()
+	for _, m := range c.members() {
+		view := c.view()
+		// a replica doesn't see its own claims
+		for r, owner := range view.Claims {
+			if owner == m {
+				delete(view.Claims, r)
+			}
+		}
+		plan := Assign(m, view, c.resources, c.watching[m])
+		for _, r := range plan.Stop {
+			delete(c.watching[m], r)
+		}
+		for _, r := range plan.Start {
+			c.watching[m][r] = true
+		}
+	}
+
+	seen := map[string]string{}
+	for m, watching := range c.watching {
+		for r := range watching {
+			if other, ok := seen[r]; ok {
+				t.Fatalf("%s is watched by %s and %s", r, m, other)
+			}
+			seen[r] = m
+		}
+	}
+}
+
+// settled fails the test unless every resource is watched by its owner.
+func (c *cluster) settled(t *testing.T) {
+	t.Helper()
+	members := c.members()
+	for _, r := range c.resources {
+		if owner := Owner(members, r); !c.watching[owner][r] {
+			t.Errorf("%s is not watched by its owner %s", r, owner)
+		}
+	}
+}
+
+func TestAssignJoin(t *testing.T) {
+	c := newCluster(testKeys(50), "a", "b")
+	c.round(t)
+	c.settled(t)
+
+	c.watching["c"] = map[string]bool{}
+	// the new member waits for the old owners to release its resources
+	plan := Assign("c", c.view(), c.resources, c.watching["c"])
+	if len(plan.Start) != 0 || len(plan.Waiting) == 0 {
+		t.Fatalf("joining member starts %v and waits for %v, want to wait for all", plan.Start, plan.Waiting)
+	}
+	for i := 0; i < 3; i++ {
+		c.round(t)
+	}
+	c.settled(t)
+	if len(c.watching["c"]) == 0 {
+		t.Error("the new member watches no resources")
+	}
+}
+
+func TestAssignLeave(t *testing.T) {
+	c := newCluster(testKeys(50), "a", "b", "c")
+	c.round(t)
+	c.settled(t)
+
+	// a member that leaves releases its resources with its lease
+	delete(c.watching, "b")
+	c.round(t)
+	c.settled(t)
+}
+
+func TestAssignStable(t *testing.T) {
+	c := newCluster(testKeys(50), "a", "b", "c")
+	c.round(t)
+	for _, m := range c.members() {
+		plan := Assign(m, c.view(), c.resources, c.watching[m])
+		if len(plan.Start) != 0 || len(plan.Stop) != 0 {
+			t.Errorf("%s changes %+v without a membership change", m, plan)
+		}
+	}
+}
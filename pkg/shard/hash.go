@@ -0,0 +1,55 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shard
+
+import (
+	"hash/fnv"
+)
+
+// Owner returns the member that owns key. It uses rendezvous hashing, so
+// every replica computes the same owner from the same member list, and only
+// the keys of a joining or leaving member change owners.
+func Owner(members []string, key string) string {
+	var owner string
+	var best uint64
+	for _, m := range members {
+		score := weight(m, key)
+		if owner == "" || score > best || (score == best && m < owner) {
+			owner, best = m, score
+		}
+	}
+	return owner
+}
+
+func weight(member, key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(member))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key))
+	return mix(h.Sum64())
+}
+
+// mix is the splitmix64 finalizer. FNV alone spreads keys that differ only
+// in their last bytes poorly, which is common for pod names.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
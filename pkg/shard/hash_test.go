@@ -0,0 +1,101 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shard
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("resource-%d.example.com", i)
+	}
+	return keys
+}
+
+func owners(members, keys []string) map[string]string {
+	owners := make(map[string]string, len(keys))
+	for _, key := range keys {
+		owners[key] = Owner(members, key)
+	}
+	return owners
+}
+
+func TestOwnerStable(t *testing.T) {
+	keys := testKeys(200)
+	a := owners([]string{"a", "b", "c"}, keys)
+	// the order of the members doesn't matter
+	b := owners([]string{"c", "a", "b"}, keys)
+	for _, key := range keys {
+		if a[key] != b[key] {
+			t.Fatalf("owner of %s changed with the member order: %s != %s", key, a[key], b[key])
+		}
+	}
+
+	counts := map[string]int{}
+	for _, owner := range a {
+		counts[owner]++
+	}
+	for _, m := range []string{"a", "b", "c"} {
+		if counts[m] < 40 {
+			t.Errorf("member %s owns only %d of %d keys", m, counts[m], len(keys))
+		}
+	}
+}
+
+func TestOwnerJoin(t *testing.T) {
+	keys := testKeys(200)
+	before := owners([]string{"a", "b", "c"}, keys)
+	after := owners([]string{"a", "b", "c", "d"}, keys)
+	moved := 0
+	for _, key := range keys {
+		if before[key] == after[key] {
+			continue
+		}
+		// only keys of the new member change owners
+		if after[key] != "d" {
+			t.Errorf("%s moved from %s to %s", key, before[key], after[key])
+		}
+		moved++
+	}
+	if moved == 0 {
+		t.Error("the new member owns no keys")
+	}
+}
+
+func TestOwnerLeave(t *testing.T) {
+	keys := testKeys(200)
+	before := owners([]string{"a", "b", "c"}, keys)
+	after := owners([]string{"a", "c"}, keys)
+	for _, key := range keys {
+		// only keys of the leaving member change owners
+		if before[key] != "b" && before[key] != after[key] {
+			t.Errorf("%s moved from %s to %s", key, before[key], after[key])
+		}
+		if after[key] == "b" {
+			t.Errorf("%s is owned by the member that left", key)
+		}
+	}
+}
+
+func TestOwnerNoMembers(t *testing.T) {
+	if owner := Owner(nil, "key"); owner != "" {
+		t.Errorf("owner = %q, want none", owner)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shard
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	coordination "k8s.io/api/coordination/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	LabelMember = "auditor.appscode.com/shard-member"
+	// AnnotationResources lists the resources a member watches. A member
+	// releases a resource by removing it, which lets the new owner start
+	// watching it.
+	AnnotationResources = "auditor.appscode.com/shard-resources"
+)
+
+// Membership keeps track of the replicas that share the audited resources.
+// Every replica renews its own Lease, and replicas whose Lease has not been
+// renewed within the lease duration are no longer members.
+type Membership struct {
+	client        kubernetes.Interface
+	namespace     string
+	identity      string
+	leaseDuration time.Duration
+}
+
+func NewMembership(client kubernetes.Interface, namespace, identity string, leaseDuration time.Duration) *Membership {
+	return &Membership{
+		client:        client,
+		namespace:     namespace,
+		identity:      identity,
+		leaseDuration: leaseDuration,
+	}
+}
+
+func (m *Membership) Identity() string {
+	return m.identity
+}
+
+func (m *Membership) leaseName() string {
+	return "auditor-shard-" + m.identity
+}
+
+// Renew creates or renews the Lease of this replica, and records the
+// resources it watches.
+func (m *Membership) Renew(ctx context.Context, resources []string) error {
+	now := metav1.NewMicroTime(time.Now())
+	leases := m.client.CoordinationV1().Leases(m.namespace)
+
+	lease, err := leases.Get(ctx, m.leaseName(), metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordination.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      m.leaseName(),
+				Namespace: m.namespace,
+				Labels: map[string]string{
+					LabelMember: "true",
+				},
+				Annotations: claimAnnotations(nil, resources),
+			},
+			Spec: coordination.LeaseSpec{
+				HolderIdentity:       pointer.String(m.identity),
+				LeaseDurationSeconds: pointer.Int32(int32(m.leaseDuration.Seconds())),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	lease.Annotations = claimAnnotations(lease.Annotations, resources)
+	lease.Spec.HolderIdentity = pointer.String(m.identity)
+	lease.Spec.LeaseDurationSeconds = pointer.Int32(int32(m.leaseDuration.Seconds()))
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// View is the state of the shard as seen by one replica.
+type View struct {
+	// Members are the sorted identities of the live replicas.
+	Members []string
+	// Claims maps the resources watched by the other live replicas to the
+	// replica that watches them.
+	Claims map[string]string
+}
+
+// View returns the live replicas and the resources they watch.
+func (m *Membership) View(ctx context.Context) (*View, error) {
+	list, err := m.client.CoordinationV1().Leases(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: LabelMember + "=true",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	view := &View{
+		Members: []string{m.identity},
+		Claims:  map[string]string{},
+	}
+	for _, lease := range list.Items {
+		if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == m.identity {
+			continue
+		}
+		if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+		if now.After(expiry) {
+			continue
+		}
+		member := *lease.Spec.HolderIdentity
+		view.Members = append(view.Members, member)
+		for _, r := range strings.Split(lease.Annotations[AnnotationResources], ",") {
+			if r != "" {
+				view.Claims[r] = member
+			}
+		}
+	}
+	sort.Strings(view.Members)
+	return view, nil
+}
+
+func claimAnnotations(annotations map[string]string, resources []string) map[string]string {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if len(resources) == 0 {
+		delete(annotations, AnnotationResources)
+		return annotations
+	}
+	sorted := append([]string(nil), resources...)
+	sort.Strings(sorted)
+	annotations[AnnotationResources] = strings.Join(sorted, ",")
+	return annotations
+}
+
+// Leave deletes the Lease of this replica, so that the others take over its
+// resources without waiting for the lease to expire.
+func (m *Membership) Leave(ctx context.Context) error {
+	err := m.client.CoordinationV1().Leases(m.namespace).Delete(ctx, m.leaseName(), metav1.DeleteOptions{})
+	if kerr.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shard
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	coordination "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+)
+
+const testNamespace = "kube-system"
+
+func TestMembership(t *testing.T) {
+	ctx := context.TODO()
+	client := fake.NewSimpleClientset()
+	a := NewMembership(client, testNamespace, "a", time.Minute)
+	b := NewMembership(client, testNamespace, "b", time.Minute)
+
+	if err := a.Renew(ctx, []string{"pods", "deployments.apps"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Renew(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	view, err := b.View(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(view.Members, want) {
+		t.Errorf("members = %v, want %v", view.Members, want)
+	}
+	if want := map[string]string{"pods": "a", "deployments.apps": "a"}; !reflect.DeepEqual(view.Claims, want) {
+		t.Errorf("claims = %v, want %v", view.Claims, want)
+	}
+
+	// renewing releases the resources that are no longer watched
+	if err := a.Renew(ctx, []string{"pods"}); err != nil {
+		t.Fatal(err)
+	}
+	if view, err = b.View(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"pods": "a"}; !reflect.DeepEqual(view.Claims, want) {
+		t.Errorf("claims = %v, want %v", view.Claims, want)
+	}
+
+	// leaving releases every resource
+	if err := a.Leave(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if view, err = b.View(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b"}; !reflect.DeepEqual(view.Members, want) || len(view.Claims) != 0 {
+		t.Errorf("view = %+v, want only b without claims", view)
+	}
+	if err := a.Leave(ctx); err != nil {
+		t.Errorf("leaving twice: %v", err)
+	}
+}
+
+func TestMembershipExpired(t *testing.T) {
+	ctx := context.TODO()
+	renewed := metav1.NewMicroTime(time.Now().Add(-time.Hour))
+	client := fake.NewSimpleClientset(&coordination.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "auditor-shard-gone",
+			Namespace:   testNamespace,
+			Labels:      map[string]string{LabelMember: "true"},
+			Annotations: map[string]string{AnnotationResources: "pods"},
+		},
+		Spec: coordination.LeaseSpec{
+			HolderIdentity:       pointer.String("gone"),
+			LeaseDurationSeconds: pointer.Int32(60),
+			RenewTime:            &renewed,
+		},
+	})
+
+	view, err := NewMembership(client, testNamespace, "a", time.Minute).View(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(view.Members, want) {
+		t.Errorf("members = %v, want %v", view.Members, want)
+	}
+	if len(view.Claims) != 0 {
+		t.Errorf("claims of an expired member: %v", view.Claims)
+	}
+}
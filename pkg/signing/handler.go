@@ -0,0 +1,38 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signing
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"k8s.io/apiserver/pkg/server/mux"
+)
+
+const PathKeys = "/signing/keys"
+
+// Install serves the public signing keys as a JWK Set.
+func (s *Signer) Install(c *mux.PathRecorderMux) {
+	c.HandleFunc(PathKeys, s.serveKeys)
+}
+
+func (s *Signer) serveKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	if err := json.NewEncoder(w).Encode(s.keys); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
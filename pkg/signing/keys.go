@@ -0,0 +1,228 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// KeyFileExt is the extension of the key files in a key directory. The file
+// name without the extension is used as the key ID.
+const KeyFileExt = ".pem"
+
+// JSONWebKey is the public part of a signing key, as defined in RFC 7517.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y,omitempty"`
+}
+
+// KeySet is a JWK Set, as served by the key endpoint.
+type KeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// Algorithm returns the JWS algorithm used with the key.
+func Algorithm(key crypto.PublicKey) (string, error) {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return "EdDSA", nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return "ES256", nil
+		case elliptic.P384():
+			return "ES384", nil
+		case elliptic.P521():
+			return "ES512", nil
+		}
+		return "", fmt.Errorf("unsupported ecdsa curve %s", k.Curve.Params().Name)
+	}
+	return "", fmt.Errorf("unsupported key type %T", key)
+}
+
+// NewJSONWebKey returns the JWK of a public key.
+func NewJSONWebKey(kid string, key crypto.PublicKey) (JSONWebKey, error) {
+	alg, err := Algorithm(key)
+	if err != nil {
+		return JSONWebKey{}, err
+	}
+	jwk := JSONWebKey{
+		KeyID:     kid,
+		Use:       "sig",
+		Algorithm: alg,
+	}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = k.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, size)))
+	}
+	return jwk, nil
+}
+
+// PublicKey returns the public key described by the JWK.
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: invalid x: %v", k.KeyID, err)
+	}
+	switch k.KeyType {
+	case "OKP":
+		if k.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("key %s: unsupported OKP key", k.KeyID)
+		}
+		return ed25519.PublicKey(x), nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("key %s: unsupported curve %s", k.KeyID, k.Curve)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid y: %v", k.KeyID, err)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("key %s: point is not on curve %s", k.KeyID, k.Curve)
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("key %s: unsupported key type %s", k.KeyID, k.KeyType)
+}
+
+// PublicKeys returns the public keys of the set by key ID.
+func (s KeySet) PublicKeys() (map[string]crypto.PublicKey, error) {
+	keys := make(map[string]crypto.PublicKey, len(s.Keys))
+	for _, jwk := range s.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		keys[jwk.KeyID] = key
+	}
+	return keys, nil
+}
+
+// keyFile is a key loaded from a key directory. Private is nil for files
+// that only hold the public key of a retired key.
+type keyFile struct {
+	id      string
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// loadKeyDir loads every key file in dir, usually a mounted Secret.
+func loadKeyDir(dir string) ([]keyFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []keyFile
+	for _, e := range entries {
+		// skip the ..data links and hidden files of mounted volumes
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || filepath.Ext(e.Name()) != KeyFileExt {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		k, err := parseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %s: %v", path, err)
+		}
+		k.id = strings.TrimSuffix(e.Name(), KeyFileExt)
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].id < keys[j].id
+	})
+	return keys, nil
+}
+
+func parseKey(data []byte) (keyFile, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return keyFile{}, errors.New("no PEM data found")
+	}
+
+	var k keyFile
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return keyFile{}, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return keyFile{}, fmt.Errorf("unsupported private key type %T", key)
+		}
+		k.private = signer
+		k.public = signer.Public()
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return keyFile{}, err
+		}
+		k.private = key
+		k.public = key.Public()
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return keyFile{}, err
+		}
+		k.public = key
+	default:
+		return keyFile{}, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if _, err := Algorithm(k.public); err != nil {
+		return keyFile{}, err
+	}
+	return k, nil
+}
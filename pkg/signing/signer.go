@@ -0,0 +1,241 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"time"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+)
+
+// ExtSignature is the cloudevent extension that holds the detached JWS of
+// the event data.
+const ExtSignature = "auditsig"
+
+// header is the protected JWS header. Besides the algorithm and key ID, it
+// binds the signature to the cloudevent attributes that identify the event,
+// its time and the type of its data, and to every extension but the
+// signature, like the actor, the cluster and
+// the hash chain, so that a signed payload can't be replayed as a different
+// event. Extensions are encoded in the order of their names.
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	ID        string `json:"ceid"`
+	Source    string `json:"cesource"`
+	Type      string `json:"cetype"`
+	Subject   string `json:"cesubject,omitempty"`
+	Time      string `json:"cetime,omitempty"`
+	// DataContentType and DataSchema describe how the signed data is read.
+	DataContentType string            `json:"cedatacontenttype,omitempty"`
+	DataSchema      string            `json:"cedataschema,omitempty"`
+	Extensions      map[string]string `json:"ceext,omitempty"`
+}
+
+func newHeader(alg, kid string, event *cloudevents.Event) header {
+	h := header{
+		Algorithm:       alg,
+		KeyID:           kid,
+		ID:              event.ID(),
+		Source:          event.Source(),
+		Type:            event.Type(),
+		Subject:         event.Subject(),
+		DataContentType: event.DataContentType(),
+		DataSchema:      event.DataSchema(),
+	}
+	// the time is formatted like in structured cloudevents
+	if t := event.Time(); !t.IsZero() {
+		h.Time = t.UTC().Format(time.RFC3339Nano)
+	}
+	if exts := cloudevent.Extensions(event, ExtSignature); len(exts) > 0 {
+		h.Extensions = exts
+	}
+	return h
+}
+
+// Signer signs the data of every event with the active key of a key
+// directory, and serves the public keys of all keys in the directory so that
+// events signed with a rotated key can still be verified.
+type Signer struct {
+	kid  string
+	alg  string
+	key  crypto.Signer
+	keys KeySet
+}
+
+// NewSigner loads the keys in dir and signs with the key named kid. If kid
+// is empty, dir must hold exactly one private key.
+func NewSigner(dir, kid string) (*Signer, error) {
+	files, err := loadKeyDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Signer{
+		kid:  kid,
+		keys: KeySet{Keys: []JSONWebKey{}},
+	}
+	for _, f := range files {
+		jwk, err := NewJSONWebKey(f.id, f.public)
+		if err != nil {
+			return nil, err
+		}
+		s.keys.Keys = append(s.keys.Keys, jwk)
+
+		if f.private == nil {
+			continue
+		}
+		if kid == "" {
+			if s.key != nil {
+				return nil, fmt.Errorf("found more than one private key in %s, the signing key id must be set", dir)
+			}
+			s.kid = f.id
+		}
+		if s.kid == f.id {
+			s.key = f.private
+			s.alg = jwk.Algorithm
+		}
+	}
+	if s.key == nil {
+		if kid == "" {
+			return nil, fmt.Errorf("no private key found in %s", dir)
+		}
+		return nil, fmt.Errorf("no private key with id %q found in %s", kid, dir)
+	}
+	return s, nil
+}
+
+// KeyID returns the ID of the key events are signed with.
+func (s *Signer) KeyID() string {
+	return s.kid
+}
+
+// Keys returns the public keys of all keys in the key directory.
+func (s *Signer) Keys() KeySet {
+	return s.keys
+}
+
+// Transform adds the detached JWS of the event data to the event.
+func (s *Signer) Transform(event *cloudevents.Event) error {
+	protected, err := json.Marshal(newHeader(s.alg, s.kid, event))
+	if err != nil {
+		return err
+	}
+	input := signingInput(protected, event.Data())
+	sig, err := sign(s.key, s.alg, input)
+	if err != nil {
+		return err
+	}
+	// detached content, ref: https://www.rfc-editor.org/rfc/rfc7515#appendix-F
+	event.SetExtension(ExtSignature, base64.RawURLEncoding.EncodeToString(protected)+".."+base64.RawURLEncoding.EncodeToString(sig))
+	return nil
+}
+
+func signingInput(protected, payload []byte) []byte {
+	return []byte(base64.RawURLEncoding.EncodeToString(protected) + "." + base64.RawURLEncoding.EncodeToString(payload))
+}
+
+func hashFor(alg string) (hash.Hash, error) {
+	switch alg {
+	case "ES256":
+		return sha256.New(), nil
+	case "ES384":
+		return sha512.New384(), nil
+	case "ES512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+func sign(key crypto.Signer, alg string, input []byte) ([]byte, error) {
+	if k, ok := key.(ed25519.PrivateKey); ok {
+		return ed25519.Sign(k, input), nil
+	}
+	k, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	h, err := hashFor(alg)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(input)
+	der, err := ecdsa.SignASN1(rand.Reader, k, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	// JWS uses the fixed size concatenation of r and s instead of ASN.1
+	var rs struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &rs); err != nil {
+		return nil, err
+	}
+	size := (k.Curve.Params().BitSize + 7) / 8
+	sig := make([]byte, 2*size)
+	rs.R.FillBytes(sig[:size])
+	rs.S.FillBytes(sig[size:])
+	return sig, nil
+}
+
+func verify(key crypto.PublicKey, alg string, input, sig []byte) error {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			return fmt.Errorf("algorithm %q doesn't match the key", alg)
+		}
+		if !ed25519.Verify(k, input, sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if expected, _ := Algorithm(k); alg != expected {
+			return fmt.Errorf("algorithm %q doesn't match the key", alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		h, err := hashFor(alg)
+		if err != nil {
+			return err
+		}
+		h.Write(input)
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, h.Sum(nil), r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key type %T", key)
+}
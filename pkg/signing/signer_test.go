@@ -0,0 +1,128 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cloudeventssdk "github.com/cloudevents/sdk-go/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+)
+
+func newSigner(t *testing.T) (*Signer, map[string]crypto.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, "k1"+KeyFileExt), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSigner(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, map[string]crypto.PublicKey{"k1": pub}
+}
+
+func newEvent(t *testing.T) *cloudevents.Event {
+	t.Helper()
+	event := cloudeventssdk.NewEvent()
+	event.SetID("uid.1")
+	event.SetSource("/test")
+	event.SetType("created")
+	event.SetSubject("uid")
+	event.SetTime(time.Now())
+	event.SetExtension("auditactor", "kubectl-edit")
+	event.SetExtension("clusteruid", "cluster-1")
+	if err := event.SetData(cloudevents.ApplicationJSON, map[string]string{"k": "v"}); err != nil {
+		t.Fatal(err)
+	}
+	return &event
+}
+
+func TestSignVerify(t *testing.T) {
+	s, keys := newSigner(t)
+	event := newEvent(t)
+	if err := s.Transform(event); err != nil {
+		t.Fatal(err)
+	}
+	kid, err := Verify(event, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid != "k1" {
+		t.Errorf("kid = %s, want k1", kid)
+	}
+
+	// the signature survives the structured encoding of the event
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded cloudevents.Event
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(&decoded, keys); err != nil {
+		t.Errorf("decoded event: %v", err)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	s, keys := newSigner(t)
+	cases := map[string]func(e *cloudevents.Event){
+		"actor":     func(e *cloudevents.Event) { e.SetExtension("auditactor", "someone-else") },
+		"cluster":   func(e *cloudevents.Event) { e.SetExtension("clusteruid", "cluster-2") },
+		"extension": func(e *cloudevents.Event) { e.SetExtension("env", "prod") },
+		"removed":   func(e *cloudevents.Event) { e.SetExtension("clusteruid", nil) },
+		"id":        func(e *cloudevents.Event) { e.SetID("uid.2") },
+		"time":      func(e *cloudevents.Event) { e.SetTime(e.Time().Add(-time.Hour)) },
+		"schema":    func(e *cloudevents.Event) { e.SetDataSchema("https://example.com/other") },
+		"content type": func(e *cloudevents.Event) {
+			e.SetDataContentType("text/plain")
+		},
+		"data": func(e *cloudevents.Event) {
+			_ = e.SetData(cloudevents.ApplicationJSON, map[string]string{"k": "w"})
+		},
+	}
+	for name, tamper := range cases {
+		event := newEvent(t)
+		if err := s.Transform(event); err != nil {
+			t.Fatal(err)
+		}
+		tamper(event)
+		if _, err := Verify(event, keys); err == nil {
+			t.Errorf("%s: expected the tampered event to fail verification", name)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signing
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/types"
+)
+
+var ErrNotSigned = errors.New("event is not signed")
+
+// Verify checks the signature of the event against the given public keys,
+// usually loaded from the key endpoint of the auditor that signed it. It
+// returns the ID of the key the event was signed with.
+func Verify(event *cloudevents.Event, keys map[string]crypto.PublicKey) (string, error) {
+	v, ok := event.Extensions()[ExtSignature]
+	if !ok {
+		return "", ErrNotSigned
+	}
+	jws, err := types.ToString(v)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return "", errors.New("signature is not a detached JWS")
+	}
+	protected, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("invalid JWS header: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid JWS signature: %v", err)
+	}
+	var h header
+	if err := json.Unmarshal(protected, &h); err != nil {
+		return "", fmt.Errorf("invalid JWS header: %v", err)
+	}
+
+	key, ok := keys[h.KeyID]
+	if !ok {
+		return h.KeyID, fmt.Errorf("unknown signing key %q", h.KeyID)
+	}
+	if err := verify(key, h.Algorithm, signingInput(protected, event.Data()), sig); err != nil {
+		return h.KeyID, err
+	}
+	if !reflect.DeepEqual(h, newHeader(h.Algorithm, h.KeyID, event)) {
+		return h.KeyID, errors.New("signature was made for a different event")
+	}
+	return h.KeyID, nil
+}
@@ -0,0 +1,59 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"kubeops.dev/auditor/pkg/pipeline"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	"go.bytebuilders.dev/audit/lib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ForGVK returns an informer event handler that records the events of the
+// given kind, following the same rules as lib.EventPublisher.
+func (s *Store) ForGVK(gvk schema.GroupVersionKind, fn lib.EventCreator) cache.ResourceEventHandler {
+	return pipeline.ForGVK(gvk, fn, s.Record)
+}
+
+// Record stores an event that was built elsewhere, like the events resolved
+// by the publisher of metadata-only informers. Failures are logged.
+func (s *Store) Record(ev *api.Event, et api.EventType, _ string) {
+	if _, err := s.Append(ev, et); err != nil {
+		klog.ErrorS(err, "failed to store audit event",
+			"gvk", ev.Resource.GetObjectKind().GroupVersionKind(),
+			"namespace", ev.Resource.GetNamespace(),
+			"name", ev.Resource.GetName(),
+		)
+	}
+}
+
+func toUnstructured(obj client.Object) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
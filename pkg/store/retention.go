@@ -0,0 +1,104 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// Run enforces the retention policy periodically until stopCh is closed.
+func (s *Store) Run(stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if err := s.GC(); err != nil {
+			klog.ErrorS(err, "failed to enforce event store retention")
+		}
+	}, s.opts.GCInterval, stopCh)
+}
+
+// GC removes records older than MaxAge and then the oldest records until
+// the store is within MaxSize.
+func (s *Store) GC() error {
+	if s.opts.MaxAge <= 0 && s.opts.MaxSize <= 0 {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketByTime).Cursor()
+
+		var cutoff int64
+		if s.opts.MaxAge > 0 {
+			cutoff = time.Now().Add(-s.opts.MaxAge).UnixNano()
+		}
+		size := totalSize(tx)
+
+		var expired [][]byte
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			tooOld := int64(binary.BigEndian.Uint64(k[:8])) < cutoff
+			tooBig := s.opts.MaxSize > 0 && size > s.opts.MaxSize
+			if !tooOld && !tooBig {
+				break
+			}
+			size -= int64(len(tx.Bucket(bucketEvents).Get(k[8:])))
+			expired = append(expired, append([]byte(nil), k[8:]...))
+		}
+
+		for _, seq := range expired {
+			if err := deleteRecord(tx, seq); err != nil {
+				return err
+			}
+		}
+		if len(expired) > 0 {
+			klog.V(5).InfoS("pruned audit events from local store", "count", len(expired))
+		}
+		return nil
+	})
+}
+
+func deleteRecord(tx *bolt.Tx, seq []byte) error {
+	events := tx.Bucket(bucketEvents)
+	data := events.Get(seq)
+	if data == nil {
+		return nil
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return err
+	}
+	for bucket, idx := range indexKeys(&rec) {
+		if err := tx.Bucket([]byte(bucket)).Delete(idx); err != nil {
+			return err
+		}
+	}
+	if err := events.Delete(seq); err != nil {
+		return err
+	}
+	return addSize(tx, -int64(len(data)))
+}
+
+func totalSize(tx *bolt.Tx) int64 {
+	v := tx.Bucket(bucketMeta).Get(keyTotalSize)
+	if v == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(v))
+}
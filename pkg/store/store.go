@@ -0,0 +1,378 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	bolt "go.etcd.io/bbolt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+const fileMode = 0o600
+
+var (
+	bucketEvents   = []byte("events")
+	bucketMeta     = []byte("meta")
+	bucketByUID    = []byte("idx-uid")
+	bucketByKind   = []byte("idx-kind")
+	bucketByNS     = []byte("idx-namespace")
+	bucketByName   = []byte("idx-name")
+	bucketByTime   = []byte("idx-time")
+	keyTotalSize   = []byte("total-size")
+	allBuckets     = [][]byte{bucketEvents, bucketMeta, bucketByUID, bucketByKind, bucketByNS, bucketByName, bucketByTime}
+	indexSeparator = []byte{0}
+)
+
+// Record is a single audit event persisted in the local store.
+type Record struct {
+	Seq             uint64                     `json:"seq"`
+	Type            api.EventType              `json:"type"`
+	Time            time.Time                  `json:"time"`
+	ResourceID      kmapi.ResourceID           `json:"resourceID"`
+	UID             types.UID                  `json:"uid"`
+	Namespace       string                     `json:"namespace,omitempty"`
+	Name            string                     `json:"name"`
+	ResourceVersion string                     `json:"resourceVersion,omitempty"`
+	Generation      int64                      `json:"generation,omitempty"`
+	Object          *unstructured.Unstructured `json:"object,omitempty"`
+}
+
+// Query selects records from the store. Empty fields match everything.
+type Query struct {
+	UID       types.UID
+	Group     string
+	Version   string
+	Kind      string
+	Namespace string
+	// Name matches objects by name within Namespace; leave Namespace
+	// empty for cluster scoped objects.
+	Name  string
+	Since time.Time
+	Until time.Time
+	// Limit keeps only the most recent matching records. Zero means no limit.
+	Limit int
+}
+
+type Options struct {
+	Path    string
+	MaxAge  time.Duration
+	MaxSize int64
+	// GCInterval controls how often retention is enforced.
+	GCInterval time.Duration
+	// ReadOnly opens an existing store for queries only.
+	ReadOnly bool
+	// Encrypter, if set, encrypts fields of every object before it is
+	// stored, like they are encrypted in published events.
+	Encrypter ObjectEncrypter
+}
+
+// ObjectEncrypter encrypts fields of an object in place.
+type ObjectEncrypter interface {
+	EncryptObject(rid kmapi.ResourceID, obj *unstructured.Unstructured) (bool, error)
+}
+
+// Store is an embedded, file backed event store indexed by uid, kind,
+// namespace, name and time.
+type Store struct {
+	opts Options
+	db   *bolt.DB
+}
+
+func Open(opts Options) (*Store, error) {
+	if opts.Path == "" {
+		return nil, errors.New("missing event store path")
+	}
+	if opts.GCInterval <= 0 {
+		opts.GCInterval = time.Minute
+	}
+
+	db, err := bolt.Open(opts.Path, fileMode, &bolt.Options{Timeout: 5 * time.Second, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event store %s: %v", opts.Path, err)
+	}
+	if opts.ReadOnly {
+		return &Store{opts: opts, db: db}, nil
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range allBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	s := &Store{opts: opts, db: db}
+	if err := s.GC(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Append stores the given audit event and returns the persisted record.
+// Informers report every object again when the auditor restarts, so an
+// event of an object whose resource version is already stored is skipped
+// and the stored record is returned instead, keeping its time.
+func (s *Store) Append(ev *api.Event, et api.EventType) (*Record, error) {
+	u, err := toUnstructured(ev.Resource)
+	if err != nil {
+		return nil, err
+	}
+	if s.opts.Encrypter != nil {
+		// the object may be shared with the informer cache
+		u = u.DeepCopy()
+		if _, err := s.opts.Encrypter.EncryptObject(ev.ResourceID, u); err != nil {
+			return nil, err
+		}
+	}
+
+	rec := &Record{
+		Type:            et,
+		Time:            time.Now().UTC(),
+		ResourceID:      ev.ResourceID,
+		UID:             u.GetUID(),
+		Namespace:       u.GetNamespace(),
+		Name:            u.GetName(),
+		ResourceVersion: u.GetResourceVersion(),
+		Generation:      u.GetGeneration(),
+		Object:          u,
+	}
+
+	var stored *Record
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		events := tx.Bucket(bucketEvents)
+		if et != api.EventDeleted && rec.ResourceVersion != "" {
+			last, err := latest(tx, rec.UID)
+			if err != nil {
+				return err
+			}
+			if last != nil && last.Type != api.EventDeleted && last.ResourceVersion == rec.ResourceVersion {
+				stored = last
+				return nil
+			}
+		}
+
+		seq, err := events.NextSequence()
+		if err != nil {
+			return err
+		}
+		rec.Seq = seq
+
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		key := itob(seq)
+		if err := events.Put(key, data); err != nil {
+			return err
+		}
+		for bucket, idx := range indexKeys(rec) {
+			if err := tx.Bucket([]byte(bucket)).Put(idx, nil); err != nil {
+				return err
+			}
+		}
+		return addSize(tx, int64(len(data)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil {
+		return stored, nil
+	}
+	return rec, nil
+}
+
+// latest returns the most recent record of the object with the given uid,
+// or nil if there is none.
+func latest(tx *bolt.Tx, uid types.UID) (*Record, error) {
+	prefix := append([]byte(uid), indexSeparator...)
+	c := tx.Bucket(bucketByUID).Cursor()
+	k, _ := c.Seek(append(prefix, itob(math.MaxUint64)...))
+	if k == nil {
+		k, _ = c.Last()
+	} else {
+		k, _ = c.Prev()
+	}
+	if k == nil || !bytes.HasPrefix(k, prefix) {
+		return nil, nil
+	}
+	data := tx.Bucket(bucketEvents).Get(k[len(prefix):])
+	if data == nil {
+		return nil, nil
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// List returns the records matching q in chronological order.
+func (s *Store) List(q Query) ([]Record, error) {
+	var result []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		events := tx.Bucket(bucketEvents)
+		return scan(tx, q, func(seq []byte) error {
+			data := events.Get(seq)
+			if data == nil {
+				return nil
+			}
+			var rec Record
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return err
+			}
+			if q.matches(&rec) {
+				result = append(result, rec)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[len(result)-q.Limit:]
+	}
+	return result, nil
+}
+
+// scan walks the most selective index for q and calls fn with the
+// sequence key of every candidate record, in insertion order.
+func scan(tx *bolt.Tx, q Query, fn func(seq []byte) error) error {
+	var bucket, prefix []byte
+	switch {
+	case q.UID != "":
+		bucket, prefix = bucketByUID, []byte(q.UID)
+	case q.Name != "":
+		bucket, prefix = bucketByName, []byte(q.Namespace+"/"+q.Name)
+	case q.Kind != "":
+		bucket, prefix = bucketByKind, []byte(q.Group+"/"+q.Kind)
+	case q.Namespace != "":
+		bucket, prefix = bucketByNS, []byte(q.Namespace)
+	default:
+		c := tx.Bucket(bucketByTime).Cursor()
+		var k []byte
+		if q.Since.IsZero() {
+			k, _ = c.First()
+		} else {
+			k, _ = c.Seek(itob(uint64(q.Since.UnixNano())))
+		}
+		for ; k != nil; k, _ = c.Next() {
+			if !q.Until.IsZero() && int64(binary.BigEndian.Uint64(k[:8])) > q.Until.UnixNano() {
+				break
+			}
+			if err := fn(k[8:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	prefix = append(prefix, indexSeparator...)
+	c := tx.Bucket(bucket).Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		if err := fn(k[len(prefix):]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q Query) matches(rec *Record) bool {
+	if q.UID != "" && q.UID != rec.UID {
+		return false
+	}
+	if q.Kind != "" && (q.Group != rec.ResourceID.Group || q.Kind != rec.ResourceID.Kind) {
+		return false
+	}
+	if q.Version != "" && q.Version != rec.ResourceID.Version {
+		return false
+	}
+	if q.Namespace != "" && q.Namespace != rec.Namespace {
+		return false
+	}
+	if q.Name != "" && q.Name != rec.Name {
+		return false
+	}
+	if !q.Since.IsZero() && rec.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && rec.Time.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// indexKeys returns the index entries of rec keyed by bucket name.
+func indexKeys(rec *Record) map[string][]byte {
+	seq := itob(rec.Seq)
+	entry := func(prefix string) []byte {
+		k := make([]byte, 0, len(prefix)+1+len(seq))
+		k = append(k, prefix...)
+		k = append(k, indexSeparator...)
+		return append(k, seq...)
+	}
+
+	keys := map[string][]byte{
+		string(bucketByUID):  entry(string(rec.UID)),
+		string(bucketByKind): entry(rec.ResourceID.Group + "/" + rec.ResourceID.Kind),
+		string(bucketByName): entry(rec.Namespace + "/" + rec.Name),
+		string(bucketByTime): append(itob(uint64(rec.Time.UnixNano())), seq...),
+	}
+	if rec.Namespace != "" {
+		keys[string(bucketByNS)] = entry(rec.Namespace)
+	}
+	return keys
+}
+
+func addSize(tx *bolt.Tx, delta int64) error {
+	meta := tx.Bucket(bucketMeta)
+	var size int64
+	if v := meta.Get(keyTotalSize); v != nil {
+		size = int64(binary.BigEndian.Uint64(v))
+	}
+	size += delta
+	if size < 0 {
+		size = 0
+	}
+	return meta.Put(keyTotalSize, itob(uint64(size)))
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,205 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+var configMapID = kmapi.ResourceID{
+	Version: "v1",
+	Name:    "configmaps",
+	Kind:    "ConfigMap",
+	Scope:   kmapi.NamespaceScoped,
+}
+
+func newEvent(ns, name string, uid types.UID, generation int64) *api.Event {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("ConfigMap")
+	u.SetNamespace(ns)
+	u.SetName(name)
+	u.SetUID(uid)
+	u.SetGeneration(generation)
+	return &api.Event{Resource: u, ResourceID: configMapID}
+}
+
+func openStore(t *testing.T, opts Options) *Store {
+	t.Helper()
+	opts.Path = filepath.Join(t.TempDir(), "events.db")
+	s, err := Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func TestStoreList(t *testing.T) {
+	s := openStore(t, Options{})
+
+	appends := []struct {
+		ev *api.Event
+		et api.EventType
+	}{
+		{newEvent("default", "a", "uid-a", 1), api.EventCreated},
+		{newEvent("default", "b", "uid-b", 1), api.EventCreated},
+		{newEvent("default", "a", "uid-a", 2), api.EventUpdated},
+		{newEvent("kube-system", "a", "uid-c", 1), api.EventCreated},
+		{newEvent("default", "a", "uid-a", 2), api.EventDeleted},
+	}
+	for _, a := range appends {
+		if _, err := s.Append(a.ev, a.et); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		q    Query
+		want []uint64
+	}{
+		{"all", Query{}, []uint64{1, 2, 3, 4, 5}},
+		{"uid", Query{UID: "uid-a"}, []uint64{1, 3, 5}},
+		{"name", Query{Namespace: "default", Name: "a"}, []uint64{1, 3, 5}},
+		{"namespace", Query{Namespace: "kube-system"}, []uint64{4}},
+		{"kind", Query{Kind: "ConfigMap", Version: "v1"}, []uint64{1, 2, 3, 4, 5}},
+		{"other kind", Query{Group: "apps", Kind: "Deployment"}, nil},
+		{"limit", Query{UID: "uid-a", Limit: 2}, []uint64{3, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := s.List(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []uint64
+			for _, r := range records {
+				got = append(got, r.Seq)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("List() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("List() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreSkipsUnchanged(t *testing.T) {
+	s := openStore(t, Options{})
+
+	event := func(rv string) *api.Event {
+		ev := newEvent("default", "a", "uid-a", 1)
+		ev.Resource.SetResourceVersion(rv)
+		return ev
+	}
+	appends := []struct {
+		ev   *api.Event
+		et   api.EventType
+		want uint64
+	}{
+		{event("1"), api.EventCreated, 1},
+		// the informers of a restarted auditor report the object again
+		{event("1"), api.EventCreated, 1},
+		{event("2"), api.EventUpdated, 2},
+		{event("2"), api.EventCreated, 2},
+		{event("2"), api.EventDeleted, 3},
+		// a restored object with the resource version it was deleted at
+		{event("2"), api.EventCreated, 4},
+	}
+	for i, a := range appends {
+		rec, err := s.Append(a.ev, a.et)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Seq != a.want {
+			t.Errorf("append %d stored seq %d, want %d", i, rec.Seq, a.want)
+		}
+	}
+
+	records, err := s.List(Query{UID: "uid-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("stored %d records, want 4", len(records))
+	}
+}
+
+func TestStoreRetentionBySize(t *testing.T) {
+	s := openStore(t, Options{MaxSize: 1})
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.Append(newEvent("default", "a", "uid-a", int64(i)), api.EventUpdated); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.GC(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := s.List(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("expected all records to be pruned, found %d", len(records))
+	}
+	for _, q := range []Query{{UID: "uid-a"}, {Namespace: "default", Name: "a"}} {
+		if records, _ := s.List(q); len(records) != 0 {
+			t.Fatalf("stale index entries for %+v", q)
+		}
+	}
+}
+
+type redacter struct{}
+
+func (redacter) EncryptObject(_ kmapi.ResourceID, obj *unstructured.Unstructured) (bool, error) {
+	obj.Object["data"] = "redacted"
+	return true, nil
+}
+
+func TestStoreEncrypts(t *testing.T) {
+	s := openStore(t, Options{Encrypter: redacter{}})
+	ev := newEvent("default", "cm", "uid-1", 1)
+	ev.Resource.(*unstructured.Unstructured).Object["data"] = map[string]interface{}{"key": "value"}
+	if _, err := s.Append(ev, api.EventCreated); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := s.List(Query{UID: "uid-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Object.Object["data"] != "redacted" {
+		t.Fatalf("records = %v, want the encrypted object", records)
+	}
+	// the object of the event may be shared with an informer cache
+	if _, ok := ev.Resource.(*unstructured.Unstructured).Object["data"].(map[string]interface{}); !ok {
+		t.Error("encrypting changed the object of the event")
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stream
+
+import (
+	"net/http"
+	"sync"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+	"kubeops.dev/auditor/pkg/pipeline"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	api "go.bytebuilders.dev/audit/api/v1"
+	"go.bytebuilders.dev/audit/lib"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/server/mux"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	PathEvents = "/stream/events"
+
+	subscriberBufferSize = 256
+)
+
+// Broadcaster fans out live audit events, encoded as structured JSON
+// cloudevents, to every connected subscriber. Slow subscribers miss events
+// instead of blocking the informers.
+type Broadcaster struct {
+	transformers []Transformer
+
+	mu   sync.RWMutex
+	subs map[chan []byte]struct{}
+}
+
+// Transformer modifies every cloudevent before it is broadcast.
+type Transformer interface {
+	Transform(event *cloudevents.Event) error
+}
+
+// NewBroadcaster returns a Broadcaster that applies the transformers to
+// every event, in order, like the encrypter of published events.
+func NewBroadcaster(transformers ...Transformer) *Broadcaster {
+	return &Broadcaster{
+		transformers: transformers,
+		subs:         map[chan []byte]struct{}{},
+	}
+}
+
+// ForGVK returns an informer event handler that broadcasts the events of the
+// given kind while anyone is subscribed.
+func (b *Broadcaster) ForGVK(gvk schema.GroupVersionKind, fn lib.EventCreator) cache.ResourceEventHandler {
+	return cache.FilteringResourceEventHandler{
+		FilterFunc: func(interface{}) bool {
+			return b.active()
+		},
+		Handler: pipeline.ForGVK(gvk, fn, b.broadcast),
+	}
+}
+
+// Subscribe registers a new subscriber. The returned function must be
+// called to unsubscribe.
+func (b *Broadcaster) Subscribe() (<-chan []byte, func()) {
+	ch := make(chan []byte, subscriberBufferSize)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
+
+func (b *Broadcaster) active() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs) > 0
+}
+
+// Broadcast sends an event that was built elsewhere, like the events
+// resolved by the publisher of metadata-only informers, to the subscribers.
+func (b *Broadcaster) Broadcast(ev *api.Event, et api.EventType, actor string) {
+	if b.active() {
+		b.broadcast(ev, et, actor)
+	}
+}
+
+func (b *Broadcaster) broadcast(ev *api.Event, et api.EventType, _ string) {
+	event, err := cloudevent.New(ev, et)
+	if err != nil {
+		klog.V(5).InfoS("failed to create cloudevent", "error", err)
+		return
+	}
+	for _, t := range b.transformers {
+		// never broadcast events that failed to transform, they may hold
+		// fields that must be encrypted
+		if err := t.Transform(event); err != nil {
+			klog.ErrorS(err, "failed to transform streamed event", "id", event.ID())
+			return
+		}
+	}
+	data, err := cloudevent.Marshal(event)
+	if err != nil {
+		klog.V(5).InfoS("failed to marshal cloudevent", "error", err)
+		return
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs {
+		select {
+		case ch <- data:
+		default:
+			klog.V(5).InfoS("dropped event for slow stream subscriber", "id", event.ID())
+		}
+	}
+}
+
+func (b *Broadcaster) Install(c *mux.PathRecorderMux) {
+	c.HandleFunc(PathEvents, b.serve)
+}
+
+// serve streams events as newline delimited json until the client goes away.
+func (b *Broadcaster) serve(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := b.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-events:
+			if _, err := w.Write(append(data, '\n')); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
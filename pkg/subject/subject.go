@@ -0,0 +1,144 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package subject
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// Data is what subject templates are evaluated with. Every value is a
+// single subject token: characters that are invalid in NATS subjects,
+// including ".", are replaced with "_", and empty values become "_".
+type Data struct {
+	// Subject is the subject assigned to the license.
+	Subject   string
+	ClusterID string
+	// Type is the event type, one of created, updated and deleted.
+	Type string
+	// ResourceID identifies the resource. The core group is "core".
+	ResourceID  kmapi.ResourceID
+	Namespace   string
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// Template renders the subject of every event, like
+// "audit.{{.ClusterID}}.{{.ResourceID.Group}}.{{.ResourceID.Kind}}.{{.Namespace}}.{{.Type}}".
+type Template struct {
+	tmpl *template.Template
+}
+
+// Parse parses a subject template. Referring to fields that Data doesn't
+// have is an error. Missing keys of Labels and Annotations are not, they
+// render as "_".
+func Parse(text string) (*Template, error) {
+	tmpl, err := template.New("subject").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subject template: %v", err)
+	}
+	if err := tmpl.Execute(io.Discard, sanitize(Data{})); err != nil {
+		return nil, fmt.Errorf("invalid subject template: %v", err)
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// NewData returns the template data of an audit cloudevent.
+func NewData(event *cloudevents.Event, subject, clusterID string) (Data, error) {
+	var payload cloudevent.Payload
+	if err := event.DataAs(&payload); err != nil {
+		return Data{}, err
+	}
+	if payload.Resource == nil {
+		return Data{}, fmt.Errorf("event %s has no resource", event.ID())
+	}
+	rid := payload.ResourceID
+	if rid.Group == "" {
+		rid.Group = "core"
+	}
+	return Data{
+		Subject:     subject,
+		ClusterID:   clusterID,
+		Type:        cloudevent.TypeName(event.Type()),
+		ResourceID:  rid,
+		Namespace:   payload.Resource.GetNamespace(),
+		Name:        payload.Resource.GetName(),
+		Labels:      payload.Resource.GetLabels(),
+		Annotations: payload.Resource.GetAnnotations(),
+	}, nil
+}
+
+// Execute renders the subject. Empty tokens are replaced with "_".
+func (t *Template) Execute(data Data) (string, error) {
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&sb, sanitize(data)); err != nil {
+		return "", fmt.Errorf("failed to render subject: %v", err)
+	}
+	tokens := strings.Split(sb.String(), ".")
+	for i, token := range tokens {
+		tokens[i] = Token(token)
+	}
+	return strings.Join(tokens, "."), nil
+}
+
+func sanitize(d Data) Data {
+	// the subject of the license is a prefix that may span several tokens
+	d.ClusterID = Token(d.ClusterID)
+	d.Type = Token(d.Type)
+	d.ResourceID.Group = Token(d.ResourceID.Group)
+	d.ResourceID.Version = Token(d.ResourceID.Version)
+	d.ResourceID.Name = Token(d.ResourceID.Name)
+	d.ResourceID.Kind = Token(d.ResourceID.Kind)
+	d.ResourceID.Scope = kmapi.ResourceScope(Token(string(d.ResourceID.Scope)))
+	d.Namespace = Token(d.Namespace)
+	d.Name = Token(d.Name)
+	d.Labels = sanitizeMap(d.Labels)
+	d.Annotations = sanitizeMap(d.Annotations)
+	return d
+}
+
+func sanitizeMap(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = Token(v)
+	}
+	return out
+}
+
+// Token makes s a valid NATS subject token by replacing ".", the "*" and
+// ">" wildcards, whitespace and control characters with "_". An empty
+// token becomes "_".
+func Token(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '*' || r == '>' || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package subject
+
+import (
+	"testing"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+func TestToken(t *testing.T) {
+	cases := map[string]string{
+		"":               "_",
+		"configmaps":     "configmaps",
+		"apps.k8s.io":    "apps_k8s_io",
+		"*":              "_",
+		"a>b":            "a_b",
+		"with space":     "with_space",
+		"tab\tnewline\n": "tab_newline_",
+		"nul\x00":        "nul_",
+	}
+	for in, want := range cases {
+		if got := Token(in); got != want {
+			t.Errorf("Token(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, text := range []string{
+		"{{.Subject}}.{{.ClusterID}}",
+		`{{index .Labels "app"}}`,
+		"{{.Labels.app}}",
+	} {
+		if _, err := Parse(text); err != nil {
+			t.Errorf("Parse(%q) failed: %v", text, err)
+		}
+	}
+	for _, text := range []string{
+		"{{.Cluster}}",
+		"{{.ResourceID.Plural}}",
+		"{{.Subject",
+	} {
+		if _, err := Parse(text); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", text)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	data := Data{
+		Subject:   "audit.license",
+		ClusterID: "c1",
+		Type:      "created",
+		ResourceID: kmapi.ResourceID{
+			Group: "apps.k8s.io",
+			Kind:  "Deployment",
+		},
+		Namespace: "",
+		Name:      "web server",
+		Labels:    map[string]string{"app": "a*b"},
+	}
+	cases := []struct {
+		text string
+		want string
+	}{
+		{
+			// the subject of the license keeps its dots
+			text: "{{.Subject}}.{{.ClusterID}}.{{.ResourceID.Group}}.{{.ResourceID.Kind}}.{{.Type}}",
+			want: "audit.license.c1.apps_k8s_io.Deployment.created",
+		},
+		{
+			text: "x.{{.Namespace}}.{{.Name}}",
+			want: "x._.web_server",
+		},
+		{
+			text: "x.{{.Labels.app}}",
+			want: "x.a_b",
+		},
+		{
+			// a missing label, like a typo in its key, renders as "_"
+			text: "x.{{.Labels.ap}}",
+			want: "x._",
+		},
+		{
+			text: "x..y.>",
+			want: "x._.y._",
+		},
+	}
+	for _, c := range cases {
+		tmpl, err := Parse(c.text)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", c.text, err)
+		}
+		got, err := tmpl.Execute(data)
+		if err != nil {
+			t.Fatalf("Execute(%q) failed: %v", c.text, err)
+		}
+		if got != c.want {
+			t.Errorf("Execute(%q) = %q, want %q", c.text, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"kubeops.dev/auditor/pkg/store"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/server/mux"
+	"k8s.io/klog/v2"
+)
+
+const (
+	PathRevisions = "/timeline/revisions"
+	PathObject    = "/timeline/object"
+)
+
+type Handler struct {
+	s *store.Store
+}
+
+func NewHandler(s *store.Store) *Handler {
+	return &Handler{s: s}
+}
+
+func (h *Handler) Install(c *mux.PathRecorderMux) {
+	c.HandleFunc(PathRevisions, h.revisions)
+	c.HandleFunc(PathObject, h.object)
+}
+
+func (h *Handler) revisions(w http.ResponseWriter, r *http.Request) {
+	q, err := ParseQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	revisions, err := Revisions(h.s, q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, revisions)
+}
+
+func (h *Handler) object(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	q, err := ParseQuery(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	at := time.Now()
+	if v := values.Get("at"); v != "" {
+		if at, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid at: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	obj, err := ObjectAt(h.s, q, at)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, obj.Object)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.ErrorS(err, "failed to write timeline response")
+	}
+}
+
+// ParseQuery reads a store query from url query parameters.
+func ParseQuery(values url.Values) (store.Query, error) {
+	q := store.Query{
+		UID:       types.UID(values.Get("uid")),
+		Group:     values.Get("group"),
+		Version:   values.Get("version"),
+		Kind:      values.Get("kind"),
+		Namespace: values.Get("namespace"),
+		Name:      values.Get("name"),
+	}
+	var err error
+	if v := values.Get("since"); v != "" {
+		if q.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, fmt.Errorf("invalid since: %v", err)
+		}
+	}
+	if v := values.Get("until"); v != "" {
+		if q.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, fmt.Errorf("invalid until: %v", err)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			return q, fmt.Errorf("invalid limit: %v", err)
+		}
+	}
+	return q, nil
+}
+
+// QueryParams is the inverse of ParseQuery.
+func QueryParams(q store.Query) map[string]string {
+	params := map[string]string{}
+	set := func(k, v string) {
+		if v != "" {
+			params[k] = v
+		}
+	}
+	set("uid", string(q.UID))
+	set("group", q.Group)
+	set("version", q.Version)
+	set("kind", q.Kind)
+	set("namespace", q.Namespace)
+	set("name", q.Name)
+	if !q.Since.IsZero() {
+		set("since", q.Since.Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		set("until", q.Until.Format(time.RFC3339))
+	}
+	if q.Limit > 0 {
+		set("limit", strconv.Itoa(q.Limit))
+	}
+	return params
+}
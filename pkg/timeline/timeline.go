@@ -0,0 +1,133 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timeline
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"kubeops.dev/auditor/pkg/encryption"
+	"kubeops.dev/auditor/pkg/store"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	"gomodules.xyz/jsonpatch/v2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var ErrNotFound = errors.New("object not found in event store")
+
+// Revision is a stored create, update or delete event of an object.
+type Revision struct {
+	Seq             uint64        `json:"seq"`
+	Type            api.EventType `json:"type"`
+	Time            time.Time     `json:"time"`
+	UID             types.UID     `json:"uid"`
+	Namespace       string        `json:"namespace,omitempty"`
+	Name            string        `json:"name"`
+	ResourceVersion string        `json:"resourceVersion,omitempty"`
+	Generation      int64         `json:"generation,omitempty"`
+	// Diff lists the changes since the previous revision of the same object.
+	Diff []jsonpatch.Operation `json:"diff,omitempty"`
+}
+
+// Revisions returns every stored revision matching q in chronological
+// order, each with a diff against the previous revision of the same object.
+func Revisions(s *store.Store, q store.Query) ([]Revision, error) {
+	limit := q.Limit
+	q.Limit = 0
+	records, err := s.List(q)
+	if err != nil {
+		return nil, err
+	}
+
+	last := map[types.UID]*unstructured.Unstructured{}
+	result := make([]Revision, 0, len(records))
+	for _, rec := range records {
+		rev := Revision{
+			Seq:             rec.Seq,
+			Type:            rec.Type,
+			Time:            rec.Time,
+			UID:             rec.UID,
+			Namespace:       rec.Namespace,
+			Name:            rec.Name,
+			ResourceVersion: rec.ResourceVersion,
+			Generation:      rec.Generation,
+		}
+		if prev, ok := last[rec.UID]; ok && rec.Object != nil {
+			rev.Diff, err = Diff(prev, rec.Object)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if rec.Object != nil {
+			last[rec.UID] = rec.Object
+		}
+		result = append(result, rev)
+	}
+
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	return result, nil
+}
+
+// ObjectAt returns the object matching q as it was at the given time.
+// ErrNotFound is returned if the object did not exist at that time.
+func ObjectAt(s *store.Store, q store.Query, at time.Time) (*unstructured.Unstructured, error) {
+	q.Until = at
+	q.Limit = 1
+	records, err := s.List(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	rec := records[0]
+	if rec.Type == api.EventDeleted || rec.Object == nil {
+		return nil, ErrNotFound
+	}
+	return rec.Object, nil
+}
+
+// Diff returns the json patch that turns a into b, ignoring metadata that
+// changes on every revision. Encrypted fields are compared by their digest,
+// since their ciphertext changes on every revision.
+func Diff(a, b *unstructured.Unstructured) ([]jsonpatch.Operation, error) {
+	from, err := json.Marshal(withoutVolatileFields(a).Object)
+	if err != nil {
+		return nil, err
+	}
+	to, err := json.Marshal(withoutVolatileFields(b).Object)
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.CreatePatch(from, to)
+}
+
+// withoutVolatileFields drops metadata that changes on every revision and
+// is already reported on the Revision itself.
+func withoutVolatileFields(u *unstructured.Unstructured) *unstructured.Unstructured {
+	out := u.DeepCopy()
+	encryption.Stable(out.Object)
+	unstructured.RemoveNestedField(out.Object, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(out.Object, "metadata", "generation")
+	unstructured.RemoveNestedField(out.Object, "metadata", "managedFields")
+	return out
+}
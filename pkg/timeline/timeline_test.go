@@ -0,0 +1,332 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"kubeops.dev/auditor/pkg/encryption"
+	"kubeops.dev/auditor/pkg/store"
+
+	api "go.bytebuilders.dev/audit/api/v1"
+	"gomodules.xyz/jsonpatch/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/server/mux"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+var (
+	secretsID    = kmapi.ResourceID{Version: "v1", Name: "secrets", Kind: "Secret", Scope: kmapi.NamespaceScoped}
+	configMapsID = kmapi.ResourceID{Version: "v1", Name: "configmaps", Kind: "ConfigMap", Scope: kmapi.NamespaceScoped}
+)
+
+func openStore(t *testing.T, opts store.Options) *store.Store {
+	t.Helper()
+	opts.Path = filepath.Join(t.TempDir(), "events.db")
+	s, err := store.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func newSecret(generation int64, data map[string]interface{}) *api.Event {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"data":       data,
+	}}
+	u.SetNamespace("default")
+	u.SetName("db")
+	u.SetUID("uid-1")
+	u.SetGeneration(generation)
+	u.SetResourceVersion(strconv.FormatInt(generation, 10))
+	return &api.Event{ResourceID: secretsID, Resource: u}
+}
+
+func newConfigMap(rv string, data map[string]interface{}) *api.Event {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"data":       data,
+	}}
+	u.SetNamespace("default")
+	u.SetName("cm")
+	u.SetUID("uid-cm")
+	u.SetResourceVersion(rv)
+	return &api.Event{ResourceID: configMapsID, Resource: u}
+}
+
+// appendHistory stores the create, update and delete of a configmap and
+// returns the stored records.
+func appendHistory(t *testing.T, s *store.Store) []*store.Record {
+	t.Helper()
+	var records []*store.Record
+	for _, a := range []struct {
+		ev *api.Event
+		et api.EventType
+	}{
+		{newConfigMap("1", map[string]interface{}{"a": "1"}), api.EventCreated},
+		{newConfigMap("2", map[string]interface{}{"a": "2", "b": "1"}), api.EventUpdated},
+		{newConfigMap("2", map[string]interface{}{"a": "2", "b": "1"}), api.EventDeleted},
+	} {
+		rec, err := s.Append(a.ev, a.et)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+		// records are ordered by time, so that they are found at their time
+		time.Sleep(time.Millisecond)
+	}
+	return records
+}
+
+func TestRevisions(t *testing.T) {
+	s := openStore(t, store.Options{})
+	appendHistory(t, s)
+
+	revisions, err := Revisions(s, store.Query{UID: "uid-cm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []api.EventType
+	for _, rev := range revisions {
+		got = append(got, rev.Type)
+	}
+	if want := []api.EventType{api.EventCreated, api.EventUpdated, api.EventDeleted}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("revisions = %v, want %v", got, want)
+	}
+	if revisions[0].Diff != nil {
+		t.Errorf("first revision has a diff: %v", revisions[0].Diff)
+	}
+	want := []jsonpatch.Operation{
+		{Operation: "replace", Path: "/data/a", Value: "2"},
+		{Operation: "add", Path: "/data/b", Value: "1"},
+	}
+	// patches are built from maps, so their order is random
+	sort.Slice(revisions[1].Diff, func(i, j int) bool {
+		return revisions[1].Diff[i].Path < revisions[1].Diff[j].Path
+	})
+	if !reflect.DeepEqual(revisions[1].Diff, want) {
+		t.Errorf("diff = %v, want %v", revisions[1].Diff, want)
+	}
+	if len(revisions[2].Diff) != 0 {
+		t.Errorf("delete has a diff: %v", revisions[2].Diff)
+	}
+
+	revisions, err = Revisions(s, store.Query{UID: "uid-cm", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 || revisions[0].Type != api.EventDeleted {
+		t.Errorf("limited revisions = %v, want the delete", revisions)
+	}
+}
+
+func TestObjectAt(t *testing.T) {
+	s := openStore(t, store.Options{})
+	records := appendHistory(t, s)
+	q := store.Query{Namespace: "default", Name: "cm"}
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		want    map[string]interface{}
+		wantErr error
+	}{
+		{"before create", records[0].Time.Add(-time.Second), nil, ErrNotFound},
+		{"created", records[0].Time, map[string]interface{}{"a": "1"}, nil},
+		{"updated", records[1].Time, map[string]interface{}{"a": "2", "b": "1"}, nil},
+		{"deleted", records[2].Time, nil, ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj, err := ObjectAt(s, q, tt.at)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ObjectAt() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(obj.Object["data"], tt.want) {
+				t.Errorf("data = %v, want %v", obj.Object["data"], tt.want)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := newConfigMap("1", map[string]interface{}{"a": "1"}).Resource.(*unstructured.Unstructured)
+
+	b := a.DeepCopy()
+	b.SetResourceVersion("2")
+	b.SetGeneration(2)
+	b.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: "kubectl"}})
+	diff, err := Diff(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 0 {
+		t.Errorf("volatile metadata reported as changed: %v", diff)
+	}
+	if a.GetResourceVersion() != "1" {
+		t.Error("Diff changed its input")
+	}
+
+	b.SetLabels(map[string]string{"app": "db"})
+	diff, err = Diff(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []jsonpatch.Operation{{Operation: "add", Path: "/metadata/labels", Value: map[string]interface{}{"app": "db"}}}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff = %v, want %v", diff, want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	s := openStore(t, store.Options{})
+	records := appendHistory(t, s)
+	c := mux.NewPathRecorderMux("test")
+	NewHandler(s).Install(c)
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	get := func(path string, params map[string]string) *http.Response {
+		t.Helper()
+		values := url.Values{}
+		for k, v := range params {
+			values.Set(k, v)
+		}
+		resp, err := http.Get(srv.URL + path + "?" + values.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+
+	resp := get(PathRevisions, QueryParams(store.Query{UID: "uid-cm"}))
+	var revisions []Revision
+	if err := json.NewDecoder(resp.Body).Decode(&revisions); err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 || len(revisions[1].Diff) != 2 {
+		t.Errorf("revisions = %v, want 3 with an update diff", revisions)
+	}
+
+	live := newConfigMap("1", map[string]interface{}{"a": "1"})
+	live.Resource.SetUID("uid-live")
+	if _, err := s.Append(live, api.EventCreated); err != nil {
+		t.Fatal(err)
+	}
+	resp = get(PathObject, QueryParams(store.Query{UID: "uid-live"}))
+	var obj map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"a": "1"}; !reflect.DeepEqual(obj["data"], want) {
+		t.Errorf("object data = %v, want %v", obj["data"], want)
+	}
+
+	params := QueryParams(store.Query{UID: "uid-cm"})
+	if resp := get(PathObject, params); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("object status after delete = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+	params["at"] = records[0].Time.Add(-time.Hour).Format(time.RFC3339)
+	if resp := get(PathObject, params); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("object status before create = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+	params["at"] = "yesterday"
+	if resp := get(PathObject, params); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("object status with a bad time = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+	if resp := get(PathRevisions, map[string]string{"limit": "all"}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("revisions status with a bad limit = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestRevisionsEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{7}, 32)
+	if err := os.WriteFile(filepath.Join(dir, "k1"+encryption.KeyFileExt), key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy := &encryption.Policy{Rules: []encryption.Rule{{Resources: []string{"secrets"}, Paths: []string{"$.data"}}}}
+	e, err := encryption.NewEncrypter(policy, dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := openStore(t, store.Options{Encrypter: e})
+
+	password := map[string]interface{}{"password": "c2VjcmV0"}
+	for i, ev := range []*api.Event{
+		newSecret(1, password),
+		newSecret(2, password),
+		newSecret(3, map[string]interface{}{"password": "b3RoZXI="}),
+	} {
+		et := api.EventUpdated
+		if i == 0 {
+			et = api.EventCreated
+		}
+		if _, err := s.Append(ev, et); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := store.Query{UID: types.UID("uid-1")}
+	revisions, err := Revisions(s, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("got %d revisions, want 3", len(revisions))
+	}
+	if len(revisions[1].Diff) != 0 {
+		t.Errorf("unchanged encrypted field reported as changed: %v", revisions[1].Diff)
+	}
+	if len(revisions[2].Diff) == 0 {
+		t.Error("changed encrypted field not reported")
+	}
+
+	obj, err := ObjectAt(s, q, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(obj.Object["data"], password) {
+		t.Fatal("stored object holds plaintext")
+	}
+	keys := map[string][]byte{"k1": key}
+	if _, err := encryption.NewDecrypter(keys).DecryptObject(obj); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"password": "b3RoZXI="}; !reflect.DeepEqual(obj.Object["data"], want) {
+		t.Errorf("data = %v, want %v", obj.Object["data"], want)
+	}
+}
@@ -22,16 +22,153 @@ import (
 	"kubeops.dev/auditor/test/e2e/framework"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	api "go.bytebuilders.dev/audit/api/v1"
+	"kmodules.xyz/custom-resources/apis/auditor/v1alpha1"
 )
 
 var _ = Describe("Auditor E2E testing", func() {
-	var f *framework.Invocation
+	var (
+		f       *framework.Invocation
+		auditor *framework.Auditor
+	)
 
 	BeforeEach(func() {
 		f = root.Invoke()
 		fmt.Println(f.Name())
 	})
 
+	AfterEach(func() {
+		if auditor != nil {
+			By("Stopping the auditor")
+			auditor.Stop()
+			auditor = nil
+		}
+	})
+
+	deployAuditor := func(policy v1alpha1.AuditRegistration, opts ...framework.AuditorOption) {
+		By("Deploying the auditor")
+		var err error
+		auditor, err = f.DeployAuditor(policy, opts...)
+		Expect(err).NotTo(HaveOccurred())
+		f.EventuallyAuditorReady(auditor).Should(Succeed())
+	}
+
 	Describe("AuditRegistration Operation", func() {
+		Context("Include and exclude", func() {
+			BeforeEach(func() {
+				deployAuditor(v1alpha1.AuditRegistration{
+					Resources: []v1alpha1.GroupResources{
+						{Group: "apps", Resources: []string{"deployments"}},
+					},
+				})
+			})
+
+			It("should audit only the resources in the policy", func() {
+				By("Creating a deployment")
+				dep, err := f.CreateDeployment(f.Deployment())
+				Expect(err).NotTo(HaveOccurred())
+				deployment := framework.EventMatcher{Group: "apps", Kind: "Deployment", Namespace: dep.Namespace, Name: dep.Name}
+
+				By("Creating a configmap")
+				cm, err := f.CreateConfigMap(f.ConfigMap(f.Namespace()))
+				Expect(err).NotTo(HaveOccurred())
+
+				deployment.Type = api.EventCreated
+				f.EventuallyEvents(deployment).Should(HaveLen(1))
+				f.ConsistentlyEvents(framework.EventMatcher{Kind: "ConfigMap", Namespace: cm.Namespace, Name: cm.Name}).Should(BeEmpty())
+
+				By("Scaling the deployment")
+				_, err = f.ScaleDeployment(dep.ObjectMeta, 2)
+				Expect(err).NotTo(HaveOccurred())
+				deployment.Type = api.EventUpdated
+				f.EventuallyEvents(deployment).Should(HaveLen(1))
+
+				By("Deleting the deployment")
+				Expect(f.DeleteDeployment(dep.ObjectMeta)).To(Succeed())
+				deployment.Type = api.EventDeleted
+				f.EventuallyEvents(deployment).Should(HaveLen(1))
+
+				Expect(f.DeleteConfigMap(cm.ObjectMeta)).To(Succeed())
+			})
+		})
+
+		Context("Namespace scoping", func() {
+			var extra string
+
+			BeforeEach(func() {
+				var err error
+				extra, err = f.CreateExtraNamespace()
+				Expect(err).NotTo(HaveOccurred())
+
+				deployAuditor(v1alpha1.AuditRegistration{
+					Resources: []v1alpha1.GroupResources{
+						{Resources: []string{"configmaps"}},
+					},
+				})
+			})
+
+			AfterEach(func() {
+				Expect(f.DeleteExtraNamespace(extra)).To(Succeed())
+			})
+
+			It("should attribute events to the namespace of the object", func() {
+				By("Creating configmaps with the same name in two namespaces")
+				cm, err := f.CreateConfigMap(f.ConfigMap(f.Namespace()))
+				Expect(err).NotTo(HaveOccurred())
+				other, err := f.CreateConfigMap(f.ConfigMap(extra))
+				Expect(err).NotTo(HaveOccurred())
+
+				f.EventuallyEvents(framework.EventMatcher{Type: api.EventCreated, Kind: "ConfigMap", Namespace: cm.Namespace, Name: cm.Name}).
+					Should(ConsistOf(HaveField("UID", cm.UID)))
+				f.EventuallyEvents(framework.EventMatcher{Type: api.EventCreated, Kind: "ConfigMap", Namespace: extra, Name: other.Name}).
+					Should(ConsistOf(HaveField("UID", other.UID)))
+
+				By("Deleting the configmap of the extra namespace")
+				Expect(f.DeleteConfigMap(other.ObjectMeta)).To(Succeed())
+				f.EventuallyEvents(framework.EventMatcher{Type: api.EventDeleted, Kind: "ConfigMap", Namespace: extra, Name: other.Name}).
+					Should(HaveLen(1))
+				f.ConsistentlyEvents(framework.EventMatcher{Type: api.EventDeleted, Kind: "ConfigMap", Namespace: cm.Namespace, Name: cm.Name}).
+					Should(BeEmpty())
+
+				Expect(f.DeleteConfigMap(cm.ObjectMeta)).To(Succeed())
+			})
+		})
+
+		Context("Restart", func() {
+			BeforeEach(func() {
+				deployAuditor(v1alpha1.AuditRegistration{
+					Resources: []v1alpha1.GroupResources{
+						{Group: "apps", Resources: []string{"deployments"}},
+					},
+				}, framework.WithLeaderElection(f.Namespace()))
+			})
+
+			It("should not replay objects that were already published", func() {
+				By("Creating a deployment")
+				dep, err := f.CreateDeployment(f.Deployment())
+				Expect(err).NotTo(HaveOccurred())
+				deployment := framework.EventMatcher{Group: "apps", Kind: "Deployment", Namespace: dep.Namespace, Name: dep.Name}
+				f.EventuallyEvents(deployment).Should(HaveLen(1))
+
+				By("Changing only the labels of the deployment")
+				_, err = f.LabelDeployment(dep.ObjectMeta, "auditor.e2e/restart", "true")
+				Expect(err).NotTo(HaveOccurred())
+
+				By("Restarting the auditor")
+				auditor, err = auditor.Restart()
+				Expect(err).NotTo(HaveOccurred())
+				f.EventuallyAuditorReady(auditor).Should(Succeed())
+				f.ConsistentlyEvents(deployment).Should(HaveLen(1))
+
+				By("Scaling the deployment")
+				_, err = f.ScaleDeployment(dep.ObjectMeta, 2)
+				Expect(err).NotTo(HaveOccurred())
+				f.EventuallyEvents(framework.EventMatcher{Type: api.EventUpdated, Group: "apps", Kind: "Deployment", Namespace: dep.Namespace, Name: dep.Name}).
+					Should(HaveLen(1))
+
+				Expect(f.DeleteDeployment(dep.ObjectMeta)).To(Succeed())
+			})
+		})
 	})
 })
@@ -35,7 +35,10 @@ const (
 	TIMEOUT = 20 * time.Minute
 )
 
-var root *framework.Framework
+var (
+	root     *framework.Framework
+	receiver *framework.EventReceiver
+)
 
 func TestE2e(t *testing.T) {
 	logs.InitLogs()
@@ -58,8 +61,12 @@ var _ = BeforeSuite(func() {
 	err = options.ApplyTo(ctrlConfig)
 	Expect(err).NotTo(HaveOccurred())
 
+	By("Starting the event receiver")
+	receiver, err = framework.StartEventReceiver()
+	Expect(err).NotTo(HaveOccurred())
+
 	// Framework
-	root = framework.New(clientConfig, ctrlConfig.KubeClient)
+	root = framework.New(clientConfig, ctrlConfig, receiver)
 
 	By("Creating namespace " + root.Namespace())
 	err = root.CreateNamespace()
@@ -70,4 +77,7 @@ var _ = AfterSuite(func() {
 	By("Deleting Namespace")
 	err := root.DeleteNamespace()
 	Expect(err).NotTo(HaveOccurred())
+
+	By("Stopping the event receiver")
+	receiver.Stop()
 })
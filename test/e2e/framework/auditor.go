@@ -0,0 +1,113 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"fmt"
+	"time"
+
+	"kubeops.dev/auditor/pkg/controller"
+
+	"kmodules.xyz/custom-resources/apis/auditor/v1alpha1"
+)
+
+// Auditor is an auditor running in the test process, that publishes to the
+// EventReceiver of the framework.
+type Auditor struct {
+	config controller.Config
+	ctrl   *controller.AuditorController
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+// AuditorOption customizes the config of an auditor before it is deployed.
+type AuditorOption func(cfg *controller.Config)
+
+// WithLeaderElection makes the auditor run as the leader of the given
+// namespace, which also persists its dedupe state there.
+func WithLeaderElection(namespace string) AuditorOption {
+	return func(cfg *controller.Config) {
+		cfg.LeaderElection = controller.LeaderElectionConfig{
+			Enabled:       true,
+			Namespace:     namespace,
+			LeaseName:     "auditor",
+			LeaseDuration: 15 * time.Second,
+			RenewDeadline: 10 * time.Second,
+			RetryPeriod:   2 * time.Second,
+		}
+	}
+}
+
+// DeployAuditor starts an auditor that watches the resources selected by
+// policy. The config is based on the flags the tests were run with.
+func (f *Framework) DeployAuditor(policy v1alpha1.AuditRegistration, opts ...AuditorOption) (*Auditor, error) {
+	cfg := *f.ctrlConfig
+	cfg.Policy = policy
+	cfg.Connect = f.receiver.Connect
+	// the AuditorStatus CRD may not be installed in the test cluster
+	cfg.Status = controller.StatusConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return startAuditor(cfg)
+}
+
+func startAuditor(cfg controller.Config) (*Auditor, error) {
+	ctrl, err := cfg.New()
+	if err != nil {
+		return nil, err
+	}
+	a := &Auditor{
+		config: cfg,
+		ctrl:   ctrl,
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(a.done)
+		ctrl.Run(a.stopCh)
+	}()
+	return a, nil
+}
+
+// Stop stops the auditor and waits until it has shut down.
+func (a *Auditor) Stop() {
+	close(a.stopCh)
+	<-a.done
+}
+
+// Restart stops the auditor and starts a new one with the same config.
+func (a *Auditor) Restart() (*Auditor, error) {
+	a.Stop()
+	return startAuditor(a.config)
+}
+
+// Ready returns an error until the informers of the auditor have synced.
+// Unlike the readiness of the auditor pod, it doesn't wait for the
+// connection to the event receiver, which is only made once there is an event
+// to publish.
+func (a *Auditor) Ready() error {
+	for _, check := range a.ctrl.ReadyzChecks() {
+		if check.Name() != "informer-sync" {
+			continue
+		}
+		if err := check.Check(nil); err != nil {
+			return fmt.Errorf("%s: %v", check.Name(), err)
+		}
+	}
+	return nil
+}
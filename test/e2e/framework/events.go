@@ -0,0 +1,53 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+const (
+	eventTimeout  = 2 * time.Minute
+	eventInterval = time.Second
+	// quietPeriod is how long events are watched for to make sure none
+	// arrive.
+	quietPeriod = 15 * time.Second
+)
+
+// EventuallyEvents polls the events received for m until the assertion
+// holds.
+func (f *Framework) EventuallyEvents(m EventMatcher) AsyncAssertion {
+	return Eventually(func() []Event {
+		return f.receiver.Events(m)
+	}, eventTimeout, eventInterval)
+}
+
+// ConsistentlyEvents checks that the assertion holds for the events received
+// for m during a quiet period.
+func (f *Framework) ConsistentlyEvents(m EventMatcher) AsyncAssertion {
+	return Consistently(func() []Event {
+		return f.receiver.Events(m)
+	}, quietPeriod, eventInterval)
+}
+
+// EventuallyAuditorReady polls the readiness checks of an auditor until
+// they pass.
+func (f *Framework) EventuallyAuditorReady(a *Auditor) AsyncAssertion {
+	return Eventually(a.Ready, eventTimeout, eventInterval)
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package framework
 
 import (
+	"kubeops.dev/auditor/pkg/controller"
+
 	"gomodules.xyz/x/crypto/rand"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -25,6 +27,8 @@ import (
 type Framework struct {
 	restConfig *rest.Config
 	kubeClient kubernetes.Interface
+	ctrlConfig *controller.Config
+	receiver   *EventReceiver
 
 	namespace string
 	name      string
@@ -32,11 +36,14 @@ type Framework struct {
 
 func New(
 	restConfig *rest.Config,
-	kubeClient kubernetes.Interface,
+	ctrlConfig *controller.Config,
+	receiver *EventReceiver,
 ) *Framework {
 	return &Framework{
 		restConfig: restConfig,
-		kubeClient: kubeClient,
+		kubeClient: ctrlConfig.KubeClient,
+		ctrlConfig: ctrlConfig,
+		receiver:   receiver,
 
 		name:      rand.WithUniqSuffix("auditor"),
 		namespace: rand.WithUniqSuffix("auditor"),
@@ -19,6 +19,7 @@ package framework
 import (
 	"context"
 
+	"gomodules.xyz/x/crypto/rand"
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	meta_util "kmodules.xyz/client-go/meta"
@@ -41,3 +42,19 @@ func (f *Framework) CreateNamespace() error {
 func (f *Framework) DeleteNamespace() error {
 	return f.kubeClient.CoreV1().Namespaces().Delete(context.TODO(), f.namespace, meta_util.DeleteInForeground())
 }
+
+// CreateExtraNamespace creates a namespace besides the one of the framework,
+// and returns its name.
+func (f *Framework) CreateExtraNamespace() (string, error) {
+	obj := &core.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: rand.WithUniqSuffix("auditor-extra"),
+		},
+	}
+	_, err := f.kubeClient.CoreV1().Namespaces().Create(context.TODO(), obj, metav1.CreateOptions{})
+	return obj.Name, err
+}
+
+func (f *Framework) DeleteExtraNamespace(name string) error {
+	return f.kubeClient.CoreV1().Namespaces().Delete(context.TODO(), name, meta_util.DeleteInForeground())
+}
@@ -0,0 +1,172 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"sync"
+	"time"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+	"kubeops.dev/auditor/pkg/publisher"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	api "go.bytebuilders.dev/audit/api/v1"
+	"go.bytebuilders.dev/audit/lib"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	receiverLicenseID = "e2e-license"
+	receiverSubject   = "auditor.e2e.events"
+)
+
+// Event is an audit event received by the EventReceiver.
+type Event struct {
+	Type       api.EventType
+	ID         string
+	Group      string
+	Kind       string
+	Namespace  string
+	Name       string
+	UID        types.UID
+	Generation int64
+	Received   time.Time
+}
+
+// EventReceiver stands in for the event receiver of the license. It runs an
+// embedded NATS server, and acknowledges and keeps every event published to
+// it.
+type EventReceiver struct {
+	server *server.Server
+	conn   *nats.Conn
+
+	mu     sync.Mutex
+	events []Event
+}
+
+// StartEventReceiver starts a receiver that listens on a random local port.
+func StartEventReceiver() (*EventReceiver, error) {
+	srv, err := server.NewServer(&server.Options{
+		Host:   "127.0.0.1",
+		Port:   server.RANDOM_PORT,
+		NoLog:  true,
+		NoSigs: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(10 * time.Second) {
+		srv.Shutdown()
+		return nil, server.ErrServerNotRunning
+	}
+
+	r := &EventReceiver{server: srv}
+	if r.conn, err = nats.Connect(srv.ClientURL()); err != nil {
+		srv.Shutdown()
+		return nil, err
+	}
+	if _, err = r.conn.Subscribe(receiverSubject, r.receive); err != nil {
+		r.Stop()
+		return nil, err
+	}
+	if err = r.conn.Flush(); err != nil {
+		r.Stop()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *EventReceiver) receive(msg *nats.Msg) {
+	event, payload, err := cloudevent.Decode(msg.Data)
+	if err != nil {
+		klog.ErrorS(err, "failed to decode audit event")
+		return
+	}
+	r.mu.Lock()
+	r.events = append(r.events, Event{
+		Type:       api.EventType(event.Type()),
+		ID:         event.ID(),
+		Group:      payload.ResourceID.Group,
+		Kind:       payload.ResourceID.Kind,
+		Namespace:  payload.Resource.GetNamespace(),
+		Name:       payload.Resource.GetName(),
+		UID:        payload.Resource.GetUID(),
+		Generation: payload.Resource.GetGeneration(),
+		Received:   time.Now(),
+	})
+	r.mu.Unlock()
+	// NatsSink retries events until they are acknowledged
+	if err := msg.Respond(nil); err != nil {
+		klog.ErrorS(err, "failed to acknowledge audit event", "id", event.ID())
+	}
+}
+
+// Connect connects an auditor to the receiver. It is used as
+// controller.Config.Connect.
+func (r *EventReceiver) Connect() (publisher.Sink, error) {
+	nc, err := nats.Connect(r.server.ClientURL())
+	if err != nil {
+		return nil, err
+	}
+	return publisher.NewNatsSink(&lib.NatsConfig{
+		LicenseID: receiverLicenseID,
+		Subject:   receiverSubject,
+		Server:    r.server.ClientURL(),
+		Client:    nc,
+	}), nil
+}
+
+// Events returns the received events selected by m, in the order they
+// arrived.
+func (r *EventReceiver) Events(m EventMatcher) []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Event
+	for _, e := range r.events {
+		if m.Matches(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (r *EventReceiver) Stop() {
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.server.Shutdown()
+}
+
+// EventMatcher selects events. Empty fields match any value.
+type EventMatcher struct {
+	Type      api.EventType
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (m EventMatcher) Matches(e Event) bool {
+	return (m.Type == "" || m.Type == e.Type) &&
+		(m.Group == "" || m.Group == e.Group) &&
+		(m.Kind == "" || m.Kind == e.Kind) &&
+		(m.Namespace == "" || m.Namespace == e.Namespace) &&
+		(m.Name == "" || m.Name == e.Name)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"context"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/pointer"
+	meta_util "kmodules.xyz/client-go/meta"
+)
+
+func (fi *Invocation) Deployment() *apps.Deployment {
+	labels := map[string]string{
+		"app.kubernetes.io/name":     "auditor-e2e",
+		"app.kubernetes.io/instance": fi.app,
+	}
+	return &apps.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fi.app,
+			Namespace: fi.namespace,
+			Labels:    labels,
+		},
+		Spec: apps.DeploymentSpec{
+			Replicas: pointer.Int32(1),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: core.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: core.PodSpec{
+					Containers: []core.Container{
+						{
+							Name:  "pause",
+							Image: "registry.k8s.io/pause:3.8",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (f *Framework) CreateDeployment(obj *apps.Deployment) (*apps.Deployment, error) {
+	return f.kubeClient.AppsV1().Deployments(obj.Namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+}
+
+// ScaleDeployment changes the spec of a deployment, which bumps its
+// generation.
+func (f *Framework) ScaleDeployment(meta metav1.ObjectMeta, replicas int32) (*apps.Deployment, error) {
+	var out *apps.Deployment
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cur, err := f.kubeClient.AppsV1().Deployments(meta.Namespace).Get(context.TODO(), meta.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		cur.Spec.Replicas = pointer.Int32(replicas)
+		out, err = f.kubeClient.AppsV1().Deployments(meta.Namespace).Update(context.TODO(), cur, metav1.UpdateOptions{})
+		return err
+	})
+	return out, err
+}
+
+// LabelDeployment only changes the metadata of a deployment, which keeps its
+// generation.
+func (f *Framework) LabelDeployment(meta metav1.ObjectMeta, key, value string) (*apps.Deployment, error) {
+	var out *apps.Deployment
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cur, err := f.kubeClient.AppsV1().Deployments(meta.Namespace).Get(context.TODO(), meta.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		cur.Labels = meta_util.OverwriteKeys(cur.Labels, map[string]string{key: value})
+		out, err = f.kubeClient.AppsV1().Deployments(meta.Namespace).Update(context.TODO(), cur, metav1.UpdateOptions{})
+		return err
+	})
+	return out, err
+}
+
+// DeleteDeployment deletes a deployment right away, and leaves its replica
+// sets to the garbage collector.
+func (f *Framework) DeleteDeployment(meta metav1.ObjectMeta) error {
+	return f.kubeClient.AppsV1().Deployments(meta.Namespace).Delete(context.TODO(), meta.Name, meta_util.DeleteInBackground())
+}
+
+func (fi *Invocation) ConfigMap(namespace string) *core.ConfigMap {
+	return &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fi.app,
+			Namespace: namespace,
+		},
+		Data: map[string]string{
+			"app": fi.app,
+		},
+	}
+}
+
+func (f *Framework) CreateConfigMap(obj *core.ConfigMap) (*core.ConfigMap, error) {
+	return f.kubeClient.CoreV1().ConfigMaps(obj.Namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+}
+
+func (f *Framework) DeleteConfigMap(meta metav1.ObjectMeta) error {
+	return f.kubeClient.CoreV1().ConfigMaps(meta.Namespace).Delete(context.TODO(), meta.Name, metav1.DeleteOptions{})
+}
@@ -30,8 +30,6 @@ type E2EOptions struct {
 
 	kubeContext string
 	kubeConfig  string
-
-	apiKey string
 }
 
 var options = &E2EOptions{
@@ -44,5 +42,4 @@ var options = &E2EOptions{
 		}
 		return filepath.Join(homedir.HomeDir(), ".kube", "config")
 	}(),
-	apiKey: "admin:admin",
 }
@@ -0,0 +1,191 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"kubeops.dev/auditor/pkg/cloudevent"
+	"kubeops.dev/auditor/pkg/controller"
+	"kubeops.dev/auditor/pkg/publisher"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	. "github.com/onsi/gomega"
+	api "go.bytebuilders.dev/audit/api/v1"
+	"gomodules.xyz/x/crypto/rand"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"kmodules.xyz/custom-resources/apis/auditor/v1alpha1"
+)
+
+var auditorStatusGVR = schema.GroupVersionResource{
+	Group:    "auditor.kubeops.dev",
+	Version:  "v1alpha1",
+	Resource: "auditorstatuses",
+}
+
+// Auditor is an AuditorController running against the test control plane,
+// through a watchProxy.
+type Auditor struct {
+	name   string
+	proxy  *watchProxy
+	sink   *memorySink
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+// StartAuditor runs an auditor with the given policy until Stop is called.
+func StartAuditor(policy v1alpha1.AuditRegistration, resyncPeriod time.Duration) *Auditor {
+	proxy, cfg := newWatchProxy(restConfig)
+	a := &Auditor{
+		name:   rand.WithUniqSuffix("auditor"),
+		proxy:  proxy,
+		sink:   &memorySink{},
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	ctrlConfig := controller.NewConfig(cfg)
+	ctrlConfig.Policy = policy
+	ctrlConfig.ResyncPeriod = resyncPeriod
+	ctrlConfig.Status = controller.StatusConfig{
+		Interval:  time.Second,
+		Namespace: metav1.NamespaceDefault,
+		Name:      a.name,
+	}
+	ctrlConfig.Connect = func() (publisher.Sink, error) {
+		return a.sink, nil
+	}
+
+	var err error
+	ctrlConfig.KubeClient, err = kubernetes.NewForConfig(cfg)
+	Expect(err).NotTo(HaveOccurred())
+	ctrlConfig.DynamicClient, err = dynamic.NewForConfig(cfg)
+	Expect(err).NotTo(HaveOccurred())
+	ctrlConfig.MetadataClient, err = metadata.NewForConfig(cfg)
+	Expect(err).NotTo(HaveOccurred())
+
+	ctrl, err := ctrlConfig.New()
+	Expect(err).NotTo(HaveOccurred())
+	go func() {
+		defer close(a.done)
+		ctrl.Run(a.stopCh)
+	}()
+	return a
+}
+
+// Stop stops the auditor and waits until it is done.
+func (a *Auditor) Stop() {
+	close(a.stopCh)
+	<-a.done
+	a.proxy.Close()
+	_ = dynamicClient.Resource(auditorStatusGVR).Namespace(metav1.NamespaceDefault).Delete(context.TODO(), a.name, metav1.DeleteOptions{})
+}
+
+// Watched returns the resources the auditor reports as watched and synced
+// in its AuditorStatus.
+func (a *Auditor) Watched() ([]string, error) {
+	obj, err := dynamicClient.Resource(auditorStatusGVR).Namespace(metav1.NamespaceDefault).Get(context.TODO(), a.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	resources, _, err := unstructured.NestedSlice(obj.Object, "status", "resources")
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, r := range resources {
+		m := r.(map[string]interface{})
+		if synced, _ := m["synced"].(bool); !synced {
+			continue
+		}
+		group, _ := m["group"].(string)
+		resource, _ := m["resource"].(string)
+		out = append(out, schema.GroupResource{Group: group, Resource: resource}.String())
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Events returns the events published for the object with the given kind and
+// name, in order.
+func (a *Auditor) Events(kind, name string) []api.EventType {
+	return a.sink.events(kind, name)
+}
+
+// BlockWatches ends the watches of the auditor, and makes new ones fail as
+// expired until UnblockWatches is called.
+func (a *Auditor) BlockWatches() {
+	a.proxy.Block()
+}
+
+func (a *Auditor) UnblockWatches() {
+	a.proxy.Unblock()
+}
+
+// memorySink keeps the events published to it in memory.
+type memorySink struct {
+	mu       sync.Mutex
+	received []received
+}
+
+type received struct {
+	eventType api.EventType
+	kind      string
+	name      string
+}
+
+var _ publisher.Sink = &memorySink{}
+
+func (s *memorySink) Send(event *cloudevents.Event) error {
+	var payload cloudevent.Payload
+	if err := event.DataAs(&payload); err != nil {
+		return fmt.Errorf("failed to decode event %s: %v", event.ID(), err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, received{
+		eventType: api.EventType(event.Type()),
+		kind:      payload.ResourceID.Kind,
+		name:      payload.Resource.GetName(),
+	})
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+func (s *memorySink) events(kind, name string) []api.EventType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []api.EventType
+	for _, r := range s.received {
+		if r.kind == kind && r.name == name {
+			out = append(out, r.eventType)
+		}
+	}
+	return out
+}
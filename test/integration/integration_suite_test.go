@@ -0,0 +1,84 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gomodules.xyz/logs"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+const (
+	TIMEOUT = 30 * time.Second
+)
+
+var (
+	testEnv       *envtest.Environment
+	restConfig    *rest.Config
+	kubeClient    kubernetes.Interface
+	dynamicClient dynamic.Interface
+)
+
+func TestIntegration(t *testing.T) {
+	// envtest runs the etcd and kube-apiserver binaries found there, eg.
+	// as installed by `setup-envtest use -p path`
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set")
+	}
+
+	logs.InitLogs()
+	RegisterFailHandler(Fail)
+	SetDefaultEventuallyTimeout(TIMEOUT)
+	RunSpecs(t, "Integration Suite")
+}
+
+var _ = BeforeSuite(func() {
+	By("Starting the test control plane")
+	testEnv = &envtest.Environment{
+		CRDDirectoryPaths: []string{
+			filepath.Join("..", "..", "crds"),
+			filepath.Join("testdata", "crds"),
+		},
+		ErrorIfCRDPathMissing: true,
+	}
+	var err error
+	restConfig, err = testEnv.Start()
+	Expect(err).NotTo(HaveOccurred())
+	restConfig.QPS = 100
+	restConfig.Burst = 100
+
+	kubeClient, err = kubernetes.NewForConfig(restConfig)
+	Expect(err).NotTo(HaveOccurred())
+	dynamicClient, err = dynamic.NewForConfig(restConfig)
+	Expect(err).NotTo(HaveOccurred())
+})
+
+var _ = AfterSuite(func() {
+	By("Stopping the test control plane")
+	if testEnv != nil {
+		Expect(testEnv.Stop()).To(Succeed())
+	}
+})
@@ -0,0 +1,129 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// watchProxy forwards requests to the api server. It can cut off watches, so
+// that informers relist as they do after being disconnected for longer than
+// the api server keeps the history of a resource. Objects deleted in the
+// meantime are then handed to the auditor as DeletedFinalStateUnknown.
+type watchProxy struct {
+	*httptest.Server
+	proxy *httputil.ReverseProxy
+
+	mu      sync.Mutex
+	blocked bool
+	next    int
+	cancels map[int]context.CancelFunc
+}
+
+// newWatchProxy starts a proxy to the api server of cfg, and returns the
+// config of a client that connects through it.
+func newWatchProxy(cfg *rest.Config) (*watchProxy, *rest.Config) {
+	target, err := url.Parse(cfg.Host)
+	Expect(err).NotTo(HaveOccurred())
+	transport, err := rest.TransportFor(cfg)
+	Expect(err).NotTo(HaveOccurred())
+
+	p := &watchProxy{
+		proxy:   httputil.NewSingleHostReverseProxy(target),
+		cancels: map[int]context.CancelFunc{},
+	}
+	p.proxy.Transport = transport
+	// stream watch events as they arrive
+	p.proxy.FlushInterval = -1
+	p.Server = httptest.NewServer(p)
+
+	return p, &rest.Config{
+		Host:  p.URL,
+		QPS:   cfg.QPS,
+		Burst: cfg.Burst,
+	}
+}
+
+func (p *watchProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if watch := r.URL.Query().Get("watch"); watch != "true" && watch != "1" {
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+
+	p.mu.Lock()
+	if p.blocked {
+		p.mu.Unlock()
+		writeExpired(w)
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	id := p.next
+	p.next++
+	p.cancels[id] = cancel
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.cancels, id)
+		p.mu.Unlock()
+		cancel()
+	}()
+	p.proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// Block ends all running watches, and fails new ones until Unblock is
+// called.
+func (p *watchProxy) Block() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blocked = true
+	for _, cancel := range p.cancels {
+		cancel()
+	}
+}
+
+func (p *watchProxy) Unblock() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blocked = false
+}
+
+func writeExpired(w http.ResponseWriter) {
+	status := metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Status",
+		},
+		Status:  metav1.StatusFailure,
+		Message: "too old resource version",
+		Reason:  metav1.StatusReasonExpired,
+		Code:    http.StatusGone,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusGone)
+	_ = json.NewEncoder(w).Encode(status)
+}
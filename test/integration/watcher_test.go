@@ -0,0 +1,242 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration_test
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	api "go.bytebuilders.dev/audit/api/v1"
+	"gomodules.xyz/x/crypto/rand"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"kmodules.xyz/custom-resources/apis/auditor/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+const sampleGroup = "samples.kubeops.dev"
+
+var (
+	configMapGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	secretGVR    = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	widgetGVR    = schema.GroupVersionResource{Group: sampleGroup, Version: "v1alpha1", Resource: "widgets"}
+	gadgetGVR    = schema.GroupVersionResource{Group: sampleGroup, Version: "v1alpha1", Resource: "gadgets"}
+
+	// gadgets are only installed by the specs that need them
+	lateCRDs = envtest.CRDInstallOptions{
+		Paths: []string{filepath.Join("testdata", "late")},
+	}
+)
+
+func policyFor(resources ...v1alpha1.GroupResources) v1alpha1.AuditRegistration {
+	return v1alpha1.AuditRegistration{Resources: resources}
+}
+
+func newObject(gvr schema.GroupVersionResource, kind, name string, content map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: content}
+	if obj.Object == nil {
+		obj.Object = map[string]interface{}{}
+	}
+	obj.SetAPIVersion(gvr.GroupVersion().String())
+	obj.SetKind(kind)
+	obj.SetNamespace(metav1.NamespaceDefault)
+	obj.SetName(name)
+	return obj
+}
+
+func createObject(gvr schema.GroupVersionResource, obj *unstructured.Unstructured) {
+	_, err := dynamicClient.Resource(gvr).Namespace(obj.GetNamespace()).Create(context.TODO(), obj, metav1.CreateOptions{})
+	Expect(err).NotTo(HaveOccurred())
+}
+
+func updateObject(gvr schema.GroupVersionResource, name string, mutate func(obj *unstructured.Unstructured)) {
+	ri := dynamicClient.Resource(gvr).Namespace(metav1.NamespaceDefault)
+	obj, err := ri.Get(context.TODO(), name, metav1.GetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	mutate(obj)
+	_, err = ri.Update(context.TODO(), obj, metav1.UpdateOptions{})
+	Expect(err).NotTo(HaveOccurred())
+}
+
+func deleteObject(gvr schema.GroupVersionResource, name string) {
+	err := dynamicClient.Resource(gvr).Namespace(metav1.NamespaceDefault).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	Expect(err).NotTo(HaveOccurred())
+}
+
+func eventsOf(a *Auditor, kind, name string) func() []api.EventType {
+	return func() []api.EventType {
+		return a.Events(kind, name)
+	}
+}
+
+var _ = Describe("Auditor", func() {
+	var auditor *Auditor
+
+	AfterEach(func() {
+		if auditor != nil {
+			auditor.Stop()
+			auditor = nil
+		}
+	})
+
+	Context("with a policy for configmaps and widgets", func() {
+		BeforeEach(func() {
+			auditor = StartAuditor(policyFor(
+				v1alpha1.GroupResources{Resources: []string{"configmaps"}},
+				v1alpha1.GroupResources{Group: sampleGroup, Resources: []string{"widgets"}},
+			), 0)
+			Eventually(auditor.Watched).Should(Equal([]string{"configmaps", "widgets.samples.kubeops.dev"}))
+		})
+
+		It("should publish creates, updates and deletes", func() {
+			name := rand.WithUniqSuffix("widget")
+			createObject(widgetGVR, newObject(widgetGVR, "Widget", name, map[string]interface{}{
+				"spec": map[string]interface{}{"size": int64(1)},
+			}))
+			Eventually(eventsOf(auditor, "Widget", name)).Should(Equal([]api.EventType{api.EventCreated}))
+
+			By("Changing the spec of the widget")
+			updateObject(widgetGVR, name, func(obj *unstructured.Unstructured) {
+				Expect(unstructured.SetNestedField(obj.Object, int64(2), "spec", "size")).To(Succeed())
+			})
+			Eventually(eventsOf(auditor, "Widget", name)).Should(Equal([]api.EventType{api.EventCreated, api.EventUpdated}))
+
+			By("Deleting the widget")
+			deleteObject(widgetGVR, name)
+			Eventually(eventsOf(auditor, "Widget", name)).Should(Equal([]api.EventType{api.EventCreated, api.EventUpdated, api.EventDeleted}))
+		})
+
+		It("should not audit resources outside of the policy", func() {
+			name := rand.WithUniqSuffix("audit")
+			createObject(secretGVR, newObject(secretGVR, "Secret", name, nil))
+			createObject(configMapGVR, newObject(configMapGVR, "ConfigMap", name, nil))
+
+			Eventually(eventsOf(auditor, "ConfigMap", name)).Should(Equal([]api.EventType{api.EventCreated}))
+			Consistently(eventsOf(auditor, "Secret", name), 3*time.Second).Should(BeEmpty())
+		})
+	})
+
+	Context("with a resync period", func() {
+		BeforeEach(func() {
+			auditor = StartAuditor(policyFor(
+				v1alpha1.GroupResources{Group: sampleGroup, Resources: []string{"widgets"}},
+			), time.Second)
+			Eventually(auditor.Watched).Should(Equal([]string{"widgets.samples.kubeops.dev"}))
+		})
+
+		It("should not publish resyncs and updates that keep the generation", func() {
+			name := rand.WithUniqSuffix("widget")
+			createObject(widgetGVR, newObject(widgetGVR, "Widget", name, map[string]interface{}{
+				"spec": map[string]interface{}{"size": int64(1)},
+			}))
+			Eventually(eventsOf(auditor, "Widget", name)).Should(Equal([]api.EventType{api.EventCreated}))
+
+			By("Changing only the labels of the widget")
+			updateObject(widgetGVR, name, func(obj *unstructured.Unstructured) {
+				obj.SetLabels(map[string]string{"team": "a"})
+			})
+			Consistently(eventsOf(auditor, "Widget", name), 5*time.Second).Should(Equal([]api.EventType{api.EventCreated}))
+		})
+	})
+
+	Context("when a delete is missed by the watch", func() {
+		BeforeEach(func() {
+			auditor = StartAuditor(policyFor(
+				v1alpha1.GroupResources{Group: sampleGroup, Resources: []string{"widgets"}},
+			), 0)
+			Eventually(auditor.Watched).Should(Equal([]string{"widgets.samples.kubeops.dev"}))
+		})
+
+		It("should publish the delete found by the relist", func() {
+			name := rand.WithUniqSuffix("widget")
+			createObject(widgetGVR, newObject(widgetGVR, "Widget", name, nil))
+			Eventually(eventsOf(auditor, "Widget", name)).Should(Equal([]api.EventType{api.EventCreated}))
+
+			By("Deleting the widget while the auditor can't watch")
+			auditor.BlockWatches()
+			defer auditor.UnblockWatches()
+			deleteObject(widgetGVR, name)
+
+			// the informer only learns about the delete from the relist, and
+			// hands it over as DeletedFinalStateUnknown
+			Eventually(eventsOf(auditor, "Widget", name)).Should(Equal([]api.EventType{api.EventCreated, api.EventDeleted}))
+		})
+	})
+
+	Context("when a CRD of the policy is installed after startup", func() {
+		policy := policyFor(
+			v1alpha1.GroupResources{Group: sampleGroup, Resources: []string{"widgets", "gadgets"}},
+		)
+
+		BeforeEach(func() {
+			auditor = StartAuditor(policy, 0)
+			Eventually(auditor.Watched).Should(Equal([]string{"widgets.samples.kubeops.dev"}))
+		})
+
+		AfterEach(func() {
+			Expect(envtest.UninstallCRDs(restConfig, lateCRDs)).To(Succeed())
+		})
+
+		It("should audit it once the auditor restarts", func() {
+			_, err := envtest.InstallCRDs(restConfig, lateCRDs)
+			Expect(err).NotTo(HaveOccurred())
+
+			name := rand.WithUniqSuffix("gadget")
+			createObject(gadgetGVR, newObject(gadgetGVR, "Gadget", name, nil))
+
+			By("Checking that the running auditor ignores the new CRD")
+			Consistently(auditor.Watched, 3*time.Second).Should(Equal([]string{"widgets.samples.kubeops.dev"}))
+			Expect(auditor.Events("Gadget", name)).To(BeEmpty())
+
+			By("Restarting the auditor")
+			auditor.Stop()
+			auditor = StartAuditor(policy, 0)
+			Eventually(auditor.Watched).Should(Equal([]string{"gadgets.samples.kubeops.dev", "widgets.samples.kubeops.dev"}))
+			Eventually(eventsOf(auditor, "Gadget", name)).Should(Equal([]api.EventType{api.EventCreated}))
+		})
+	})
+
+	Context("when the policy changes", func() {
+		It("should audit the resources of the new policy after a restart", func() {
+			auditor = StartAuditor(policyFor(
+				v1alpha1.GroupResources{Resources: []string{"configmaps"}},
+			), 0)
+			Eventually(auditor.Watched).Should(Equal([]string{"configmaps"}))
+
+			before := rand.WithUniqSuffix("before")
+			createObject(configMapGVR, newObject(configMapGVR, "ConfigMap", before, nil))
+			Eventually(eventsOf(auditor, "ConfigMap", before)).Should(Equal([]api.EventType{api.EventCreated}))
+
+			By("Restarting the auditor with a policy for widgets")
+			auditor.Stop()
+			auditor = StartAuditor(policyFor(
+				v1alpha1.GroupResources{Group: sampleGroup, Resources: []string{"widgets"}},
+			), 0)
+			Eventually(auditor.Watched).Should(Equal([]string{"widgets.samples.kubeops.dev"}))
+
+			after := rand.WithUniqSuffix("after")
+			createObject(widgetGVR, newObject(widgetGVR, "Widget", after, nil))
+			createObject(configMapGVR, newObject(configMapGVR, "ConfigMap", after, nil))
+			Eventually(eventsOf(auditor, "Widget", after)).Should(Equal([]api.EventType{api.EventCreated}))
+			Consistently(eventsOf(auditor, "ConfigMap", after), 3*time.Second).Should(BeEmpty())
+		})
+	})
+})